@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// applyBookingHeaders sets the BOOKING_HEADERS and BOOKING_COOKIES of cfg on
+// page before it loads bookingURL. The cookies are set for the host of
+// bookingURL.
+func applyBookingHeaders(cfg *Config, page *rod.Page, bookingURL string) error {
+	if len(cfg.BookingHeaders) > 0 {
+		headers := make([]string, 0, len(cfg.BookingHeaders)*2)
+		for name, value := range cfg.BookingHeaders {
+			headers = append(headers, name, value)
+		}
+		// The headers last as long as the page, which is closed after the
+		// scrape, so there is nothing to clean up
+		if _, err := page.SetExtraHeaders(headers); err != nil {
+			return fmt.Errorf("error setting booking page headers: %v", err)
+		}
+	}
+
+	if len(cfg.BookingCookies) > 0 {
+		cookies := make([]*proto.NetworkCookieParam, 0, len(cfg.BookingCookies))
+		for name, value := range cfg.BookingCookies {
+			cookies = append(cookies, &proto.NetworkCookieParam{
+				Name:  name,
+				Value: value,
+				URL:   bookingURL,
+			})
+		}
+		if err := page.SetCookies(cookies); err != nil {
+			return fmt.Errorf("error setting booking page cookies: %v", err)
+		}
+	}
+	return nil
+}
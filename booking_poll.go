@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// bookingOpenPollWait returns how long to wait before polling the movie for
+// its bookings opening, and false when it isn't expecting them to. Within
+// the window around BookingOpensAt the movie is polled every
+// BookingOpenPoll. Past it the wait doubles with every further window, and
+// before it the wait is until the window starts.
+func (m *MovieDetails) bookingOpenPollWait(cfg *Config, now time.Time) (time.Duration, bool) {
+	if m.BookingOpensAt.IsZero() || m.Found || m.Expired || !m.enabled() || m.Code == "" || m.bookingsOpen() {
+		return 0, false
+	}
+	window := cfg.BookingOpenWindow
+	start := m.BookingOpensAt.Add(-window)
+	end := m.BookingOpensAt.Add(window)
+	switch {
+	case now.Before(start):
+		return start.Sub(now), true
+	case !now.After(end):
+		return cfg.BookingOpenPoll, true
+	}
+	// Capped well short of overflowing, the wait is past any interval by
+	// then anyway
+	steps := min(int(now.Sub(end)/window)+1, 20)
+	return cfg.BookingOpenPoll << steps, true
+}
+
+// bookingsOpen reports whether every watched date of the movie has already
+// listed theatres, after which polling for its bookings to open is pointless.
+func (m *MovieDetails) bookingsOpen() bool {
+	for _, city := range m.showCities() {
+		for _, date := range m.showDates() {
+			if state := m.dateState(city.City, date); !state.BookingOpen && !state.Found && !state.Expired {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nextBookingOpenPoll returns how long the scheduler waits before the next
+// run polling the movies of moviesList whose bookings are about to open, and
+// false when the regular run in interval comes first.
+func nextBookingOpenPoll(cfg *Config, moviesList []MovieDetails, now time.Time, interval time.Duration) (time.Duration, bool) {
+	next := interval
+	for i := range moviesList {
+		if !selectedForRun(cfg, &moviesList[i]) {
+			continue
+		}
+		if wait, ok := moviesList[i].bookingOpenPollWait(cfg, now); ok && wait < next {
+			next = wait
+		}
+	}
+	return next, next < interval
+}
+
+// bookingOpenPollCodes returns the codes of the movies of moviesList the run
+// polling for bookings to open at now scrapes: those within or past the
+// window around their BookingOpensAt that are still polled more often than
+// every interval.
+func bookingOpenPollCodes(cfg *Config, moviesList []MovieDetails, now time.Time, interval time.Duration) []string {
+	var codes []string
+	for i := range moviesList {
+		movie := &moviesList[i]
+		if !selectedForRun(cfg, movie) || now.Before(movie.BookingOpensAt.Add(-cfg.BookingOpenWindow)) {
+			continue
+		}
+		if wait, ok := movie.bookingOpenPollWait(cfg, now); ok && wait < interval && !slices.Contains(codes, movie.Code) {
+			codes = append(codes, movie.Code)
+		}
+	}
+	return codes
+}
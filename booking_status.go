@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// bookingClosedPhrases are what BookMyShow shows, in lower case, on the
+// booking page of a date whose bookings haven't opened yet.
+var bookingClosedPhrases = []string{
+	"coming soon",
+	"booking opens",
+	"bookings open on",
+	"booking will open",
+}
+
+// bookingNotOpen reports whether page says bookings haven't opened yet rather
+// than listing theatres. It only reads the page when the theatre container
+// isn't already there, so pages with shows cost no more than an element
+// lookup.
+func bookingNotOpen(page PageController, containerSelector string) bool {
+	if containers, err := page.Elements(containerSelector); err != nil || len(containers) > 0 {
+		return false
+	}
+	_, text, err := page.Text()
+	if err != nil {
+		return false
+	}
+	text = strings.ToLower(text)
+	for _, phrase := range bookingClosedPhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectedFrom returns the URL page ended up at when it isn't the booking
+// page at requestedURL, as when BookMyShow sends a date whose bookings haven't
+// opened to the movie's detail page instead. Like bookingNotOpen it only looks
+// when the theatre container isn't there, a page listing theatres is the
+// booking page whatever its URL.
+func redirectedFrom(page PageController, requestedURL string, containerSelector string) (string, bool) {
+	if containers, err := page.Elements(containerSelector); err != nil || len(containers) > 0 {
+		return "", false
+	}
+	finalURL, err := page.URL()
+	if err != nil {
+		return "", false
+	}
+	requested, err := url.Parse(requestedURL)
+	if err != nil {
+		return "", false
+	}
+	final, err := url.Parse(finalURL)
+	if err != nil {
+		return "", false
+	}
+	if strings.EqualFold(strings.Trim(final.Path, "/"), strings.Trim(requested.Path, "/")) {
+		return "", false
+	}
+	return finalURL, true
+}
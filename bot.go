@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// botPollTimeout is how long a getUpdates call waits for a message
+	// before returning empty
+	botPollTimeout = time.Second * 30
+	// botErrorBackoff is the wait after a failed getUpdates call before
+	// polling again
+	botErrorBackoff = time.Second * 5
+)
+
+// botUsage is the reply to /start, /help and unknown commands.
+const botUsage = `Commands:
+/list - show the watchlist
+/status - show what has been found so far
+/add <code> <slug> <city> <city_code> <date> <name> - watch a movie
+/remove <code> <date> - stop watching a movie on a date`
+
+// telegramUpdate is the part of a getUpdates result the bot reads.
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// runBot long-polls the Bot API of notifier for commands managing the
+// watchlist until ctx is cancelled. Only messages from the chat of notifier
+// are answered, so no one else can edit the watchlist. Relative dates of the
+// movies added are taken from the current day in location.
+func runBot(ctx context.Context, notifier *TelegramNotifier, location *time.Location) {
+	// The long poll outlasts the client timeout of the notifier
+	client := &http.Client{Timeout: botPollTimeout + notifier.Client.Timeout}
+
+	logger.WithField("chat_id", notifier.ChatID).Info("Answering watchlist commands over Telegram")
+	var offset int64
+	for {
+		updates, err := getTelegramUpdates(ctx, client, notifier, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Error("Error polling Telegram for commands")
+			select {
+			case <-time.After(botErrorBackoff):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || strconv.FormatInt(update.Message.Chat.ID, 10) != notifier.ChatID {
+				continue
+			}
+
+			reply := handleBotCommand(update.Message.Text, time.Now().In(location))
+			if err := notifier.sendTelegramNotification(notifier.ChatID, reply, "", nil); err != nil {
+				logger.WithFields(logrus.Fields{
+					"command": update.Message.Text,
+					"error":   err,
+				}).Error("Error replying to Telegram command")
+			}
+		}
+	}
+}
+
+// getTelegramUpdates makes a single getUpdates call for the bot of notifier for
+// the updates from offset on, waiting up to botPollTimeout for one to arrive.
+func getTelegramUpdates(ctx context.Context, client *http.Client, notifier *TelegramNotifier, offset int64) ([]telegramUpdate, error) {
+	query := url.Values{
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"timeout":         {strconv.Itoa(int(botPollTimeout.Seconds()))},
+		"allowed_updates": {`["message"]`},
+	}
+	apiURL := notifier.apiURL("getUpdates") + "?" + query.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating telegram request: %v", err)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error making telegram request: %v", err)
+	}
+	defer response.Body.Close()
+
+	var apiResponse struct {
+		Ok          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	if !apiResponse.Ok {
+		return nil, fmt.Errorf("telegram API error: %s", apiResponse.Description)
+	}
+	return apiResponse.Result, nil
+}
+
+// handleBotCommand runs the command in text against the watchlist and returns
+// the reply to send, taking relative dates from now.
+func handleBotCommand(text string, now time.Time) string {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return botUsage
+	}
+	// In groups commands can be addressed as /list@SomeBot
+	command, _, _ := strings.Cut(args[0], "@")
+
+	switch command {
+	case "/list":
+		return botListMovies()
+	case "/status":
+		return botStatus()
+	case "/add":
+		return botAddMovie(args[1:], now)
+	case "/remove":
+		if len(args) != 3 {
+			return "Usage: /remove <code> <date>"
+		}
+		name, err := removeMovieDate(args[1], args[2])
+		if err != nil {
+			return fmt.Sprintf("Error removing movie: %v", err)
+		}
+		logger.WithFields(logrus.Fields{
+			"movie": name,
+			"date":  args[2],
+		}).Info("Removed movie from watchlist")
+		return fmt.Sprintf("Removed %s on %s", name, args[2])
+	default:
+		return botUsage
+	}
+}
+
+// botListMovies describes every entry of the watchlist, one per line.
+func botListMovies() string {
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		logger.WithError(err).Error("Error reading movies")
+		return "Error reading watchlist"
+	}
+	if len(moviesList) == 0 {
+		return "The watchlist is empty"
+	}
+
+	var lines []string
+	for i := range moviesList {
+		movie := &moviesList[i]
+		var cities []string
+		for _, city := range movie.showCities() {
+			cities = append(cities, city.City)
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s): %s on %s", movie.Name, movie.Code,
+			strings.Join(cities, ", "), strings.Join(movie.showDates(), ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// botStatus reports for every movie whether it is still watched and how many
+// theatres have been found for it.
+func botStatus() string {
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		logger.WithError(err).Error("Error reading movies")
+		return "Error reading watchlist"
+	}
+	if len(moviesList) == 0 {
+		return "The watchlist is empty"
+	}
+
+	watched := 0
+	var lines []string
+	for i := range moviesList {
+		movie := &moviesList[i]
+
+		theatres := 0
+		for _, city := range movie.showCities() {
+			for _, date := range movie.showDates() {
+				theatres += len(movie.dateState(city.City, date).Theatres)
+			}
+		}
+
+		var status string
+		switch {
+		case !movie.enabled():
+			status = "paused"
+		case movie.Found:
+			status = "found"
+		case movie.Expired:
+			status = "expired"
+		default:
+			status = "watching"
+			watched++
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s, %d theatres", movie.Name, status, theatres))
+	}
+	return fmt.Sprintf("Watching %d of %d movies\n%s", watched, len(moviesList), strings.Join(lines, "\n"))
+}
+
+// botAddMovie adds the movie described by args to the watchlist. The name
+// comes last so it can have spaces in it, and the date can be in any form
+// bms.json accepts, relative ones taken from now.
+func botAddMovie(args []string, now time.Time) string {
+	if len(args) < 6 {
+		return "Usage: /add <code> <slug> <city> <city_code> <date> <name>"
+	}
+	movie := MovieDetails{
+		Code:      args[0],
+		SlugName:  args[1],
+		City:      args[2],
+		CityCode:  args[3],
+		Date:      args[4],
+		Name:      strings.Join(args[5:], " "),
+		DateState: DateState{Theatres: []TheatreRecord{}},
+	}
+	movie.normalizeDates(now)
+	if err := movie.validate(); err != nil {
+		return fmt.Sprintf("Invalid movie: %v", err)
+	}
+
+	// A run in progress holds the lock until its final save, which would
+	// otherwise overwrite the movie added
+	storeLock, err := acquireStoreLock(storeLockPath)
+	if err != nil {
+		logger.WithError(err).Error("Error locking movies")
+		return "Error locking watchlist"
+	}
+	defer storeLock.Release()
+
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		logger.WithError(err).Error("Error reading movies")
+		return "Error reading watchlist"
+	}
+	if slices.ContainsFunc(moviesList, func(m MovieDetails) bool {
+		return m.Code == movie.Code && m.City == movie.City && slices.Contains(m.showDates(), movie.Date)
+	}) {
+		return fmt.Sprintf("%s is already watched in %s on %s", movie.Name, movie.City, movie.Date)
+	}
+
+	moviesList = append(moviesList, movie)
+	if err := movieStore.Save(moviesList); err != nil {
+		logger.WithError(err).Error("Error saving movies")
+		return "Error saving watchlist"
+	}
+
+	logger.WithFields(logrus.Fields{
+		"movie": movie.Name,
+		"code":  movie.Code,
+		"dates": movie.showDates(),
+	}).Info("Added movie to watchlist")
+	return fmt.Sprintf("Watching %s in %s on %s", movie.Name, movie.City, movie.Date)
+}
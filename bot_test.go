@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBotAddKeepsConcurrentSave(t *testing.T) {
+	store := useTestStore(t)
+	racing := &racingStore{Store: store, done: make(chan struct{})}
+	racing.writer = func() {
+		saveLikeARun(t, store, MovieDetails{Name: "Thudarum", SlugName: "thudarum", Code: "ET00400002", City: "kochi", CityCode: "KOCH", Date: "20991230"})
+	}
+	movieStore = racing
+
+	if reply := handleBotCommand("/add ET00400001 bazooka kochi KOCH 20991230 Bazooka", time.Now()); !strings.HasPrefix(reply, "Watching Bazooka") {
+		t.Errorf("/add reply = %q, want it to confirm the movie is watched", reply)
+	}
+	<-racing.done
+
+	want := []string{"ET00305698", "ET00400001", "ET00400002"}
+	if codes := watchedCodes(t, store); !slices.Equal(codes, want) {
+		t.Errorf("watched codes = %v, want %v", codes, want)
+	}
+}
+
+func TestBotAddNormalizesDate(t *testing.T) {
+	useTestStore(t)
+	now := time.Date(2099, 12, 30, 22, 0, 0, 0, time.UTC)
+
+	if reply := handleBotCommand("/add ET00400001 bazooka kochi KOCH tomorrow Bazooka", now); reply != "Watching Bazooka in kochi on 20991231" {
+		t.Errorf("/add tomorrow reply = %q, want it watched on 20991231", reply)
+	}
+	if reply := handleBotCommand("/add ET00400001 bazooka kochi KOCH 2099-12-31 Bazooka", now); reply != "Bazooka is already watched in kochi on 20991231" {
+		t.Errorf("/add 2099-12-31 reply = %q, want it reported as already watched", reply)
+	}
+}
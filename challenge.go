@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// challengeSelectors match elements of the captcha and challenge pages put in
+// front of BookMyShow.
+var challengeSelectors = []string{
+	"#challenge-form",
+	"#challenge-running",
+	".cf-browser-verification",
+	".g-recaptcha",
+	".h-captcha",
+	"#px-captcha",
+	`iframe[src*="captcha"]`,
+	`iframe[src*="challenges.cloudflare.com"]`,
+}
+
+// challengeTexts are phrases of challenge pages, matched in lower case against
+// the page title and, for pages too short to be a booking page, their text.
+var challengeTexts = []string{
+	"verify you are human",
+	"are you a robot",
+	"checking your browser",
+	"just a moment",
+	"unusual traffic",
+	"access denied",
+	"captcha",
+}
+
+// challengePageMaxText is the longest page text still checked for
+// challengeTexts, real booking pages are far longer.
+const challengePageMaxText = 2000
+
+// blockedAlertSent makes sure a run sends at most one operator alert about
+// being blocked, however many of its pages were challenged.
+var blockedAlertSent atomic.Bool
+
+// isChallengePage reports whether page shows a bot challenge or captcha.
+func isChallengePage(page PageController) bool {
+	for _, selector := range challengeSelectors {
+		if elements, err := page.Elements(selector); err == nil && len(elements) > 0 {
+			return true
+		}
+	}
+
+	title, text, err := page.Text()
+	if err != nil {
+		return false
+	}
+	title = strings.ToLower(title)
+	text = strings.ToLower(text)
+	for _, phrase := range challengeTexts {
+		if strings.Contains(title, phrase) {
+			return true
+		}
+		if len(text) <= challengePageMaxText && strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertBlocked tells the operator over Telegram, once per run, that
+// BookMyShow is challenging the scraper, when OPERATOR_CHAT_ID is set.
+func alertBlocked(cfg *Config, movie *MovieDetails, city string, date string, bookingURL string) {
+	if cfg.OperatorChatID == "" || !blockedAlertSent.CompareAndSwap(false, true) {
+		return
+	}
+
+	payload := NotificationPayload{
+		Kind:       NotificationBlocked,
+		Movie:      movie.Name,
+		City:       city,
+		Date:       date,
+		BookingURL: bookingURL,
+		ChatID:     cfg.OperatorChatID,
+	}
+	for _, notifier := range cfg.Notifiers {
+		if notifier.Name() != "telegram" {
+			continue
+		}
+		if err := notifier.Notify(payload); err != nil {
+			logger.WithFields(logrus.Fields{
+				"movie": movie.Name,
+				"error": err,
+			}).Error("Error sending blocked alert")
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runCommand runs the CLI subcommand named by args[0], reporting false when
+// there is no such subcommand.
+func runCommand(cfg *Config, args []string) (bool, error) {
+	switch args[0] {
+	case "list":
+		return true, listMovies(os.Stdout)
+	case "remove":
+		if len(args) != 3 {
+			return true, errors.New("usage: remove <code> <date>")
+		}
+		return true, removeMovie(args[1], args[2])
+	case "resolve":
+		if len(args) != 3 {
+			return true, errors.New("usage: resolve <slug|url> <city>")
+		}
+		return true, resolveMovie(os.Stdout, cfg, args[1], args[2])
+	case "test-notify":
+		return true, testNotify(os.Stdout, cfg)
+	case "validate":
+		if len(args) != 2 {
+			return true, errors.New("usage: validate <file>")
+		}
+		return true, validateMoviesFile(os.Stdout, args[1], cfg.ShowLocation)
+	default:
+		return false, nil
+	}
+}
+
+// listMovies prints the watchlist as a table.
+func listMovies(w io.Writer) error {
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tCODE\tCITY\tDATE\tFOUND\tTHEATRES")
+	for i := range moviesList {
+		movie := &moviesList[i]
+
+		var cities []string
+		theatres := 0
+		for _, city := range movie.showCities() {
+			cities = append(cities, city.City)
+			for _, date := range movie.showDates() {
+				theatres += len(movie.dateState(city.City, date).Theatres)
+			}
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%t\t%d\n", movie.Name, movie.Code,
+			strings.Join(cities, ", "), strings.Join(movie.showDates(), ", "), movie.Found, theatres)
+	}
+	return table.Flush()
+}
+
+// removeMovie stops watching the movie with code on date. An entry watching
+// several dates only loses that date, and is removed once none are left.
+func removeMovie(code string, date string) error {
+	name, err := removeMovieDate(code, date)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s on %s\n", name, date)
+	return nil
+}
+
+// removeMovieDate removes date from the watchlist entry of the movie with
+// code, like removeMovie, returning the name of the movie. It waits for a run
+// in progress to save first, which would otherwise put the entry back.
+func removeMovieDate(code string, date string) (string, error) {
+	storeLock, err := acquireStoreLock(storeLockPath)
+	if err != nil {
+		return "", err
+	}
+	defer storeLock.Release()
+
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		return "", err
+	}
+
+	index := slices.IndexFunc(moviesList, func(m MovieDetails) bool {
+		return m.Code == code && slices.Contains(m.showDates(), date)
+	})
+	if index < 0 {
+		return "", fmt.Errorf("no movie with code %s watched on %s", code, date)
+	}
+
+	movie := &moviesList[index]
+	name := movie.Name
+	if len(movie.Dates) > 1 {
+		movie.Dates = slices.DeleteFunc(movie.Dates, func(d string) bool {
+			return d == date
+		})
+		delete(movie.DateStates, date)
+		for _, states := range movie.CityStates {
+			delete(states, date)
+		}
+	} else {
+		moviesList = slices.Delete(moviesList, index, index+1)
+	}
+
+	if err := movieStore.Save(moviesList); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// testNotify sends a sample alert through every notifier of cfg on its own,
+// printing which delivered it and why the others failed. It fails when any
+// of them did.
+func testNotify(w io.Writer, cfg *Config) error {
+	now := time.Now().In(cfg.ShowLocation)
+	payload := NotificationPayload{
+		Kind:          NotificationNewShow,
+		Movie:         "Test Movie",
+		City:          "kochi",
+		Date:          now.Format("02-01-2006"),
+		Theatre:       "Test Theatre (this is a test alert)",
+		ShowCount:     3,
+		ShowTimes:     []string{"10:00 AM", "02:30 PM", "07:00 PM"},
+		BookingURL:    "https://in.bookmyshow.com/explore/movies-kochi",
+		TotalTheatres: 1,
+		TotalShows:    3,
+	}
+
+	failed := 0
+	for _, notifier := range cfg.Notifiers {
+		if err := notifier.Notify(payload); err != nil {
+			failed++
+			fmt.Fprintf(w, "failed  %s: %v\n", notifier.Name(), err)
+			continue
+		}
+		fmt.Fprintf(w, "ok      %s\n", notifier.Name())
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notifiers failed to send the test alert", failed, len(cfg.Notifiers))
+	}
+	fmt.Fprintf(w, "All %d notifiers sent the test alert\n", len(cfg.Notifiers))
+	return nil
+}
+
+// validateMoviesFile checks every entry of a watchlist file the way a run
+// would, and also flags dates that have already passed, printing what is
+// wrong with each entry. Relative dates are resolved against today in loc. It
+// fails when any entry has a problem.
+func validateMoviesFile(w io.Writer, filename string, loc *time.Location) error {
+	fileData, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %v", filename, err)
+	}
+	fileData, _, err = migrateLegacyTheatres(fileData)
+	if err != nil {
+		return fmt.Errorf("error migrating %s: %v", filename, err)
+	}
+
+	var moviesList []MovieDetails
+	if err := json.Unmarshal(fileData, &moviesList); err != nil {
+		return fmt.Errorf("error unmarshaling JSON: %v", err)
+	}
+
+	now := time.Now().In(loc)
+	today := now.Format("20060102")
+	invalid := 0
+	for i := range moviesList {
+		movie := &moviesList[i]
+		movie.normalizeDates(now)
+
+		var problems []string
+		if err := movie.validate(); err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			// Valid dates are YYYYMMDD, so they compare as strings
+			for _, date := range movie.showDates() {
+				if date < today {
+					problems = append(problems, fmt.Sprintf("date %s is in the past", date))
+				}
+			}
+		}
+
+		if len(problems) == 0 {
+			fmt.Fprintf(w, "ok       #%d %s\n", i, movie.Name)
+			continue
+		}
+		invalid++
+		fmt.Fprintf(w, "invalid  #%d %s\n", i, movie.Name)
+		for _, problem := range problems {
+			fmt.Fprintf(w, "         - %s\n", problem)
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d entries in %s are invalid", invalid, len(moviesList), filename)
+	}
+	fmt.Fprintf(w, "All %d entries in %s are valid\n", len(moviesList), filename)
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRemoveMovieDateKeepsConcurrentSave(t *testing.T) {
+	store := useTestStore(t)
+	racing := &racingStore{Store: store, done: make(chan struct{})}
+	racing.writer = func() {
+		saveLikeARun(t, store, MovieDetails{Name: "Thudarum", SlugName: "thudarum", Code: "ET00400002", City: "kochi", CityCode: "KOCH", Date: "20991230"})
+	}
+	movieStore = racing
+
+	name, err := removeMovieDate("ET00305698", "20991231")
+	if err != nil || name != "L2: Empuraan" {
+		t.Errorf("removeMovieDate() = %q, %v, want L2: Empuraan", name, err)
+	}
+	<-racing.done
+
+	want := []string{"ET00400002"}
+	if codes := watchedCodes(t, store); !slices.Equal(codes, want) {
+		t.Errorf("watched codes = %v, want %v", codes, want)
+	}
+}
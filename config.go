@@ -0,0 +1,1002 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the config file read when neither --config nor
+// CONFIG_FILE names one, if it exists.
+const defaultConfigFile = "config.yaml"
+
+// Config holds every setting read from the environment, with defaults filled
+// in for the ones that aren't set. It is passed to everything that scrapes or
+// notifies rather than being kept in globals.
+type Config struct {
+	// Notifiers are the alert destinations that are configured, at least
+	// one. TelegramEnabled is set when one of them is Telegram.
+	Notifiers       []Notifier
+	TelegramEnabled bool
+	OperatorChatID  string
+	// TelegramTestChatID is where --preview sends every alert
+	TelegramTestChatID string
+
+	ScraperConcurrency    int
+	PagesPerMovie         int
+	NavigationAttempts    int
+	BrowserLaunchAttempts int
+	// NavigationLimiter holds navigations to BookMyShow to BMS_MAX_RPS
+	// across every worker, nil when they aren't limited
+	NavigationLimiter *RateLimiter
+	BrowserTimeout    time.Duration
+	RunTimeout        time.Duration
+	// RunDeadline bounds the whole process of a single run, from its
+	// start, unbounded when zero
+	RunDeadline      time.Duration
+	DOMStableTimeout time.Duration
+	ContainerTimeout time.Duration
+	// ShowSettleTimeout bounds how long the show count of a theatre is
+	// waited on to stop changing, zero reads it once
+	ShowSettleTimeout  time.Duration
+	DelayBetweenMovies time.Duration
+	// NotifyCooldown is how long after an alert about a new theatre the
+	// same theatre isn't alerted about again, even if it disappears from
+	// state. Zero turns the cooldown off.
+	NotifyCooldown time.Duration
+	// DeliveryDedupWindow is how long a delivered alert is remembered, so a
+	// run repeating it after a crash lost the state doesn't send it again.
+	// Zero turns it off.
+	DeliveryDedupWindow time.Duration
+	// ScheduleJitter is the longest random wait before each run on an
+	// interval
+	ScheduleJitter time.Duration
+	// CatchUpAfter is how long a movie can go unchecked before a run
+	// scrapes it ahead of the others, never when zero
+	CatchUpAfter       time.Duration
+	BookingURLTemplate string
+	// ScrapeStrategy is how a movie's dates in a city are loaded: a
+	// navigation per date, or clicking through the date tabs of one page
+	// with scrapeStrategyDateTabs
+	ScrapeStrategy string
+	// ShowLocation is the timezone show dates are in, used to tell when
+	// they have passed
+	ShowLocation *time.Location
+
+	BrowserHeadless bool
+	BrowserDevtools bool
+	// NetworkDebug logs the XHR and fetch responses of booking pages
+	NetworkDebug bool
+	BrowserProxy *url.URL
+	// BrowserBinPath is the browser binary to launch as is. Without it the
+	// browser is downloaded once to BrowserCacheDir, or rod's default
+	// directory when that is empty too, and reused from there
+	BrowserBinPath  string
+	BrowserCacheDir string
+	// BookingHeaders and BookingCookies are sent with every booking page,
+	// e.g. to pick the region BookMyShow renders theatres for
+	BookingHeaders map[string]string
+	BookingCookies map[string]string
+	// TheatreNames tells which scraped names are the same theatre
+	TheatreNames *TheatreNames
+
+	// OnlyMovies and OnlyDate narrow a run down to the movies with those
+	// codes, and to that date of them, as set by --movie and --date and for
+	// the runs polling movies whose bookings are about to open
+	OnlyMovies []string
+	OnlyDate   string
+	// BookingOpenPoll is how often a movie is scraped within BookingOpenWindow
+	// of its booking_opens_at, with --interval
+	BookingOpenPoll   time.Duration
+	BookingOpenWindow time.Duration
+
+	DryRun bool
+	// Preview sends every alert to TelegramTestChatID alone, and saves no
+	// state like a dry run
+	Preview            bool
+	SuppressInitial    bool
+	BatchNotifications bool
+	SendSummary        bool
+	// NotifyBookingOpen sends an alert when a date's bookings open
+	NotifyBookingOpen bool
+	// NotifySoldOut sends an alert when every show of a date sold out
+	NotifySoldOut bool
+	// NotifyNewFormats sends an alert when a theatre lists a format it was
+	// never seen with
+	NotifyNewFormats bool
+	// MinShowCount is how many shows a new theatre needs to be notified
+	// about, for movies that don't set their own
+	MinShowCount int
+	// MaxNotificationsPerRun caps the alerts sent in a run, unlimited when
+	// zero
+	MaxNotificationsPerRun int
+	// Shortener shortens the booking links of show alerts when set
+	Shortener *URLShortener
+	// AbortOnScrapeError stops the run after the first movie with a scrape
+	// error, instead of moving on to the next movie
+	AbortOnScrapeError bool
+	// QuietHours is when alerts aren't sent, never when nil
+	QuietHours *QuietHours
+	// MovieErrorAlertAfter is how many runs in a row a movie has to fail
+	// for the operator to be alerted, never when zero
+	MovieErrorAlertAfter int
+
+	ServerAddr     string
+	MetricsAddr    string
+	PushgatewayURL string
+	// Heartbeat is pinged at the end of every completed run when set
+	Heartbeat *Heartbeat
+
+	// Data files live in the working directory unless DATA_DIR moves them,
+	// or their own variable points somewhere else
+	MoviesPath string
+	// WatchlistGlob matches several watchlist files used instead of
+	// MoviesPath
+	WatchlistGlob string
+	// JSONCompact writes the watchlist files without indentation
+	JSONCompact bool
+
+	LogPath       string
+	SQLitePath    string
+	NotifiedPath  string
+	DeliveredPath string
+	LockPath      string
+	StoreLockPath string
+	ReportDir     string
+	// Reports older than ReportCompressAfterDays are gzipped, and those
+	// older than ReportRetentionDays deleted, never when zero
+	ReportCompressAfterDays int
+	ReportRetentionDays     int
+	// SelfCheckCode, SelfCheckSlug and SelfCheckCity name the movie
+	// --selfcheck scrapes, on SelfCheckDate
+	SelfCheckCode string
+	SelfCheckSlug string
+	SelfCheckCity string
+	SelfCheckDate string
+	// ScreenshotDir is where a PNG of the page is saved when a scrape fails
+	// to load it, with ScreenshotOnError set
+	ScreenshotDir     string
+	ScreenshotOnError bool
+	// PosterFromPage reads the poster of movies without poster_url off
+	// their booking page
+	PosterFromPage bool
+	StoreBackend   string
+
+	LogFormat     string
+	LogLevel      logrus.Level
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	LogMaxAgeDays int
+}
+
+// readDotEnv reads the settings in .env when there is one, reporting whether
+// the file was there. Without it the settings come from the real environment
+// alone, as under Docker.
+func readDotEnv() (map[string]string, bool, error) {
+	settings, err := godotenv.Read()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error loading .env file: %v", err)
+	}
+	return settings, true, nil
+}
+
+// applyDotEnv sets the variables of settings, read from .env, that neither the
+// environment nor the config file set. So .env only fills in for the defaults,
+// below the config file.
+func applyDotEnv(settings map[string]string) error {
+	for name, value := range settings {
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return fmt.Errorf("error setting %s from .env file: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// loadConfigFile sets the environment from the YAML config file in filename,
+// reporting whether there was one. Its keys are the env var names in any case,
+// e.g. scraper_concurrency, and variables already set in the environment win
+// over it. It is loaded before .env, which only fills in what it leaves unset.
+// An empty filename reads CONFIG_FILE, or defaultConfigFile when it exists.
+func loadConfigFile(filename string) (bool, error) {
+	if filename == "" {
+		filename = os.Getenv("CONFIG_FILE")
+	}
+	required := filename != ""
+	if !required {
+		filename = defaultConfigFile
+	}
+
+	fileData, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading config file %s: %v", filename, err)
+	}
+
+	var settings map[string]any
+	if err := yaml.Unmarshal(fileData, &settings); err != nil {
+		return false, fmt.Errorf("error parsing config file %s: %v", filename, err)
+	}
+	for key, value := range settings {
+		name := strings.ToUpper(key)
+		if _, set := os.LookupEnv(name); set || value == nil {
+			continue
+		}
+
+		var envValue string
+		switch value := value.(type) {
+		case map[string]any:
+			// Sections are for the settings taking a JSON object, like
+			// BOOKING_HEADERS
+			fields := make(map[string]string, len(value))
+			for field, item := range value {
+				fields[field] = fmt.Sprint(item)
+			}
+			encoded, err := json.Marshal(fields)
+			if err != nil {
+				return false, fmt.Errorf("invalid %s in config file %s: %v", key, filename, err)
+			}
+			envValue = string(encoded)
+		case []any:
+			// Lists are for the comma-separated settings, like EMAIL_TO
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			envValue = strings.Join(items, ",")
+		default:
+			envValue = fmt.Sprint(value)
+		}
+		if err := os.Setenv(name, envValue); err != nil {
+			return false, fmt.Errorf("error setting %s from config file %s: %v", name, filename, err)
+		}
+	}
+	return true, nil
+}
+
+// loadConfig reads the settings from the environment, returning an error
+// naming a setting that is invalid. dryRun, from the --dry-run flag, turns on a
+// dry run even when DRY_RUN doesn't.
+func loadConfig(dryRun bool) (*Config, error) {
+	cfg := &Config{
+		ScraperConcurrency:    3,
+		PagesPerMovie:         2,
+		NavigationAttempts:    3,
+		BrowserLaunchAttempts: 3,
+		BrowserTimeout:        time.Minute * 1,
+		DOMStableTimeout:      time.Second * 30,
+		ContainerTimeout:      time.Second * 30,
+		ShowSettleTimeout:     time.Second,
+		BookingOpenPoll:       time.Second * 30,
+		BookingOpenWindow:     time.Minute * 15,
+		BookingURLTemplate:    defaultBookingURLTemplate,
+		BrowserHeadless:       true,
+		ServerAddr:            ":8080",
+		LogFormat:             "text",
+		LogLevel:              logrus.InfoLevel,
+		LogMaxSizeMB:          10,
+		LogMaxBackups:         3,
+		LogMaxAgeDays:         28,
+		StoreBackend:          "json",
+		MovieErrorAlertAfter:  5,
+		DeliveryDedupWindow:   time.Hour,
+		// A day of reports stays readable as it is
+		ReportCompressAfterDays: 1,
+	}
+
+	cfg.OperatorChatID = os.Getenv("OPERATOR_CHAT_ID")
+
+	if envValue := os.Getenv("BMS_MAX_RPS"); envValue != "" {
+		rps, err := strconv.ParseFloat(envValue, 64)
+		if err != nil || !(rps > 0) {
+			return nil, fmt.Errorf("invalid BMS_MAX_RPS %q: must be a positive number", envValue)
+		}
+		cfg.NavigationLimiter = newRateLimiter(rps)
+	}
+	cfg.TelegramTestChatID = os.Getenv("TELEGRAM_TEST_CHAT_ID")
+
+	for name, value := range map[string]*int{
+		"SCRAPER_CONCURRENCY":     &cfg.ScraperConcurrency,
+		"PAGES_PER_MOVIE":         &cfg.PagesPerMovie,
+		"NAVIGATION_ATTEMPTS":     &cfg.NavigationAttempts,
+		"BROWSER_LAUNCH_ATTEMPTS": &cfg.BrowserLaunchAttempts,
+	} {
+		if err := intFromEnv(name, value, 1); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range map[string]*int{
+		"MAX_NOTIFICATIONS_PER_RUN":  &cfg.MaxNotificationsPerRun,
+		"MIN_SHOW_COUNT":             &cfg.MinShowCount,
+		"MOVIE_ERROR_ALERT_AFTER":    &cfg.MovieErrorAlertAfter,
+		"LOG_MAX_SIZE_MB":            &cfg.LogMaxSizeMB,
+		"LOG_MAX_BACKUPS":            &cfg.LogMaxBackups,
+		"LOG_MAX_AGE_DAYS":           &cfg.LogMaxAgeDays,
+		"REPORT_COMPRESS_AFTER_DAYS": &cfg.ReportCompressAfterDays,
+		"REPORT_RETENTION_DAYS":      &cfg.ReportRetentionDays,
+	} {
+		if err := intFromEnv(name, value, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"BROWSER_TIMEOUT":     &cfg.BrowserTimeout,
+		"DOM_STABLE_TIMEOUT":  &cfg.DOMStableTimeout,
+		"CONTAINER_TIMEOUT":   &cfg.ContainerTimeout,
+		"BOOKING_OPEN_POLL":   &cfg.BookingOpenPoll,
+		"BOOKING_OPEN_WINDOW": &cfg.BookingOpenWindow,
+	} {
+		if err := durationFromEnv(name, value, true); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range map[string]*time.Duration{
+		"RUN_TIMEOUT":           &cfg.RunTimeout,
+		"RUN_DEADLINE":          &cfg.RunDeadline,
+		"DELAY_BETWEEN_MOVIES":  &cfg.DelayBetweenMovies,
+		"NOTIFY_COOLDOWN":       &cfg.NotifyCooldown,
+		"SCHEDULE_JITTER":       &cfg.ScheduleJitter,
+		"CATCH_UP_AFTER":        &cfg.CatchUpAfter,
+		"DELIVERY_DEDUP_WINDOW": &cfg.DeliveryDedupWindow,
+		"SHOW_SETTLE_TIMEOUT":   &cfg.ShowSettleTimeout,
+	} {
+		if err := durationFromEnv(name, value, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range map[string]*bool{
+		"DRY_RUN":             &cfg.DryRun,
+		"SUPPRESS_INITIAL":    &cfg.SuppressInitial,
+		"BATCH_NOTIFICATIONS": &cfg.BatchNotifications,
+		"SEND_SUMMARY":        &cfg.SendSummary,
+		"NOTIFY_BOOKING_OPEN": &cfg.NotifyBookingOpen,
+		"NOTIFY_SOLD_OUT":     &cfg.NotifySoldOut,
+		"NOTIFY_NEW_FORMATS":  &cfg.NotifyNewFormats,
+		"JSON_COMPACT":        &cfg.JSONCompact,
+		"BROWSER_HEADLESS":    &cfg.BrowserHeadless,
+		"BROWSER_DEVTOOLS":    &cfg.BrowserDevtools,
+		"SCREENSHOT_ON_ERROR": &cfg.ScreenshotOnError,
+		"POSTER_FROM_PAGE":    &cfg.PosterFromPage,
+		"NETWORK_DEBUG":       &cfg.NetworkDebug,
+	} {
+		if err := boolFromEnv(name, value); err != nil {
+			return nil, err
+		}
+	}
+	cfg.DryRun = cfg.DryRun || dryRun
+
+	var err error
+	cfg.Notifiers, cfg.TelegramEnabled, err = loadNotifiers(cfg.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SendSummary && !cfg.TelegramEnabled {
+		return nil, errors.New("SEND_SUMMARY needs TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID to be set")
+	}
+
+	if urlTemplate := os.Getenv("BOOKING_URL_TEMPLATE"); urlTemplate != "" {
+		if err := validateBookingURLTemplate(urlTemplate); err != nil {
+			return nil, fmt.Errorf("invalid BOOKING_URL_TEMPLATE %q: %v", urlTemplate, err)
+		}
+		cfg.BookingURLTemplate = urlTemplate
+	}
+
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		timezone = "Asia/Kolkata"
+	}
+	cfg.ShowLocation, err = time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIMEZONE %q: %v", timezone, err)
+	}
+
+	// The proxy URL can carry its credentials
+	proxyURL, err := secretFromEnv("BROWSER_PROXY")
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == "" {
+		proxyURL = os.Getenv("HTTP_PROXY_URL")
+	}
+	if proxyURL != "" {
+		cfg.BrowserProxy, err = parseBrowserProxy(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BROWSER_PROXY: %v", err)
+		}
+	}
+
+	for name, value := range map[string]*map[string]string{
+		"BOOKING_HEADERS": &cfg.BookingHeaders,
+		"BOOKING_COOKIES": &cfg.BookingCookies,
+	} {
+		if err := stringMapFromEnv(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set but empty, THEATRE_NAME_SUFFIXES strips none
+	suffixes := defaultTheatreNameSuffixes
+	if envValue, set := os.LookupEnv("THEATRE_NAME_SUFFIXES"); set {
+		suffixes = strings.Split(envValue, ",")
+	}
+	var aliases map[string]string
+	if err := stringMapFromEnv("THEATRE_ALIASES", &aliases); err != nil {
+		return nil, err
+	}
+	cfg.TheatreNames = newTheatreNames(suffixes, aliases)
+
+	cfg.BrowserBinPath = os.Getenv("BROWSER_BIN_PATH")
+	cfg.BrowserCacheDir = os.Getenv("BROWSER_CACHE_DIR")
+
+	if addr := os.Getenv("SERVER_ADDR"); addr != "" {
+		cfg.ServerAddr = addr
+	}
+	cfg.MetricsAddr = os.Getenv("METRICS_ADDR")
+	cfg.PushgatewayURL = os.Getenv("PUSHGATEWAY_URL")
+	if heartbeatURL := os.Getenv("HEARTBEAT_URL"); heartbeatURL != "" {
+		cfg.Heartbeat = newHeartbeat(heartbeatURL)
+	}
+
+	dataDir := os.Getenv("DATA_DIR")
+	cfg.MoviesPath = dataPath("BMS_JSON_PATH", dataDir, moviesFilename)
+	cfg.LogPath = dataPath("BMS_LOG_PATH", dataDir, logFilename)
+	cfg.SQLitePath = dataPath("SQLITE_PATH", dataDir, sqliteFilename)
+	cfg.NotifiedPath = dataPath("NOTIFIED_PATH", dataDir, notifiedFilename)
+	cfg.DeliveredPath = dataPath("DELIVERED_PATH", dataDir, deliveredFilename)
+	cfg.LockPath = dataPath("LOCK_PATH", dataDir, lockFilename)
+	cfg.StoreLockPath = dataPath("STORE_LOCK_PATH", dataDir, storeLockFilename)
+	cfg.ReportDir = os.Getenv("WRITE_REPORT_DIR")
+	cfg.SelfCheckCode = os.Getenv("SELFCHECK_CODE")
+	cfg.SelfCheckSlug = os.Getenv("SELFCHECK_SLUG")
+	cfg.SelfCheckCity = os.Getenv("SELFCHECK_CITY")
+	cfg.SelfCheckDate = os.Getenv("SELFCHECK_DATE")
+	if cfg.SelfCheckDate == "" {
+		cfg.SelfCheckDate = "today"
+	}
+	cfg.ScreenshotDir = dataPath("SCREENSHOT_DIR", dataDir, "screenshots")
+
+	switch backend := os.Getenv("STORE_BACKEND"); backend {
+	case "", "json":
+	case "sqlite":
+		cfg.StoreBackend = backend
+	default:
+		return nil, fmt.Errorf("invalid STORE_BACKEND %q: must be json or sqlite", backend)
+	}
+	cfg.WatchlistGlob = os.Getenv("WATCHLIST_GLOB")
+	if cfg.WatchlistGlob != "" && cfg.StoreBackend == "sqlite" {
+		return nil, errors.New("WATCHLIST_GLOB only works with the json STORE_BACKEND")
+	}
+
+	if shortenerURL := os.Getenv("SHORTENER_API_URL"); shortenerURL != "" {
+		shortenerToken, err := secretFromEnv("SHORTENER_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Shortener = &URLShortener{
+			APIURL: shortenerURL,
+			Token:  shortenerToken,
+			Client: &http.Client{Timeout: time.Second * 5},
+		}
+	}
+
+	quietStart, quietEnd := os.Getenv("QUIET_HOURS_START"), os.Getenv("QUIET_HOURS_END")
+	if quietStart != "" || quietEnd != "" {
+		if quietStart == "" || quietEnd == "" {
+			return nil, errors.New("QUIET_HOURS_START and QUIET_HOURS_END must both be set")
+		}
+		cfg.QuietHours = &QuietHours{Location: cfg.ShowLocation}
+		if cfg.QuietHours.Start, err = parseClock(quietStart); err != nil {
+			return nil, fmt.Errorf("invalid QUIET_HOURS_START %q: %v", quietStart, err)
+		}
+		if cfg.QuietHours.End, err = parseClock(quietEnd); err != nil {
+			return nil, fmt.Errorf("invalid QUIET_HOURS_END %q: %v", quietEnd, err)
+		}
+		if cfg.QuietHours.Start == cfg.QuietHours.End {
+			return nil, errors.New("QUIET_HOURS_START and QUIET_HOURS_END can't be the same time")
+		}
+		switch mode := os.Getenv("QUIET_HOURS_MODE"); mode {
+		case "", "defer":
+		case "drop":
+			cfg.QuietHours.Drop = true
+		default:
+			return nil, fmt.Errorf("invalid QUIET_HOURS_MODE %q: must be defer or drop", mode)
+		}
+	}
+
+	switch onError := os.Getenv("ON_SCRAPE_ERROR"); onError {
+	case "", "skip":
+	case "abort":
+		cfg.AbortOnScrapeError = true
+	default:
+		return nil, fmt.Errorf("invalid ON_SCRAPE_ERROR %q: must be skip or abort", onError)
+	}
+
+	switch strategy := os.Getenv("SCRAPE_STRATEGY"); strategy {
+	case "", scrapeStrategyURL:
+		cfg.ScrapeStrategy = scrapeStrategyURL
+	case scrapeStrategyDateTabs:
+		cfg.ScrapeStrategy = strategy
+	default:
+		return nil, fmt.Errorf("invalid SCRAPE_STRATEGY %q: must be %s or %s", strategy, scrapeStrategyURL, scrapeStrategyDateTabs)
+	}
+
+	switch logFormat := os.Getenv("LOG_FORMAT"); logFormat {
+	case "", "text":
+	case "json":
+		cfg.LogFormat = logFormat
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q: must be text or json", logFormat)
+	}
+
+	switch logLevel := os.Getenv("LOG_LEVEL"); logLevel {
+	case "":
+	case "debug", "info", "warn", "error":
+		cfg.LogLevel, _ = logrus.ParseLevel(logLevel)
+	default:
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", logLevel)
+	}
+
+	return cfg, nil
+}
+
+// notifierNames are the notifiers NOTIFIERS can select, with the settings each
+// one needs.
+var notifierNames = map[string]string{
+	"telegram": "TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID",
+	"discord":  "DISCORD_WEBHOOK_URL",
+	"slack":    "SLACK_WEBHOOK_URL",
+	"whatsapp": "WHATSAPP_TOKEN, WHATSAPP_PHONE_ID and WHATSAPP_TO",
+	"matrix":   "MATRIX_HOMESERVER, MATRIX_TOKEN and MATRIX_ROOM_ID",
+	"ntfy":     "NTFY_TOPIC",
+	"webhook":  "WEBHOOK_URL",
+	"email":    "SMTP_HOST and EMAIL_TO",
+}
+
+// notifierSelection is what NOTIFIERS selected, nil when it isn't set and
+// every configured notifier is used.
+type notifierSelection map[string]bool
+
+// parseNotifierSelection reads the comma-separated notifier names of
+// NOTIFIERS.
+func parseNotifierSelection() (notifierSelection, error) {
+	envValue := os.Getenv("NOTIFIERS")
+	if envValue == "" {
+		return nil, nil
+	}
+	selection := make(notifierSelection)
+	for _, name := range strings.Split(envValue, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := notifierNames[name]; !ok {
+			return nil, fmt.Errorf("invalid NOTIFIERS %q: unknown notifier %q, expected telegram, discord, slack, whatsapp, matrix, ntfy, webhook or email", envValue, name)
+		}
+		selection[name] = true
+	}
+	return selection, nil
+}
+
+// use reports whether the notifier called name is built, given whether any of
+// its settings are set. A notifier NOTIFIERS selects has to be configured.
+func (s notifierSelection) use(name string, configured bool) (bool, error) {
+	if s == nil {
+		return configured, nil
+	}
+	if !s[name] {
+		return false, nil
+	}
+	if !configured {
+		return false, fmt.Errorf("%s is selected in NOTIFIERS but needs %s to be set", name, notifierNames[name])
+	}
+	return true, nil
+}
+
+// loadNotifiers builds a notifier for every destination configured in the
+// environment, or only those NOTIFIERS selects, reporting whether Telegram is
+// one of them. At least one has to be configured. With dryRun they log their
+// messages instead of sending them.
+func loadNotifiers(dryRun bool) ([]Notifier, bool, error) {
+	var notifiers []Notifier
+	selection, err := parseNotifierSelection()
+	if err != nil {
+		return nil, false, err
+	}
+
+	telegramBotToken, err := secretFromEnv("TELEGRAM_BOT_TOKEN")
+	if err != nil {
+		return nil, false, err
+	}
+	telegramChatID := os.Getenv("TELEGRAM_CHAT_ID")
+	telegramEnabled, err := selection.use("telegram", telegramBotToken != "" || telegramChatID != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if telegramEnabled {
+		if telegramBotToken == "" {
+			return nil, false, errors.New("TELEGRAM_BOT_TOKEN environment variable not set")
+		}
+		if telegramChatID == "" {
+			return nil, false, errors.New("TELEGRAM_CHAT_ID environment variable not set")
+		}
+		telegramTimeout := time.Second * 10
+		if err := durationFromEnv("TELEGRAM_HTTP_TIMEOUT", &telegramTimeout, true); err != nil {
+			return nil, false, err
+		}
+
+		telegramParseMode := os.Getenv("TELEGRAM_PARSE_MODE")
+		if telegramParseMode != "" && !slices.Contains(telegramParseModes, telegramParseMode) {
+			return nil, false, fmt.Errorf("invalid TELEGRAM_PARSE_MODE %q: must be MarkdownV2 or HTML", telegramParseMode)
+		}
+
+		// A custom message template, inline or from a file, is checked here
+		// so a broken one stops the run before anything is scraped
+		messageTemplate := os.Getenv("MESSAGE_TEMPLATE")
+		if templateFile := os.Getenv("MESSAGE_TEMPLATE_FILE"); templateFile != "" {
+			if messageTemplate != "" {
+				return nil, false, errors.New("only one of MESSAGE_TEMPLATE and MESSAGE_TEMPLATE_FILE can be set")
+			}
+			templateData, err := os.ReadFile(templateFile)
+			if err != nil {
+				return nil, false, fmt.Errorf("error reading MESSAGE_TEMPLATE_FILE: %v", err)
+			}
+			messageTemplate = string(templateData)
+		}
+		var telegramTemplate *template.Template
+		if messageTemplate != "" {
+			var err error
+			templateParseMode := telegramParseMode
+			if templateParseMode == "" {
+				templateParseMode = "Markdown"
+			}
+			telegramTemplate, err = parseMessageTemplate(messageTemplate, templateParseMode)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid message template: %v", err)
+			}
+		}
+
+		var disableButtons bool
+		if err := boolFromEnv("TELEGRAM_DISABLE_BUTTONS", &disableButtons); err != nil {
+			return nil, false, err
+		}
+
+		notifiers = append(notifiers, &TelegramNotifier{
+			BotToken:       telegramBotToken,
+			ChatID:         telegramChatID,
+			BaseURL:        os.Getenv("TELEGRAM_API_URL"),
+			Client:         &http.Client{Timeout: telegramTimeout},
+			Template:       telegramTemplate,
+			ParseMode:      telegramParseMode,
+			DisableButtons: disableButtons,
+			DryRun:         dryRun,
+		})
+	}
+
+	discordWebhookURL, err := secretFromEnv("DISCORD_WEBHOOK_URL")
+	if err != nil {
+		return nil, false, err
+	}
+	useDiscord, err := selection.use("discord", discordWebhookURL != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useDiscord {
+		notifiers = append(notifiers, &DiscordNotifier{
+			WebhookURL: discordWebhookURL,
+			DryRun:     dryRun,
+		})
+	}
+
+	slackWebhookURL, err := secretFromEnv("SLACK_WEBHOOK_URL")
+	if err != nil {
+		return nil, false, err
+	}
+	useSlack, err := selection.use("slack", slackWebhookURL != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useSlack {
+		notifiers = append(notifiers, &SlackNotifier{
+			WebhookURL: slackWebhookURL,
+			DryRun:     dryRun,
+		})
+	}
+
+	whatsappToken, err := secretFromEnv("WHATSAPP_TOKEN")
+	if err != nil {
+		return nil, false, err
+	}
+	whatsappPhoneID := os.Getenv("WHATSAPP_PHONE_ID")
+	whatsappTo := os.Getenv("WHATSAPP_TO")
+	useWhatsApp, err := selection.use("whatsapp", whatsappToken != "" || whatsappPhoneID != "" || whatsappTo != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useWhatsApp {
+		if whatsappToken == "" || whatsappPhoneID == "" || whatsappTo == "" {
+			return nil, false, errors.New("WHATSAPP_TOKEN, WHATSAPP_PHONE_ID and WHATSAPP_TO must all be set")
+		}
+		notifiers = append(notifiers, &WhatsAppNotifier{
+			Token:   whatsappToken,
+			PhoneID: whatsappPhoneID,
+			To:      whatsappTo,
+			Client:  &http.Client{Timeout: time.Second * 10},
+			DryRun:  dryRun,
+		})
+	}
+
+	matrixHomeserver := os.Getenv("MATRIX_HOMESERVER")
+	matrixToken, err := secretFromEnv("MATRIX_TOKEN")
+	if err != nil {
+		return nil, false, err
+	}
+	matrixRoomID := os.Getenv("MATRIX_ROOM_ID")
+	useMatrix, err := selection.use("matrix", matrixHomeserver != "" || matrixToken != "" || matrixRoomID != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useMatrix {
+		if matrixHomeserver == "" || matrixToken == "" || matrixRoomID == "" {
+			return nil, false, errors.New("MATRIX_HOMESERVER, MATRIX_TOKEN and MATRIX_ROOM_ID must all be set")
+		}
+		notifiers = append(notifiers, &MatrixNotifier{
+			Homeserver: matrixHomeserver,
+			Token:      matrixToken,
+			RoomID:     matrixRoomID,
+			Client:     &http.Client{Timeout: time.Second * 10},
+			DryRun:     dryRun,
+		})
+	}
+
+	ntfyTopic := os.Getenv("NTFY_TOPIC")
+	useNtfy, err := selection.use("ntfy", ntfyTopic != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useNtfy {
+		ntfyServer := os.Getenv("NTFY_SERVER")
+		if ntfyServer == "" {
+			ntfyServer = defaultNtfyServer
+		}
+		ntfyToken, err := secretFromEnv("NTFY_TOKEN")
+		if err != nil {
+			return nil, false, err
+		}
+		ntfyPass, err := secretFromEnv("NTFY_PASS")
+		if err != nil {
+			return nil, false, err
+		}
+		notifiers = append(notifiers, &NtfyNotifier{
+			Server: ntfyServer,
+			Topic:  ntfyTopic,
+			Token:  ntfyToken,
+			User:   os.Getenv("NTFY_USER"),
+			Pass:   ntfyPass,
+			Client: &http.Client{Timeout: time.Second * 10},
+			DryRun: dryRun,
+		})
+	}
+
+	webhookURL, err := secretFromEnv("WEBHOOK_URL")
+	if err != nil {
+		return nil, false, err
+	}
+	useWebhook, err := selection.use("webhook", webhookURL != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useWebhook {
+		// Headers usually carry a token, so they can come from a file too
+		var webhookHeaders map[string]string
+		headersJSON, err := secretFromEnv("WEBHOOK_HEADERS")
+		if err != nil {
+			return nil, false, err
+		}
+		if headersJSON != "" {
+			if err := json.Unmarshal([]byte(headersJSON), &webhookHeaders); err != nil {
+				return nil, false, errors.New("invalid WEBHOOK_HEADERS: must be a JSON object of strings")
+			}
+		}
+
+		var webhookTemplate *template.Template
+		bodyTemplate := os.Getenv("WEBHOOK_TEMPLATE")
+		if templateFile := os.Getenv("WEBHOOK_TEMPLATE_FILE"); templateFile != "" {
+			if bodyTemplate != "" {
+				return nil, false, errors.New("only one of WEBHOOK_TEMPLATE and WEBHOOK_TEMPLATE_FILE can be set")
+			}
+			templateData, err := os.ReadFile(templateFile)
+			if err != nil {
+				return nil, false, fmt.Errorf("error reading WEBHOOK_TEMPLATE_FILE: %v", err)
+			}
+			bodyTemplate = string(templateData)
+		}
+		if bodyTemplate != "" {
+			if webhookTemplate, err = parseWebhookTemplate(bodyTemplate); err != nil {
+				return nil, false, fmt.Errorf("invalid webhook template: %v", err)
+			}
+		}
+
+		webhookTimeout := time.Second * 10
+		if err := durationFromEnv("WEBHOOK_TIMEOUT", &webhookTimeout, true); err != nil {
+			return nil, false, err
+		}
+		notifiers = append(notifiers, &WebhookNotifier{
+			URL:      webhookURL,
+			Headers:  webhookHeaders,
+			Template: webhookTemplate,
+			Client:   &http.Client{Timeout: webhookTimeout},
+			DryRun:   dryRun,
+		})
+	}
+
+	smtpHost := os.Getenv("SMTP_HOST")
+	useEmail, err := selection.use("email", smtpHost != "")
+	if err != nil {
+		return nil, false, err
+	}
+	if useEmail {
+		emailTo := os.Getenv("EMAIL_TO")
+		if emailTo == "" {
+			return nil, false, errors.New("EMAIL_TO environment variable not set")
+		}
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		smtpUser := os.Getenv("SMTP_USER")
+		emailFrom := os.Getenv("EMAIL_FROM")
+		if emailFrom == "" {
+			emailFrom = smtpUser
+		}
+		if emailFrom == "" {
+			return nil, false, errors.New("EMAIL_FROM or SMTP_USER environment variable not set")
+		}
+
+		var recipients []string
+		for _, to := range strings.Split(emailTo, ",") {
+			if to = strings.TrimSpace(to); to != "" {
+				recipients = append(recipients, to)
+			}
+		}
+		smtpPass, err := secretFromEnv("SMTP_PASS")
+		if err != nil {
+			return nil, false, err
+		}
+		notifiers = append(notifiers, &EmailNotifier{
+			Host:   smtpHost,
+			Port:   smtpPort,
+			User:   smtpUser,
+			Pass:   smtpPass,
+			From:   emailFrom,
+			To:     recipients,
+			DryRun: dryRun,
+		})
+	}
+
+	if len(notifiers) == 0 {
+		return nil, false, errors.New("no notifiers configured, set TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID, DISCORD_WEBHOOK_URL, SLACK_WEBHOOK_URL, WHATSAPP_TOKEN, MATRIX_HOMESERVER, NTFY_TOPIC, WEBHOOK_URL or SMTP_HOST")
+	}
+	return notifiers, telegramEnabled, nil
+}
+
+// intFromEnv sets value from the env var name when it is set, which has to be
+// an integer of at least min.
+func intFromEnv(name string, value *int, min int) error {
+	envValue := os.Getenv(name)
+	if envValue == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(envValue)
+	if err != nil || parsed < min {
+		if min == 1 {
+			return fmt.Errorf("invalid %s %q: must be a positive integer", name, envValue)
+		}
+		return fmt.Errorf("invalid %s %q: must be an integer of at least %d", name, envValue, min)
+	}
+	*value = parsed
+	return nil
+}
+
+// durationFromEnv sets value from the env var name when it is set, which has
+// to be a duration like 30s that isn't negative, nor zero when positive is
+// set.
+func durationFromEnv(name string, value *time.Duration, positive bool) error {
+	envValue := os.Getenv(name)
+	if envValue == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(envValue)
+	if err != nil || parsed < 0 || (positive && parsed == 0) {
+		if positive {
+			return fmt.Errorf("invalid %s %q: must be a positive duration like 30s", name, envValue)
+		}
+		return fmt.Errorf("invalid %s %q: must be a duration like 30s", name, envValue)
+	}
+	*value = parsed
+	return nil
+}
+
+// boolFromEnv sets value from the env var name when it is set, which has to
+// be a boolean.
+func boolFromEnv(name string, value *bool) error {
+	envValue := os.Getenv(name)
+	if envValue == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(envValue)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be a boolean", name, envValue)
+	}
+	*value = parsed
+	return nil
+}
+
+// stringMapFromEnv sets value from the env var name when it is set, which has
+// to be a JSON object of strings.
+func stringMapFromEnv(name string, value *map[string]string) error {
+	envValue := os.Getenv(name)
+	if envValue == "" {
+		return nil
+	}
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(envValue), &parsed); err != nil {
+		return fmt.Errorf("invalid %s %q: must be a JSON object of strings", name, envValue)
+	}
+	*value = parsed
+	return nil
+}
+
+// secretFromEnv returns the secret in the env var name, or in the file that
+// name_FILE points to when that is set, as with Docker and Kubernetes secrets.
+// The file takes precedence, and its trailing newline is dropped.
+func secretFromEnv(name string) (string, error) {
+	filename := os.Getenv(name + "_FILE")
+	if filename == "" {
+		return os.Getenv(name), nil
+	}
+	fileData, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s_FILE: %v", name, err)
+	}
+	return strings.TrimRight(string(fileData), "\r\n"), nil
+}
+
+// usePreviewChat turns cfg into a --preview run, sending every alert through
+// Telegram to TELEGRAM_TEST_CHAT_ID in place of the notifiers it would go to.
+func usePreviewChat(cfg *Config) error {
+	if cfg.TelegramTestChatID == "" {
+		return errors.New("--preview needs TELEGRAM_TEST_CHAT_ID to be set")
+	}
+	index := slices.IndexFunc(cfg.Notifiers, func(n Notifier) bool {
+		return n.Name() == "telegram"
+	})
+	if index < 0 {
+		return errors.New("--preview needs TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID to be set")
+	}
+	preview := *cfg.Notifiers[index].(*TelegramNotifier)
+	preview.OnlyChatID = cfg.TelegramTestChatID
+	cfg.Notifiers = []Notifier{&preview}
+	cfg.Preview = true
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notified holds when each theatre was last alerted about, when
+// NOTIFY_COOLDOWN is set.
+var notified *NotificationLog
+
+// deliveries holds when each alert was last delivered, by deliveryKey, when
+// DELIVERY_DEDUP_WINDOW isn't zero.
+var deliveries *NotificationLog
+
+// NotificationLog remembers when each theatre of a movie, city and date was
+// last alerted about as new, or for deliveries when each alert was delivered.
+// It is kept in its own file, apart from the watchlist, so it survives the
+// tracked theatres being cleared, the watchlist being recreated or a run
+// crashing before it saved the watchlist.
+type NotificationLog struct {
+	Filename string
+
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+// loadNotificationLog reads the log in filename, starting an empty one when
+// the file doesn't exist yet.
+func loadNotificationLog(filename string) (*NotificationLog, error) {
+	notificationLog := &NotificationLog{Filename: filename, times: make(map[string]time.Time)}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return notificationLog, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+	if err := json.Unmarshal(data, &notificationLog.times); err != nil {
+		return nil, fmt.Errorf("error unmarshaling %s: %v", filename, err)
+	}
+	return notificationLog, nil
+}
+
+// notificationKey identifies a theatre of a movie, city and date in the log.
+func notificationKey(movie *MovieDetails, city string, date string, theatre string) string {
+	return strings.Join([]string{movie.Code, city, date, theatre}, "|")
+}
+
+// Recent reports whether the theatre was alerted about less than cooldown
+// before now.
+func (l *NotificationLog) Recent(key string, now time.Time, cooldown time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last, ok := l.times[key]
+	return ok && now.Sub(last) < cooldown
+}
+
+// Record notes that the theatre was alerted about at now.
+func (l *NotificationLog) Record(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.times[key] = now
+}
+
+// Save writes the log back to its file, first dropping the entries whose
+// cooldown is over since they no longer hold back any alert.
+func (l *NotificationLog) Save(cooldown time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	for key, last := range l.times {
+		if now.Sub(last) >= cooldown {
+			delete(l.times, key)
+		}
+	}
+	data, err := json.MarshalIndent(l.times, "", "    ")
+	l.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error marshaling notification log: %v", err)
+	}
+	return writeFileAtomic(l.Filename, data)
+}
+
+// recordNotified notes in the notification log, when there is one, that a new
+// theatre was alerted about at now.
+func recordNotified(movie *MovieDetails, city string, date string, theatre string, now time.Time) {
+	if notified != nil {
+		notified.Record(notificationKey(movie, city, date, theatre), now)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// discordEmbedColor is the accent colour of alert embeds (BookMyShow red).
+const discordEmbedColor = 0xF84464
+
+// discordFieldLimit is the longest value Discord accepts in an embed field,
+// in characters.
+const discordFieldLimit = 1024
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+type discordEmbed struct {
+	Title     string              `json:"title"`
+	URL       string              `json:"url,omitempty"`
+	Color     int                 `json:"color"`
+	Fields    []discordEmbedField `json:"fields"`
+	Thumbnail *discordEmbedImage  `json:"thumbnail,omitempty"`
+}
+
+// DiscordNotifier posts alerts as embeds to a Discord channel webhook.
+type DiscordNotifier struct {
+	WebhookURL string
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+func (n *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (n *DiscordNotifier) Notify(msg NotificationPayload) error {
+	fields := []discordEmbedField{
+		{Name: "🎥 Movie", Value: msg.Movie, Inline: true},
+		{Name: "📍 City", Value: msg.City, Inline: true},
+		{Name: "📅 Date", Value: msg.Date, Inline: true},
+	}
+	if len(msg.Theatres) > 0 {
+		var theatres []string
+		for _, theatre := range msg.Theatres {
+			theatres = append(theatres, fmt.Sprintf("%s: %d shows", theatre.Name, theatre.ShowCount))
+		}
+		fields = append(fields, discordEmbedField{Name: "🏟️ Theatres", Value: truncateLines(strings.Join(theatres, "\n"), discordFieldLimit, utf8.RuneCountInString)})
+	} else if msg.Theatre != "" {
+		fields = append(fields, discordEmbedField{Name: "🏟️ Theatre", Value: msg.Theatre})
+	}
+	switch {
+	case len(msg.Theatres) > 0:
+		// A batched alert lists the show count of each theatre above
+	case msg.Kind == NotificationNewShow, msg.Kind == NotificationMoreShows, msg.Kind == NotificationPriceChanged, msg.Kind == NotificationNewFormat:
+		if len(msg.ShowTimes) > 0 {
+			fields = append(fields, discordEmbedField{Name: "🕒 Timings", Value: truncateLines(strings.Join(msg.ShowTimes, ", "), discordFieldLimit, utf8.RuneCountInString)})
+		}
+		shows := strconv.Itoa(msg.ShowCount)
+		if msg.Kind == NotificationMoreShows {
+			shows += fmt.Sprintf(" (was %d)", msg.PreviousShowCount)
+		}
+		fields = append(fields, discordEmbedField{Name: "Shows", Value: shows, Inline: true})
+		if change := msg.priceChange(); change != "" {
+			fields = append(fields, discordEmbedField{Name: "💰 Price", Value: change, Inline: true})
+		}
+		if change := msg.formatChange(); change != "" {
+			fields = append(fields, discordEmbedField{Name: "🆕 Format", Value: change, Inline: true})
+		}
+		if since := msg.availableSince(); since != "" {
+			fields = append(fields, discordEmbedField{Name: "⏳ Listed", Value: since, Inline: true})
+		}
+	}
+	if totals := msg.totals(); totals != "" {
+		fields = append(fields, discordEmbedField{Name: "📊 Overall", Value: totals})
+	}
+	fields = append(fields, discordEmbedField{Name: "🎟️ Book Now", Value: msg.BookingURL})
+
+	embed := discordEmbed{
+		Title:  msg.Kind.Title(),
+		URL:    msg.BookingURL,
+		Color:  discordEmbedColor,
+		Fields: fields,
+	}
+	if msg.PosterURL != "" {
+		embed.Thumbnail = &discordEmbedImage{URL: msg.PosterURL}
+	}
+	payload := map[string]interface{}{
+		"embeds": []discordEmbed{embed},
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), string(payloadJSON))
+		return nil
+	}
+
+	response, err := http.Post(n.WebhookURL, "application/json", bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return fmt.Errorf("error making discord request: %v", err)
+	}
+	defer response.Body.Close()
+
+	// Webhooks answer 204 No Content on success
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("discord API error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
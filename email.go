@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+var emailTemplate = template.Must(template.New("email").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<html>
+<body style="font-family: sans-serif">
+<h2>{{.Kind.Title}}</h2>
+<table cellpadding="4">
+<tr><td>🎥 Movie</td><td><b>{{.Movie}}</b></td></tr>
+<tr><td>📍 City</td><td><b>{{.City}}</b></td></tr>
+<tr><td>📅 Date</td><td><b>{{.Date}}</b></td></tr>
+{{- if .Theatres}}
+{{- range .Theatres}}
+<tr><td>🏟️ {{.Name}}</td><td><b>{{.ShowCount}}</b> shows{{if .ShowTimes}} ({{join .ShowTimes ", "}}){{end}}</td></tr>
+{{- end}}
+{{- else if .Theatre}}
+<tr><td>🏟️ Theatre</td><td><b>{{.Theatre}}</b></td></tr>
+{{- end}}
+{{- if .ListsShows}}
+{{- if .ShowTimes}}
+<tr><td>🕒 Timings</td><td><b>{{join .ShowTimes ", "}}</b></td></tr>
+{{- end}}
+<tr><td>Shows</td><td><b>{{.ShowCount}}</b>{{if .ShowsIncreased}} (was {{.PreviousShowCount}}){{end}}</td></tr>
+{{- end}}
+{{- with .PriceChange}}
+<tr><td>💰 Price</td><td><b>{{.}}</b></td></tr>
+{{- end}}
+{{- with .FormatChange}}
+<tr><td>🆕 Format</td><td><b>{{.}}</b></td></tr>
+{{- end}}
+{{- with .AvailableSince}}
+<tr><td>⏳ Listed</td><td>{{.}}</td></tr>
+{{- end}}
+{{- with .Totals}}
+<tr><td>📊 Overall</td><td>{{.}}</td></tr>
+{{- end}}
+</table>
+<p><a href="{{.BookingURL}}">🎟️ Book Now</a></p>
+</body>
+</html>
+`))
+
+// EmailNotifier sends alerts as HTML emails through an SMTP server.
+type EmailNotifier struct {
+	Host string
+	Port string
+	// User and Pass are optional, the server is used without authentication
+	// when User is empty
+	User string
+	Pass string
+	From string
+	To   []string
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (n *EmailNotifier) Notify(msg NotificationPayload) error {
+	data := struct {
+		NotificationPayload
+		ListsShows     bool
+		ShowsIncreased bool
+		Totals         string
+		PriceChange    string
+		FormatChange   string
+		AvailableSince string
+	}{
+		NotificationPayload: msg,
+		ListsShows:          msg.Kind != NotificationShowsRemoved && msg.Theatre != "" && len(msg.Theatres) == 0,
+		ShowsIncreased:      msg.Kind == NotificationMoreShows,
+		Totals:              msg.totals(),
+		PriceChange:         msg.priceChange(),
+		FormatChange:        msg.formatChange(),
+		AvailableSince:      msg.availableSince(),
+	}
+
+	var body bytes.Buffer
+	if err := emailTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("error rendering email: %v", err)
+	}
+
+	theatre := msg.Theatre
+	if len(msg.Theatres) > 0 {
+		theatre = fmt.Sprintf("%d theatres", len(msg.Theatres))
+	} else if theatre == "" {
+		theatre = fmt.Sprintf("%d theatres", msg.TotalTheatres)
+	}
+	subject := fmt.Sprintf("%s %s at %s, %s on %s", msg.Kind.Title(), msg.Movie, theatre, msg.City, msg.Date)
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
+	message.Write(body.Bytes())
+
+	if n.DryRun {
+		logDryRun(n.Name(), message.String())
+		return nil
+	}
+
+	return n.send(message.Bytes())
+}
+
+// send delivers message over SMTP, using implicit TLS on port 465 and
+// STARTTLS wherever else the server offers it.
+func (n *EmailNotifier) send(message []byte) error {
+	addr := net.JoinHostPort(n.Host, n.Port)
+
+	var client *smtp.Client
+	var err error
+	if n.Port == "465" {
+		var conn *tls.Conn
+		conn, err = tls.Dial("tcp", addr, &tls.Config{ServerName: n.Host})
+		if err == nil {
+			client, err = smtp.NewClient(conn, n.Host)
+		}
+	} else {
+		client, err = smtp.Dial(addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return fmt.Errorf("error starting TLS with SMTP server %s: %w", addr, err)
+		}
+	}
+
+	if n.User != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.User, n.Pass, n.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed for %s: %w", n.User, err)
+		}
+	}
+
+	if err := client.Mail(n.From); err != nil {
+		return fmt.Errorf("error setting sender %s: %w", n.From, err)
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting email data: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("error writing email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+
+	return client.Quit()
+}
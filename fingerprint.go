@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Fingerprints are the user agents and viewport sizes pages pick from, so
+// not every scrape presents the same browser to BookMyShow.
+type Fingerprints struct {
+	UserAgents []string   `json:"user_agents"`
+	Viewports  []Viewport `json:"viewports"`
+}
+
+type Viewport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// defaultFingerprints are used for any list missing from fingerprintsFilename,
+// or for both when the file doesn't exist.
+var defaultFingerprints = Fingerprints{
+	UserAgents: []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36 Edg/137.0.0.0",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.5 Safari/605.1.15",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36",
+	},
+	Viewports: []Viewport{
+		{Width: 1920, Height: 1080},
+		{Width: 1536, Height: 864},
+		{Width: 1440, Height: 900},
+		{Width: 1366, Height: 768},
+		{Width: 1280, Height: 800},
+	},
+}
+
+var fingerprints Fingerprints
+
+// loadFingerprintsFromJSON reads the fingerprints from filename, falling back
+// to defaultFingerprints for any list that is missing or empty.
+func loadFingerprintsFromJSON(filename string) (Fingerprints, error) {
+	fileData, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultFingerprints, nil
+	}
+	if err != nil {
+		return Fingerprints{}, fmt.Errorf("error reading file %s: %v", filename, err)
+	}
+
+	var loaded Fingerprints
+	if err := json.Unmarshal(fileData, &loaded); err != nil {
+		return Fingerprints{}, fmt.Errorf("error unmarshaling JSON: %v", err)
+	}
+
+	if len(loaded.UserAgents) == 0 {
+		loaded.UserAgents = defaultFingerprints.UserAgents
+	}
+	if len(loaded.Viewports) == 0 {
+		loaded.Viewports = defaultFingerprints.Viewports
+	}
+	for _, viewport := range loaded.Viewports {
+		if viewport.Width <= 0 || viewport.Height <= 0 {
+			return Fingerprints{}, fmt.Errorf("viewport %dx%d must have a positive width and height", viewport.Width, viewport.Height)
+		}
+	}
+	return loaded, nil
+}
+
+// applyRandomFingerprint gives page a user agent and viewport picked at random
+// from fingerprints.
+func applyRandomFingerprint(page *rod.Page) error {
+	userAgent := fingerprints.UserAgents[rand.IntN(len(fingerprints.UserAgents))]
+	if err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: userAgent}); err != nil {
+		return fmt.Errorf("error setting user agent: %v", err)
+	}
+
+	viewport := fingerprints.Viewports[rand.IntN(len(fingerprints.Viewports))]
+	err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+		Width:             viewport.Width,
+		Height:            viewport.Height,
+		DeviceScaleFactor: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("error setting viewport: %v", err)
+	}
+	return nil
+}
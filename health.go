@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runHealth is the outcome of the scrape runs so far, reported by /healthz in
+// scheduler mode.
+type runHealth struct {
+	mu sync.Mutex
+	// lastCompleted is when the last run without a fatal error finished
+	lastCompleted time.Time
+	lastDuration  time.Duration
+	lastErrors    int64
+	// lastFatal is the error that ended the last run, empty when it
+	// completed
+	lastFatal string
+}
+
+type healthResponse struct {
+	Status              string    `json:"status"`
+	LastCompletedAt     time.Time `json:"last_completed_at,omitzero"`
+	LastDurationSeconds float64   `json:"last_duration_seconds"`
+	LastRunErrors       int64     `json:"last_run_errors"`
+	Error               string    `json:"error,omitempty"`
+}
+
+var health runHealth
+
+// runScrapeErrors counts the failed booking page scrapes of the current run.
+var runScrapeErrors atomic.Int64
+
+// recordScrapeError counts a failed scrape of movie in both the metrics, by the
+// kind of err, and the current run's health.
+func recordScrapeError(movie string, err error) {
+	scrapeErrorsTotal.WithLabelValues(movie, scrapeErrorType(err)).Inc()
+	runScrapeErrors.Add(1)
+}
+
+// record stores the outcome of a run that took duration, with fatalErr set
+// when it couldn't complete.
+func (h *runHealth) record(duration time.Duration, fatalErr error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastDuration = duration
+	h.lastErrors = runScrapeErrors.Load()
+	h.lastFatal = ""
+	if fatalErr != nil {
+		h.lastFatal = fatalErr.Error()
+		return
+	}
+	h.lastCompleted = time.Now()
+}
+
+func (h *runHealth) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	resp := healthResponse{
+		Status:              "ok",
+		LastCompletedAt:     h.lastCompleted,
+		LastDurationSeconds: h.lastDuration.Seconds(),
+		LastRunErrors:       h.lastErrors,
+		Error:               h.lastFatal,
+	}
+	h.mu.Unlock()
+
+	status := http.StatusOK
+	if resp.LastCompletedAt.IsZero() || resp.Error != "" {
+		resp.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// serveHealth exposes the health of the scheduled runs on addr for liveness
+// and readiness probes.
+func serveHealth(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", health.handleHealthz)
+
+	logger.WithField("addr", addr).Info("Serving health check")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.WithError(err).Error("Error serving health check")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Heartbeat pings a dead man's switch like healthchecks.io or an Uptime Kuma
+// push monitor after every run that completed, so a scraper that stopped
+// running is noticed by the missing pings.
+type Heartbeat struct {
+	URL    string
+	Client *http.Client
+}
+
+// newHeartbeat returns the heartbeat pinging url.
+func newHeartbeat(url string) *Heartbeat {
+	return &Heartbeat{URL: url, Client: &http.Client{Timeout: time.Second * 10}}
+}
+
+// Ping tells the heartbeat service the run completed.
+func (h *Heartbeat) Ping() error {
+	response, err := h.Client.Get(h.URL)
+	if err != nil {
+		return fmt.Errorf("error pinging heartbeat: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("heartbeat error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// RunLock is the lock on a lock file, either the one that keeps two runs from
+// scraping at the same time or the one guarding edits of the watchlist.
+type RunLock struct {
+	file *os.File
+}
+
+// acquireRunLock takes the lock on the file at path, creating it if needed. It
+// returns nil without an error when another process holds the lock. The lock
+// is held until Release, or until the process exits, however it exits.
+func acquireRunLock(path string) (*RunLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file %s: %v", path, err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error locking %s: %v", path, err)
+	}
+
+	// The PID is only there to tell who holds the lock
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &RunLock{file: file}, nil
+}
+
+// acquireStoreLock takes the lock on the store lock file at path, creating it
+// if needed. Unlike acquireRunLock it waits for whoever holds the lock, which
+// a run does from loading the watchlist to its final save, so an edit made
+// meanwhile isn't overwritten by the run's saves. Each call opens the file
+// anew, so goroutines of one process also wait for each other.
+func acquireStoreLock(path string) (*RunLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening store lock file %s: %v", path, err)
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		logger.WithField("lock", path).Info("Waiting for the watchlist to be saved by the run in progress")
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error locking %s: %v", path, err)
+	}
+	return &RunLock{file: file}, nil
+}
+
+// Release gives up the lock. The file is left in place, removing it would let
+// a run waiting on the old file and one creating a new file both take a lock.
+func (l *RunLock) Release() {
+	if l == nil {
+		return
+	}
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+}
@@ -0,0 +1,30 @@
+//go:build !unix
+
+package main
+
+import "sync"
+
+// RunLock is a no-op where flock isn't available, so runs aren't kept from
+// overlapping there. The store lock only guards edits made by one process.
+type RunLock struct {
+	unlock func()
+}
+
+// storeMu stands in for the store lock file within a process.
+var storeMu sync.Mutex
+
+func acquireRunLock(path string) (*RunLock, error) {
+	logger.WithField("path", path).Warn("Run lock isn't supported on this platform, overlapping runs aren't prevented")
+	return &RunLock{}, nil
+}
+
+func acquireStoreLock(path string) (*RunLock, error) {
+	storeMu.Lock()
+	return &RunLock{unlock: storeMu.Unlock}, nil
+}
+
+func (l *RunLock) Release() {
+	if l != nil && l.unlock != nil {
+		l.unlock()
+	}
+}
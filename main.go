@@ -1,279 +1,3395 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"math/rand/v2"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/stealth"
-	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type MovieDetails struct {
-	Name     string   `json:"name"`
-	SlugName string   `json:"slug_name"`
-	Code     string   `json:"code"`
-	City     string   `json:"city"`
-	CityCode string   `json:"city_code"`
-	Date     string   `json:"date"`
-	Found    bool     `json:"found"`
-	Theatres []string `json:"theatres"`
+	Name     string `json:"name"`
+	SlugName string `json:"slug_name"`
+	Code     string `json:"code"`
+	City     string `json:"city"`
+	CityCode string `json:"city_code"`
+	Date     string `json:"date,omitempty"`
+
+	// Cities lists several cities to watch the movie in, instead of City and
+	// CityCode. Each city is tracked separately in CityStates.
+	Cities     []CityDetails                    `json:"cities,omitempty"`
+	CityStates map[string]map[string]*DateState `json:"city_states,omitempty"`
+
+	// Dates lists several show dates to watch in one entry, instead of Date.
+	// Each date is tracked separately in DateStates.
+	Dates      []string              `json:"dates,omitempty"`
+	DateStates map[string]*DateState `json:"date_states,omitempty"`
+
+	// DateState holds the tracking state of Date. For entries using Dates its
+	// Found still skips the whole movie.
+	DateState
+
+	// Enabled pauses watching the movie when explicitly false, keeping its
+	// entry for later. Entries without it are watched.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// ChatID routes this movie's Telegram alerts to a chat other than
+	// TELEGRAM_CHAT_ID.
+	ChatID string `json:"chat_id,omitempty"`
+
+	// PosterURL is the image shown with alerts by notifiers that can, in
+	// place of the one read off the booking page with POSTER_FROM_PAGE.
+	PosterURL string `json:"poster_url,omitempty"`
+
+	// IncludeSoldOut notifies about theatres even when all their shows are
+	// sold out.
+	IncludeSoldOut bool `json:"include_sold_out,omitempty"`
+
+	// MinShowCount is how many shows a new theatre needs before it is
+	// notified about, MIN_SHOW_COUNT when zero. Theatres with fewer are
+	// recorded without an alert until they have enough.
+	MinShowCount int `json:"min_show_count,omitempty"`
+
+	// Silent records the theatres found on the first scrape of the movie
+	// without notifying about them.
+	Silent bool `json:"silent,omitempty"`
+
+	// FormatsFilter restricts notifications to shows in the listed formats
+	// (e.g. "IMAX", "4DX"). An empty filter matches every show.
+	FormatsFilter []string `json:"formats_filter,omitempty"`
+
+	// TheatresFilter restricts tracking to theatres whose name contains one
+	// of the listed names, ignoring case. An empty filter matches every
+	// theatre.
+	TheatresFilter []string `json:"theatres_filter,omitempty"`
+
+	// Languages restricts tracking to shows in the listed languages (e.g.
+	// "Malayalam"). An empty filter matches every show.
+	Languages []string `json:"languages,omitempty"`
+
+	// TimeWindow restricts tracking to shows starting within it, e.g.
+	// evening shows. Without it every show matches.
+	TimeWindow *ShowTimeWindow `json:"time_window,omitempty"`
+
+	// StopOnFirstFind marks the whole entry found once an alert about a new
+	// theatre went out for any of its cities and dates, so it stops being
+	// scraped.
+	StopOnFirstFind bool `json:"stop_on_first_find,omitempty"`
+	// RemoveWhenFound drops the entry from the watchlist once an alert
+	// about a new theatre went out or it was marked found otherwise, for
+	// one-shot alerts
+	RemoveWhenFound bool `json:"remove_when_found,omitempty"`
+	// FoundThreshold marks the whole entry found once this many theatres
+	// are tracked across its cities and dates, a sign the release is fully
+	// open. Zero keeps watching however many there are.
+	FoundThreshold int `json:"found_threshold,omitempty"`
+	// BookingOpensAt is when bookings are announced to open, around which
+	// --interval polls the movie every BOOKING_OPEN_POLL
+	BookingOpensAt time.Time `json:"booking_opens_at,omitzero"`
+
+	// EventType watches a play, event or sports listing instead of a
+	// movie. Those have their own booking URLs and page selectors, entries
+	// without it are movies.
+	EventType string `json:"event_type,omitempty"`
+
+	// ConsecutiveErrors counts the runs in a row in which a city or date of
+	// the movie failed to scrape, and LastError is the latest failure. Both
+	// are cleared by a run without failures.
+	ConsecutiveErrors int    `json:"consecutive_errors,omitempty"`
+	LastError         string `json:"last_error,omitempty"`
+	// LastChecked is when every city and date of the movie was last scraped
+	// without failures
+	LastChecked time.Time `json:"last_checked,omitzero"`
+	// LastScraped is when the movie was last scraped, whether or not that
+	// failed, and LastBookingURL the booking page it last loaded, to open
+	// by hand when checking what the scraper saw
+	LastScraped    time.Time `json:"last_scraped,omitzero"`
+	LastBookingURL string    `json:"last_booking_url,omitempty"`
+
+	// source is the file of a GlobJSONStore the entry was loaded from
+	source string
+}
+
+// CityDetails is a city a movie is watched in, as it appears in booking URLs.
+type CityDetails struct {
+	City     string `json:"city"`
+	CityCode string `json:"city_code"`
+}
+
+// DateState is the tracking state of a single show date of a movie.
+type DateState struct {
+	Found bool `json:"found"`
+	// Expired is set once the date has passed, after which it is no longer
+	// scraped
+	Expired bool `json:"expired,omitempty"`
+	// BookingOpen is set once the booking page listed theatres for the
+	// date, and cleared while it says bookings haven't opened
+	BookingOpen bool `json:"booking_open,omitempty"`
+	// SoldOut is set once every show of the date sold out, and cleared
+	// when one is bookable again, so the alert goes out once per sell-out
+	SoldOut  bool            `json:"sold_out,omitempty"`
+	Theatres []TheatreRecord `json:"theatres"`
+}
+
+// TheatreRecord is the persisted state of a theatre seen for a movie.
+type TheatreRecord struct {
+	Name      string `json:"name"`
+	ShowCount int    `json:"show_count"`
+	// FirstSeen is when the theatre was first recorded, zero for records
+	// from before it was kept, and LastSeen the last scrape that listed it
+	FirstSeen time.Time `json:"first_seen,omitzero"`
+	LastSeen  time.Time `json:"last_seen,omitzero"`
+	// MinPrice is the cheapest ticket of the theatre on the last scrape,
+	// zero when no price could be read
+	MinPrice float64 `json:"min_price,omitempty"`
+	// Formats are every show format the theatre was seen listing, like IMAX
+	// or 4DX. They are nil for records from before they were kept, and
+	// empty for theatres recorded without any.
+	Formats []string `json:"formats,omitzero"`
+	// HeldBack is set for a theatre recorded without an alert because it
+	// had fewer shows than min_show_count, which is announced as new once
+	// it has enough
+	HeldBack bool `json:"held_back,omitempty"`
+}
+
+// Selectors holds the CSS selectors used to read the booking page. Most are
+// styled-component hashes that BookMyShow rotates every few weeks, so they are
+// loaded from selectorsFilename rather than compiled in.
+type Selectors struct {
+	TheatreContainer string `json:"theatre_container"`
+	Theatre          string `json:"theatre"`
+	TheatreName      string `json:"theatre_name"`
+	Show             string `json:"show"`
+
+	// ShowSoldOut and ShowFillingFast are optional selectors matched against
+	// a show element to read its availability. Without them availability is
+	// read from the show's text and disabled state.
+	ShowSoldOut     string `json:"show_sold_out"`
+	ShowFillingFast string `json:"show_filling_fast"`
+
+	// DateTab matches the tabs of the date selector above the theatre
+	// list, clicked through with scrapeStrategyDateTabs
+	DateTab string `json:"date_tab"`
+
+	// Events holds the selectors for entries with an event_type, whose
+	// pages are laid out differently. Missing ones fall back to the movie
+	// selectors.
+	Events *Selectors `json:"events,omitempty"`
+}
+
+type TheatreDetails struct {
+	Name      string        `json:"name"`
+	ShowCount int           `json:"show_count"`
+	Shows     []ShowDetails `json:"shows,omitempty"`
+	// AvailableCount is the number of shows that aren't sold out
+	AvailableCount int `json:"available_count"`
+}
+
+type ShowDetails struct {
+	Time         string           `json:"time"`
+	Format       string           `json:"format"`
+	Price        float64          `json:"price"`
+	Language     string           `json:"language"`
+	Availability ShowAvailability `json:"availability"`
+	// BookingURL links straight to the seat map of the show, when its
+	// element carries a link
+	BookingURL string `json:"booking_url,omitempty"`
+}
+
+// ShowAvailability is how bookable a show is, as marked on its show element.
+type ShowAvailability string
+
+const (
+	ShowAvailable   ShowAvailability = "available"
+	ShowFillingFast ShowAvailability = "filling_fast"
+	ShowSoldOut     ShowAvailability = "sold_out"
+)
+
+// showCountIncrease records a known theatre that now lists more shows than it
+// did on the previous scrape.
+type showCountIncrease struct {
+	theatre       TheatreDetails
+	previousCount int
+	firstSeen     time.Time
+}
+
+// priceChange records a known theatre whose cheapest ticket costs something
+// else than on the previous scrape.
+type priceChange struct {
+	theatre       TheatreDetails
+	previousPrice float64
+	price         float64
+	firstSeen     time.Time
+}
+
+// formatChange records a known theatre that lists shows in formats it was
+// never seen with before.
+type formatChange struct {
+	theatre   TheatreDetails
+	formats   []string
+	firstSeen time.Time
+}
+
+// movieJob carries a movie through the worker pool along with its position in
+// the watchlist so the result can be written back in place.
+type movieJob struct {
+	index int
+	movie MovieDetails
+	// err is the last scrape error of the movie, once it was processed
+	err error
+}
+
+// Exit codes of a single run, documented in the usage text.
+const (
+	exitOK           = 0
+	exitFatal        = 1
+	exitScrapeErrors = 2
+)
+
+const (
+	moviesFilename       = "bms.json"
+	logFilename          = "bms.log"
+	selectorsFilename    = "selectors.json"
+	fingerprintsFilename = "fingerprints.json"
+	sqliteFilename       = "bms.db"
+	notifiedFilename     = "notified.json"
+	deliveredFilename    = "delivered.json"
+	lockFilename         = "bms.lock"
+	storeLockFilename    = "bms.store.lock"
+
+	// defaultBookingURLTemplate is the booking page of a movie for one city
+	// and date, overridable with BOOKING_URL_TEMPLATE
+	defaultBookingURLTemplate = "https://in.bookmyshow.com/movies/{city}/{slug}/buytickets/{code}/{date}"
+
+	// scrapeStrategyURL and scrapeStrategyDateTabs are the values of
+	// SCRAPE_STRATEGY
+	scrapeStrategyURL      = "url"
+	scrapeStrategyDateTabs = "date_tabs"
+
+	// navigationBackoff is the wait before the first navigation retry,
+	// doubled after every further failed attempt
+	navigationBackoff = time.Second * 2
+
+	// maxTheatreScrolls caps how far down the theatre list is scrolled, in
+	// screens, in case it never stops growing
+	maxTheatreScrolls = 50
+	// scrollSettleTime is how long the page has to stay unchanged after a
+	// scroll before the newly rendered theatres are read, waiting at most
+	// scrollSettleTimeout
+	scrollSettleTime    = time.Millisecond * 500
+	scrollSettleTimeout = time.Second * 5
+
+	// innerLookupAttempts bounds how many times the name and shows of a
+	// theatre row are looked up while the row is still rendering, with
+	// innerLookupWait between lookups
+	innerLookupAttempts = 3
+	innerLookupWait     = time.Millisecond * 100
+
+	// browserLaunchBackoff is the wait before the first browser launch
+	// retry, doubled after every further failed attempt
+	browserLaunchBackoff = time.Second * 5
+
+	// headfulInspectTime is how long a page is left open after its scrape
+	// when the browser isn't headless, to inspect its DOM
+	headfulInspectTime = time.Second * 15
+)
+
+// showFormats lists the format badges BookMyShow puts on show elements, most
+// specific first so "IMAX 3D" is reported as IMAX.
+var showFormats = []string{"4DX", "MX4D", "IMAX", "SCREENX", "ICE", "3D", "2D"}
+
+// showLanguages lists the languages BookMyShow labels shows and theatre blocks
+// with.
+var showLanguages = []string{
+	"MALAYALAM", "TAMIL", "TELUGU", "KANNADA", "HINDI", "ENGLISH",
+	"BENGALI", "MARATHI", "PUNJABI", "GUJARATI", "ODIA",
+}
+
+// eventBookingURLTemplates are the listing pages of each event_type other than
+// movies. A listing covers every date and venue, so only the slug and code go
+// into the URL.
+var eventBookingURLTemplates = map[string]string{
+	"event":  "https://in.bookmyshow.com/events/{slug}/{code}",
+	"play":   "https://in.bookmyshow.com/plays/{slug}/{code}",
+	"sports": "https://in.bookmyshow.com/sports/{slug}/{code}",
+}
+
+// defaultSelectors are used for any selector missing from selectorsFilename,
+// or for all of them when the file doesn't exist.
+var defaultSelectors = Selectors{
+	TheatreContainer: ".ReactVirtualized__Grid__innerScrollContainer",
+	Theatre:          ".sc-e8nk8f-3.hStBrg",
+	TheatreName:      ".sc-1qdowf4-0.fbRYHb",
+	Show:             ".sc-1la7659-0.bLMTPx",
+	DateTab:          "a[href*='/buytickets/']",
+}
+
+var showPriceRegex = regexp.MustCompile(`(?:₹|RS\.?)\s*([\d,]+(?:\.\d+)?)`)
+
+var (
+	logger     = logrus.New()
+	selectors  Selectors
+	movieStore Store
+	// storeLockPath is the lock file every edit of movieStore is made under
+	storeLockPath string
+)
+
+// setup creates the data directories and log, and opens the files and store
+// cfg points to.
+func setup(cfg *Config) error {
+	for _, path := range []string{cfg.MoviesPath, cfg.LogPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("error creating directory for %s: %v", path, err)
+		}
+	}
+
+	// Rotate by size so a frequent cron doesn't grow the log without bound
+	logger.SetOutput(&lumberjack.Logger{
+		Filename:   cfg.LogPath,
+		MaxSize:    cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxAge:     cfg.LogMaxAgeDays,
+	})
+	if cfg.LogFormat == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	}
+	logger.SetLevel(cfg.LogLevel)
+
+	var err error
+	switch cfg.StoreBackend {
+	case "sqlite":
+		if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0755); err != nil {
+			return fmt.Errorf("error creating directory for %s: %v", cfg.SQLitePath, err)
+		}
+		movieStore, err = NewSQLiteStore(cfg.SQLitePath)
+		if err != nil {
+			return fmt.Errorf("error opening SQLite store: %v", err)
+		}
+	default:
+		if cfg.WatchlistGlob != "" {
+			movieStore = &GlobJSONStore{Pattern: cfg.WatchlistGlob, Location: cfg.ShowLocation, Compact: cfg.JSONCompact}
+			break
+		}
+		movieStore = &JSONStore{Filename: cfg.MoviesPath, Location: cfg.ShowLocation, Compact: cfg.JSONCompact}
+	}
+	storeLockPath = cfg.StoreLockPath
+
+	if cfg.ScreenshotOnError {
+		if err := os.MkdirAll(cfg.ScreenshotDir, 0755); err != nil {
+			return fmt.Errorf("error creating screenshot directory %s: %v", cfg.ScreenshotDir, err)
+		}
+	}
+
+	if cfg.ReportDir != "" {
+		if err := os.MkdirAll(cfg.ReportDir, 0755); err != nil {
+			return fmt.Errorf("error creating report directory %s: %v", cfg.ReportDir, err)
+		}
+	}
+
+	if cfg.NotifyCooldown > 0 {
+		if err := os.MkdirAll(filepath.Dir(cfg.NotifiedPath), 0755); err != nil {
+			return fmt.Errorf("error creating directory for %s: %v", cfg.NotifiedPath, err)
+		}
+		notified, err = loadNotificationLog(cfg.NotifiedPath)
+		if err != nil {
+			return fmt.Errorf("error loading notification log: %v", err)
+		}
+	}
+
+	if cfg.DeliveryDedupWindow > 0 {
+		if err := os.MkdirAll(filepath.Dir(cfg.DeliveredPath), 0755); err != nil {
+			return fmt.Errorf("error creating directory for %s: %v", cfg.DeliveredPath, err)
+		}
+		deliveries, err = loadNotificationLog(cfg.DeliveredPath)
+		if err != nil {
+			return fmt.Errorf("error loading delivery log: %v", err)
+		}
+	}
+
+	selectors, err = loadSelectorsFromJSON(selectorsFilename)
+	if err != nil {
+		return fmt.Errorf("error loading selectors: %v", err)
+	}
+
+	fingerprints, err = loadFingerprintsFromJSON(fingerprintsFilename)
+	if err != nil {
+		return fmt.Errorf("error loading fingerprints: %v", err)
+	}
+	return nil
+}
+
+func main() {
+	startedAt := time.Now()
+	dotEnv, dotEnvFound, err := readDotEnv()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [list | remove <code> <date> | resolve <slug|url> <city> | test-notify | validate <file>]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(out, "\nExit codes of a single run (without --interval):\n")
+		fmt.Fprintf(out, "  %d  every movie was scraped\n", exitOK)
+		fmt.Fprintf(out, "  %d  the watchlist couldn't be read or saved, or the scraper couldn't start\n", exitFatal)
+		fmt.Fprintf(out, "  %d  one or more movies failed to scrape or were cut off by RUN_DEADLINE, the state of the rest was saved\n", exitScrapeErrors)
+	}
+
+	serve := flag.Bool("serve", false, "serve the watchlist HTTP API on SERVER_ADDR instead of scraping")
+
+	bot := flag.Bool("bot", false, "answer watchlist commands sent to the Telegram bot instead of scraping")
+
+	selfCheck := flag.Bool("selfcheck", false, "scrape the SELFCHECK_CODE movie and exit non-zero unless theatres were found, to catch stale selectors")
+
+	dryRun := flag.Bool("dry-run", false, "scrape and log the notifications that would be sent, without sending them or saving state (or DRY_RUN)")
+
+	preview := flag.Bool("preview", false, "scrape and send every notification to TELEGRAM_TEST_CHAT_ID alone, without saving state")
+
+	interval := flag.Duration("interval", 0, "keep running and scrape again on this interval (e.g. 5m) instead of scraping once")
+
+	verbose := flag.Bool("verbose", false, "log at debug level, overriding LOG_LEVEL")
+
+	onlyMovie := flag.String("movie", "", "scrape only the watched movie with this code, leaving the rest of the watchlist as it is")
+
+	onlyDate := flag.String("date", "", "with --movie, scrape only this date of it (YYYYMMDD, YYYY-MM-DD, today, tomorrow or +Nd)")
+
+	configFile := flag.String("config", "", "read settings from this YAML file, overridden by the environment (default CONFIG_FILE, or "+defaultConfigFile+" if it exists)")
+
+	flag.Parse()
+
+	// The config file is loaded before .env, which can still name it
+	configPath := *configFile
+	if configPath == "" && os.Getenv("CONFIG_FILE") == "" {
+		configPath = dotEnv["CONFIG_FILE"]
+	}
+	configFileFound, err := loadConfigFile(configPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if err := applyDotEnv(dotEnv); err != nil {
+		logger.Fatal(err)
+	}
+	cfg, err := loadConfig(*dryRun)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *verbose {
+		cfg.LogLevel = logrus.DebugLevel
+	}
+	if *onlyDate != "" && *onlyMovie == "" {
+		logger.Fatal("--date needs --movie")
+	}
+	// The scheduler would stop along with a run cut off by RUN_DEADLINE, its
+	// runs are bounded by RUN_TIMEOUT instead
+	if *interval > 0 && cfg.RunDeadline > 0 {
+		logger.Fatal("RUN_DEADLINE can't be used with --interval, bound each run with RUN_TIMEOUT instead")
+	}
+	if *interval > 0 && cfg.ScheduleJitter >= *interval {
+		logger.Fatal("SCHEDULE_JITTER must be shorter than --interval")
+	}
+	if *onlyMovie != "" {
+		cfg.OnlyMovies = []string{*onlyMovie}
+	}
+	if *onlyDate != "" {
+		cfg.OnlyDate = normalizeDate(*onlyDate, time.Now().In(cfg.ShowLocation))
+		if _, err := time.Parse("20060102", cfg.OnlyDate); err != nil {
+			logger.Fatalf("invalid --date %q: must be YYYYMMDD, YYYY-MM-DD, today, tomorrow or +Nd", *onlyDate)
+		}
+	}
+	if *preview {
+		if err := usePreviewChat(cfg); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if err := setup(cfg); err != nil {
+		logger.Fatal(err)
+	}
+	if !dotEnvFound {
+		logger.Info("No .env file found, using the environment only")
+	}
+	if configFileFound {
+		logger.Info("Loaded settings from config file")
+	}
+
+	if flag.NArg() > 0 {
+		handled, err := runCommand(cfg, flag.Args())
+		if !handled {
+			err = fmt.Errorf("unknown command %q, expected list, remove, resolve, test-notify or validate", flag.Arg(0))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitFatal)
+		}
+		return
+	}
+
+	if *serve {
+		if err := runServer(cfg.ServerAddr, cfg.ShowLocation); err != nil {
+			logger.WithError(err).Fatal("Error serving watchlist API")
+		}
+		return
+	}
+
+	if *bot {
+		index := slices.IndexFunc(cfg.Notifiers, func(n Notifier) bool {
+			return n.Name() == "telegram"
+		})
+		if index < 0 {
+			logger.Fatal("--bot needs TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID to be set")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		runBot(ctx, cfg.Notifiers[index].(*TelegramNotifier), cfg.ShowLocation)
+		return
+	}
+
+	if *selfCheck {
+		if err := runSelfCheck(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitFatal)
+		}
+		return
+	}
+
+	// A cron run that starts while the last one is still going would
+	// scrape alongside it and overwrite its save
+	runLock, err := acquireRunLock(cfg.LockPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if runLock == nil {
+		logger.WithField("lock", cfg.LockPath).Info("Previous run still in progress, exiting")
+		return
+	}
+
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(cfg.MetricsAddr)
+	}
+
+	var browser *rod.Browser
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic(r, nil)
+		}
+		if browser != nil {
+			browser.Close()
+		}
+		runLock.Release()
+	}()
+
+	browser, err = launchBrowser(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Error starting browser")
+	}
+
+	// A signal cancels the scrape in progress, which still saves what it
+	// collected before the process exits
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// Past the deadline it cancels the scrape in progress like a signal,
+	// so a stuck run never holds up the next cron one
+	if cfg.RunDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, startedAt.Add(cfg.RunDeadline), ErrRunDeadline)
+		defer cancel()
+	}
+
+	if *interval <= 0 {
+		code := exitOK
+		if err := runScrape(ctx, cfg, browser); errors.Is(err, ErrRunAborted) || errors.Is(err, ErrRunDeadline) {
+			code = exitScrapeErrors
+		} else if err != nil {
+			code = exitFatal
+		} else if runScrapeErrors.Load() > 0 {
+			code = exitScrapeErrors
+		}
+		if code != exitOK {
+			// os.Exit skips the deferred cleanup, the state is already saved
+			browser.Close()
+			runLock.Release()
+			os.Exit(code)
+		}
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"interval": interval.String(),
+		"jitter":   cfg.ScheduleJitter.String(),
+	}).Info("Scraping on an interval")
+	go serveHealth(cfg.ServerAddr)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		// Spread out scrapers that were all started on the hour, so
+		// BookMyShow doesn't see their runs arrive together
+		if cfg.ScheduleJitter > 0 {
+			wait := rand.N(cfg.ScheduleJitter)
+			logger.WithField("wait", wait.String()).Debug("Waiting before the scheduled run")
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				logger.Info("Received shutdown signal, exiting")
+				return
+			}
+		}
+
+		// An aborted run halts the scheduler too, so a broken selector
+		// gets noticed rather than failing every run
+		if err := runScrape(ctx, cfg, browser); errors.Is(err, ErrRunAborted) {
+			logger.Error("Stopping the scheduler after an aborted run")
+			browser.Close()
+			runLock.Release()
+			os.Exit(exitScrapeErrors)
+		}
+
+		// Movies whose bookings are about to open get runs of their own
+		// until the next regular one
+	poll:
+		for {
+			moviesList, err := movieStore.Load()
+			if err != nil {
+				logger.WithError(err).Error("Error reading movies to poll for bookings opening")
+				moviesList = nil
+			}
+			// Without a poll due, the nil channel leaves only the ticker
+			wait, ok := nextBookingOpenPoll(cfg, moviesList, time.Now(), *interval)
+			var pollTimer *time.Timer
+			var pollDue <-chan time.Time
+			if ok {
+				pollTimer = time.NewTimer(wait)
+				pollDue = pollTimer.C
+			}
+
+			select {
+			case <-ctx.Done():
+				logger.Info("Received shutdown signal, exiting")
+				return
+			case <-ticker.C:
+				if pollTimer != nil {
+					pollTimer.Stop()
+				}
+				break poll
+			case <-pollDue:
+			}
+
+			codes := bookingOpenPollCodes(cfg, moviesList, time.Now(), *interval)
+			if len(codes) == 0 {
+				continue
+			}
+			logger.WithField("codes", codes).Info("Polling movies whose bookings are about to open")
+			// A summary of every poll would drown out the regular ones
+			pollCfg := *cfg
+			pollCfg.OnlyMovies = codes
+			pollCfg.SendSummary = false
+			if err := runScrape(ctx, &pollCfg, browser); errors.Is(err, ErrRunAborted) {
+				logger.Error("Stopping the scheduler after an aborted run")
+				browser.Close()
+				runLock.Release()
+				os.Exit(exitScrapeErrors)
+			}
+		}
+	}
+}
+
+// selectedForRun reports whether movie is one OnlyMovies and OnlyDate narrowed
+// the run down to, which every movie is without them.
+func selectedForRun(cfg *Config, movie *MovieDetails) bool {
+	if len(cfg.OnlyMovies) == 0 {
+		return true
+	}
+	return slices.Contains(cfg.OnlyMovies, movie.Code) && (cfg.OnlyDate == "" || slices.Contains(movie.showDates(), cfg.OnlyDate))
+}
+
+// runScrape loads the watchlist, scrapes every movie not yet marked found and
+// saves the updated state. The watchlist is loaded afresh on every call, so
+// movies added between interval runs are picked up. Cancelling ctx, or the run
+// taking longer than cfg.RunTimeout, stops the scrape early, and whatever was
+// collected up to then is still saved, with the movies that weren't started
+// logged as skipped. The returned error is set when the watchlist couldn't be
+// read or saved, and is ErrRunAborted when ON_SCRAPE_ERROR=abort stopped the
+// run, or ErrRunDeadline when RUN_DEADLINE cut it short.
+func runScrape(ctx context.Context, cfg *Config, browser *rod.Browser) error {
+	startTime := time.Now()
+	resetRunCounts()
+	if cfg.ReportDir != "" {
+		currentReport = &RunReport{StartedAt: startTime}
+	}
+	if cfg.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RunTimeout)
+		defer cancel()
+	}
+	// With ON_SCRAPE_ERROR=abort the first scrape error cancels the rest of
+	// the run, which then saves like an interrupted one
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	blockedAlertSent.Store(false)
+
+	// The watchlist stays locked until the final save, so an edit made by
+	// the API, the bot or the CLI meanwhile waits instead of being lost
+	var storeLock *RunLock
+	if !cfg.DryRun && !cfg.Preview {
+		var err error
+		storeLock, err = acquireStoreLock(storeLockPath)
+		if err != nil {
+			logger.WithError(err).Error("Error locking movies")
+			health.record(time.Since(startTime), err)
+			return err
+		}
+	}
+
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		storeLock.Release()
+		logger.WithError(err).Error("Error reading movies")
+		err = fmt.Errorf("error reading movies: %v", err)
+		health.record(time.Since(startTime), err)
+		return err
+	}
+
+	healMovieCodes(ctx, cfg, browser, moviesList)
+
+	notifications := newNotificationQueue(cfg)
+	skipped := scrapeMovies(ctx, cfg, browserPages{browser: browser}, notifications, moviesList, func(result movieJob) {
+		if result.err != nil && cfg.AbortOnScrapeError && ctx.Err() == nil {
+			logger.WithFields(logrus.Fields{
+				"movie": result.movie.Name,
+				"error": result.err,
+			}).Error("Scrape error with ON_SCRAPE_ERROR=abort, stopping the run")
+			abort(ErrRunAborted)
+		}
+
+		// Save as each movie finishes so a crash only loses the movies
+		// still being scraped
+		if !cfg.DryRun && !cfg.Preview {
+			if err := movieStore.Save(moviesList); err != nil {
+				logger.WithFields(logrus.Fields{
+					"movie": result.movie.Name,
+					"error": err,
+				}).Error("Error saving state")
+			}
+		}
+	})
+
+	// The alerts still queued are sent before the state is saved, so the
+	// ones delivered make it into the final save
+	notifications.Flush(moviesList)
+	// Only now that no alert or worker refers to an entry by its index can
+	// entries be removed
+	moviesList = removeFoundMovies(moviesList)
+
+	aborted := errors.Is(context.Cause(ctx), ErrRunAborted)
+	pastDeadline := errors.Is(context.Cause(ctx), ErrRunDeadline)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.WithFields(logrus.Fields{
+			"run_timeout":  cfg.RunTimeout.String(),
+			"run_deadline": cfg.RunDeadline.String(),
+			"skipped":      skipped,
+		}).Warn("Scrape ran out of time, saving progress so far")
+	} else if aborted {
+		logger.WithField("skipped", skipped).Error("Scrape aborted, saving progress so far")
+	} else if ctx.Err() != nil {
+		logger.WithField("skipped", skipped).Info("Scrape interrupted, saving progress so far")
+	}
+
+	var saveErr error
+	if cfg.DryRun {
+		logger.Info("Dry run, not saving state")
+	} else if cfg.Preview {
+		logger.Info("Preview, not saving state")
+	} else if err := movieStore.Save(moviesList); err != nil {
+		logger.WithError(err).Error("Error saving final state")
+		saveErr = fmt.Errorf("error saving final state: %v", err)
+	}
+	storeLock.Release()
+	if notified != nil && !cfg.DryRun && !cfg.Preview {
+		if err := notified.Save(cfg.NotifyCooldown); err != nil {
+			logger.WithError(err).Error("Error saving notification log")
+		}
+	}
+
+	duration := time.Since(startTime)
+	health.record(duration, saveErr)
+	scrapeDurationSeconds.Set(duration.Seconds())
+	if cfg.PushgatewayURL != "" {
+		if err := pushMetrics(cfg.PushgatewayURL); err != nil {
+			logger.WithError(err).Error("Error pushing metrics")
+		}
+	}
+
+	if currentReport != nil {
+		if err := currentReport.write(cfg.ReportDir, duration, ctx.Err() != nil, saveErr); err != nil {
+			logger.WithError(err).Error("Error writing run report")
+		}
+		if err := cleanUpReports(cfg.ReportDir, cfg.ReportCompressAfterDays, cfg.ReportRetentionDays, time.Now()); err != nil {
+			logger.WithError(err).Warn("Error cleaning up old run reports")
+		}
+	}
+
+	if cfg.SendSummary {
+		sendSummary(cfg, duration)
+	}
+
+	// Only a run that got through its watchlist and saved it counts as
+	// alive, and dry runs and previews are someone trying things out
+	if cfg.Heartbeat != nil && saveErr == nil && ctx.Err() == nil && !cfg.DryRun && !cfg.Preview {
+		if err := cfg.Heartbeat.Ping(); err != nil {
+			logger.WithError(err).Error("Error pinging heartbeat")
+		} else {
+			logger.Debug("Pinged heartbeat")
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"duration_in_seconds": duration.Seconds(),
+		"scrape_errors":       runScrapeErrors.Load(),
+	}).Info("cron completed")
+	if saveErr == nil && aborted {
+		return ErrRunAborted
+	}
+	if saveErr == nil && pastDeadline {
+		return ErrRunDeadline
+	}
+	return saveErr
+}
+
+// removeFoundMovies returns moviesList without the found entries that asked to
+// be removed once found.
+func removeFoundMovies(moviesList []MovieDetails) []MovieDetails {
+	return slices.DeleteFunc(moviesList, func(movie MovieDetails) bool {
+		if !movie.Found || !movie.RemoveWhenFound {
+			return false
+		}
+		logger.WithFields(logrus.Fields{
+			"movie": movie.Name,
+			"code":  movie.Code,
+		}).Info("Movie was found, removing it from the watchlist")
+		return true
+	})
+}
+
+// scrapeOrder returns the indices of moviesList in the order a run scrapes
+// them. With cfg.CatchUpAfter set, movies that haven't been checked for that
+// long go first, so after the scraper was down a while the shows that opened
+// in the meantime are caught quickly. Otherwise, and among those movies, the
+// watchlist order is kept.
+func scrapeOrder(cfg *Config, moviesList []MovieDetails, now time.Time) []int {
+	order := make([]int, len(moviesList))
+	for i := range order {
+		order[i] = i
+	}
+	if cfg.CatchUpAfter == 0 {
+		return order
+	}
+
+	stale := make(map[int]bool)
+	for i := range moviesList {
+		if now.Sub(moviesList[i].lastChecked()) > cfg.CatchUpAfter {
+			stale[i] = true
+		}
+	}
+	// Normally nothing is stale and the order stays as it is
+	if len(stale) > 0 {
+		logger.WithFields(logrus.Fields{
+			"movies":    len(stale),
+			"threshold": cfg.CatchUpAfter.String(),
+		}).Info("Catching up on movies that weren't checked for a while first")
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return stale[order[a]] && !stale[order[b]]
+	})
+	return order
+}
+
+// scrapeMovies scrapes the movies of moviesList that are due, in scrapeOrder,
+// with cfg.ScraperConcurrency workers opening their pages from pages and
+// queueing alerts on notifications. Each movie is written back to moviesList
+// as it finishes and then passed to done, both on the calling goroutine. It
+// returns how many due movies weren't started before ctx was cancelled.
+func scrapeMovies(ctx context.Context, cfg *Config, pages PageSource, notifications *NotificationQueue, moviesList []MovieDetails, done func(result movieJob)) int {
+	jobs := make(chan movieJob)
+	results := make(chan movieJob)
+
+	var wg sync.WaitGroup
+	for range cfg.ScraperConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runWorker(ctx, cfg, pages, notifications, jobs, results)
+		}()
+	}
+
+	order := scrapeOrder(cfg, moviesList, time.Now())
+	due := func(movie *MovieDetails) bool {
+		return !movie.Found && !movie.Expired && movie.enabled() && movie.Code != "" && selectedForRun(cfg, movie)
+	}
+	// skipped is only read once results is closed, after the queue set it
+	skipped := 0
+	go func() {
+		queued := 0
+	queue:
+		for n, i := range order {
+			if !due(&moviesList[i]) {
+				continue
+			}
+			if ctx.Err() != nil {
+				for _, i := range order[n:] {
+					if due(&moviesList[i]) {
+						skipped++
+					}
+				}
+				break
+			}
+
+			// Pace the start of each movie rather than waiting for the
+			// previous one to finish, so workers still overlap
+			if queued > 0 && cfg.DelayBetweenMovies > 0 {
+				select {
+				case <-time.After(jitter(cfg.DelayBetweenMovies)):
+				case <-ctx.Done():
+					skipped++
+					continue queue
+				}
+			}
+			queued++
+
+			select {
+			case jobs <- movieJob{index: i, movie: moviesList[i]}:
+			case <-ctx.Done():
+				skipped++
+			}
+		}
+		if queued == 0 && len(cfg.OnlyMovies) > 0 {
+			logger.WithFields(logrus.Fields{
+				"codes": cfg.OnlyMovies,
+				"date":  cfg.OnlyDate,
+			}).Warn("No watched movie matches --movie and --date")
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Workers hand back their own copies, so moviesList is only ever written
+	// from this goroutine
+	for result := range results {
+		moviesList[result.index] = result.movie
+		done(result)
+	}
+	return skipped
+}
+
+// runWorker scrapes the movies it receives on jobs in pages from pages,
+// queueing their alerts on notifications and sending each updated movie to
+// results until jobs is closed.
+func runWorker(ctx context.Context, cfg *Config, pages PageSource, notifications *NotificationQueue, jobs <-chan movieJob, results chan<- movieJob) {
+	for job := range jobs {
+		job.err = processMovie(ctx, cfg, pages, notifications.forMovie(job.index, &job.movie), &job.movie)
+		results <- job
+	}
+}
+
+// processMovie scrapes every city and date watched for a movie, skipping the
+// ones that are already marked found, until ctx is cancelled. Up to
+// cfg.PagesPerMovie of them are scraped at once, each in its own page. With
+// scrapeStrategyDateTabs the dates of a city share one page instead. The
+// returned error is the last of the scrapes that failed, if any did.
+func processMovie(ctx context.Context, cfg *Config, pages PageSource, notifications movieNotifications, movie *MovieDetails) error {
+	moviesCheckedTotal.Inc()
+	runCounts.moviesChecked.Add(1)
+
+	// Event listings cover every date on one page, so they have no date
+	// tabs to click through
+	_, isEvent := eventBookingURLTemplates[movie.EventType]
+	useDateTabs := cfg.ScrapeStrategy == scrapeStrategyDateTabs && !isEvent
+
+	var wg sync.WaitGroup
+	openPages := make(chan struct{}, cfg.PagesPerMovie)
+	var mu sync.Mutex
+	var failures []error
+	scraped := false
+	processDate := func(city CityDetails, date string, state *DateState, scrape func() (ScrapeResult, error)) {
+		err := processShowDate(ctx, cfg, notifications, movie, city, date, state, func() (ScrapeResult, error) {
+			result, err := scrape()
+			if result.BookingURL != "" && ctx.Err() == nil {
+				mu.Lock()
+				scraped = true
+				movie.LastBookingURL = result.BookingURL
+				mu.Unlock()
+			}
+			return result, err
+		})
+		if err != nil {
+			mu.Lock()
+			failures = append(failures, err)
+			mu.Unlock()
+		}
+	}
+cities:
+	for _, city := range movie.showCities() {
+		var dates []string
+		states := make(map[string]*DateState)
+		for _, date := range movie.showDates() {
+			if cfg.OnlyDate != "" && date != cfg.OnlyDate {
+				continue
+			}
+			// Look the state up here rather than in the goroutine, since
+			// it may add to the movie's maps. Each goroutine then only
+			// writes the state of its own city and date.
+			state := movie.dateState(city.City, date)
+			if state.Found || state.Expired {
+				continue
+			}
+			// Valid dates are YYYYMMDD, so they compare as strings
+			if date < time.Now().In(cfg.ShowLocation).Format("20060102") {
+				state.Expired = true
+				logger.WithFields(logrus.Fields{
+					"movie": movie.Name,
+					"city":  city.City,
+					"date":  date,
+				}).Info("Show date has passed, no longer watching it")
+				continue
+			}
+			dates = append(dates, date)
+			states[date] = state
+		}
+
+		if useDateTabs && len(dates) > 1 {
+			select {
+			case openPages <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break cities
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-openPages }()
+				scrapes := scrapeDateTabs(ctx, cfg, pages, movie, city, dates)
+				for _, date := range dates {
+					scrape := scrapes[date]
+					processDate(city, date, states[date], func() (ScrapeResult, error) {
+						return scrape.result, scrape.err
+					})
+				}
+			}()
+			continue
+		}
+
+		for _, date := range dates {
+			select {
+			case openPages <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break cities
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-openPages }()
+				processDate(city, date, states[date], func() (ScrapeResult, error) {
+					return scrapeMovie(ctx, cfg, pages, movie, city, date)
+				})
+			}()
+		}
+	}
+	wg.Wait()
+	if scraped {
+		movie.LastScraped = time.Now()
+	}
+
+	// A run cut short without failures can't tell whether the movie
+	// recovered, so its count is left as it was
+	switch {
+	case len(failures) > 0:
+		movie.ConsecutiveErrors++
+		movie.LastError = failures[len(failures)-1].Error()
+		if cfg.MovieErrorAlertAfter > 0 && movie.ConsecutiveErrors == cfg.MovieErrorAlertAfter {
+			alertMovieFailing(cfg, movie)
+		}
+	case ctx.Err() == nil:
+		movie.ConsecutiveErrors = 0
+		movie.LastError = ""
+		// Checking one date with --date leaves the others as stale
+		if cfg.OnlyDate == "" {
+			movie.LastChecked = time.Now()
+		}
+	}
+	if len(failures) > 0 {
+		return failures[len(failures)-1]
+	}
+	return nil
+}
+
+// processShowDate scrapes the booking page of a movie for one city and date
+// with scrape, recording in state the theatres that changed and queueing
+// alerts on notifications about the ones that are only recorded once their
+// alert is delivered. A panic is logged and contained to this date, so the
+// shared browser stays usable for the rest of the watchlist. The page scrape
+// loads is closed by the func openBookingPage returns with it. The returned
+// error is set when the scrape failed, a cancelled one isn't.
+func processShowDate(ctx context.Context, cfg *Config, notifications movieNotifications, movie *MovieDetails, city CityDetails, date string, state *DateState, scrape func() (ScrapeResult, error)) (scrapeErr error) {
+	report := DateReport{City: city.City, Date: date}
+	defer func() { reportDate(movie, report) }()
+	defer func() {
+		if r := recover(); r != nil {
+			report.Error = fmt.Sprint(r)
+			report.ErrorType = scrapeErrorType(ErrScrapePanic)
+			recordScrapeError(movie.Name, ErrScrapePanic)
+			scrapeErr = fmt.Errorf("%w: %v", ErrScrapePanic, r)
+			logPanic(r, logrus.Fields{"movie": movie.Name, "city": city.City, "date": date})
+		}
+	}()
+
+	result, err := scrape()
+	report.URL = result.BookingURL
+	report.Attempts = result.Attempts
+	report.NoShows = result.NoShows
+	report.Screenshot = result.Screenshot
+	// The run being cancelled or running out of time isn't a scrape error,
+	// and a scrape cut short only saw part of the page, so comparing it
+	// against state would report theatres as removed
+	if ctx.Err() != nil {
+		logger.WithFields(logrus.Fields{
+			"movie": movie.Name,
+			"city":  city.City,
+			"date":  date,
+		}).Info("Scrape cancelled")
+		report.Cancelled = true
+		return nil
+	}
+	if err != nil {
+		report.Error = err.Error()
+		report.ErrorType = scrapeErrorType(err)
+		recordScrapeError(movie.Name, err)
+		fields := logrus.Fields{
+			"movie":      movie.Name,
+			"city":       city.City,
+			"date":       date,
+			"attempts":   result.Attempts,
+			"error":      err,
+			"error_type": scrapeErrorType(err),
+		}
+		if result.Screenshot != "" {
+			fields["screenshot"] = result.Screenshot
+		}
+		switch {
+		case errors.Is(err, ErrBlocked):
+			fields["blocked"] = true
+			fields["url"] = result.BookingURL
+			logger.WithFields(fields).Error("Blocked by a bot challenge instead of the booking page")
+			alertBlocked(cfg, movie, city.City, date, result.BookingURL)
+		case errors.Is(err, ErrNavTimeout):
+			logger.WithFields(fields).Error("Timed out loading booking page")
+		case errors.Is(err, ErrTheatreList):
+			logger.WithFields(fields).Error("Error finding theatre elements")
+		case errors.Is(err, ErrNewPage):
+			logger.WithFields(fields).Error("Error opening browser page")
+		default:
+			logger.WithFields(fields).Error("Error finding theatre container")
+		}
+		return err
+	}
+	bookingURL := result.BookingURL
+	theatreDetails := result.Theatres
+	if result.PosterURL != "" {
+		notifications.posterURL = result.PosterURL
+	}
+
+	switch {
+	case result.BookingNotOpen:
+		state.BookingOpen = false
+	case result.BookingOpen && !state.BookingOpen:
+		// A date already holding theatres was open before BookingOpen was
+		// kept, and the first scrape of a silent movie notifies nothing
+		if !cfg.NotifyBookingOpen || len(state.Theatres) > 0 || movie.Silent || cfg.SuppressInitial {
+			state.BookingOpen = true
+			break
+		}
+		formattedDate, err := formatShowDate(date)
+		if err != nil {
+			state.BookingOpen = true
+			break
+		}
+		shows := 0
+		for _, theatre := range theatreDetails {
+			shows += theatre.ShowCount
+		}
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:          NotificationBookingOpened,
+			Movie:         movie.Name,
+			City:          city.City,
+			Date:          formattedDate,
+			TotalTheatres: len(theatreDetails),
+			TotalShows:    shows,
+			BookingURL:    bookingURL,
+			ChatID:        movie.ChatID,
+		}, 0, func(state *DateState) {
+			state.BookingOpen = true
+		})
+	}
+
+	scrapedAt := time.Now()
+	var newTheatres []TheatreDetails
+	var moreShows []showCountIncrease
+	var priceChanges []priceChange
+	var formatChanges []formatChange
+	scrapedNames := make(map[string]bool)
+	// totalShows counts the shows of every scraped theatre, giving alerts
+	// the overall picture of the date along with len(scrapedNames)
+	totalShows := 0
+	// availableShows counts the shows of every scraped theatre that aren't
+	// sold out
+	availableShows := 0
+	// Index the known theatres once rather than scanning them for every
+	// scraped one. Appending new theatres below leaves the indexes valid.
+	knownTheatres := make(map[string]int, len(state.Theatres))
+	// Theatres recorded without an alert below don't end the first scrape
+	firstScrape := len(state.Theatres) == 0
+	for i, theatre := range state.Theatres {
+		knownTheatres[cfg.TheatreNames.key(theatre.Name)] = i
+	}
+	for _, theatre := range theatreDetails {
+		// BookMyShow sometimes renders a theatre twice while lazy-loading,
+		// so only its first occurrence is compared against state
+		key := cfg.TheatreNames.key(theatre.Name)
+		if theatre.Name == "" || scrapedNames[key] {
+			logger.WithFields(logrus.Fields{
+				"movie":   movie.Name,
+				"city":    city.City,
+				"date":    date,
+				"theatre": theatre.Name,
+			}).Debug("Skipping theatre scraped twice")
+			continue
+		}
+		scrapedNames[key] = true
+		totalShows += theatre.ShowCount
+		availableShows += theatre.AvailableCount
+
+		known, isKnown := knownTheatres[key]
+		var stored *TheatreRecord
+		if isKnown {
+			stored = &state.Theatres[known]
+		}
+		changes := theatre.diff(stored)
+		if !changes.New && changes.Changed() {
+			logger.WithFields(logrus.Fields{
+				"movie":   movie.Name,
+				"city":    city.City,
+				"date":    date,
+				"theatre": theatre.Name,
+				"changed": changes.fields(),
+			}).Debug("Theatre changed since the last scrape")
+		}
+		seen := TheatreSeen{
+			Name:      theatre.Name,
+			Shows:     theatre.ShowCount,
+			FirstSeen: scrapedAt,
+			LastSeen:  scrapedAt,
+		}
+		if stored != nil && !stored.FirstSeen.IsZero() {
+			seen.FirstSeen = stored.FirstSeen
+		}
+		report.TheatresSeen = append(report.TheatresSeen, seen)
+		// Sold out theatres are left as they are until they have a bookable
+		// show, which is when they get notified
+		bookable := theatre.AvailableCount > 0 || movie.IncludeSoldOut
+
+		// New theatres and increases are only written to state once their
+		// notification went out, so a failed one is retried next run
+		if changes.New {
+			if !bookable {
+				logger.WithFields(logrus.Fields{
+					"movie":   movie.Name,
+					"city":    city.City,
+					"date":    date,
+					"theatre": theatre.Name,
+				}).Debug("Skipping new theatre until it has a bookable show")
+				continue
+			}
+			// A theatre alerted about within the cooldown is only missing
+			// from state because it was lost, so it is taken back silently
+			if notified != nil && notified.Recent(notificationKey(movie, city.City, date, theatre.Name), scrapedAt, cfg.NotifyCooldown) {
+				state.Theatres = append(state.Theatres, theatre.record(scrapedAt))
+				logger.WithFields(logrus.Fields{
+					"movie":   movie.Name,
+					"city":    city.City,
+					"date":    date,
+					"theatre": theatre.Name,
+				}).Info("Theatre was alerted about within the cooldown, recording it without notifying")
+				continue
+			}
+			// A theatre with only a preview show or two is tracked, and
+			// announced as new once it has enough
+			if minShows := movie.minShowCount(cfg); theatre.ShowCount < minShows {
+				record := theatre.record(scrapedAt)
+				record.HeldBack = true
+				state.Theatres = append(state.Theatres, record)
+				logger.WithFields(logrus.Fields{
+					"movie":     movie.Name,
+					"city":      city.City,
+					"date":      date,
+					"theatre":   theatre.Name,
+					"shows":     theatre.ShowCount,
+					"min_shows": minShows,
+				}).Info("Recording theatre with too few shows without notifying")
+				continue
+			}
+			newTheatres = append(newTheatres, theatre)
+			continue
+		}
+
+		previous := *stored
+		record := theatre.update(previous, scrapedAt)
+		// Nothing was announced about a held back theatre yet, so it keeps
+		// its latest count silently until it is announced as new
+		if previous.HeldBack {
+			if bookable && theatre.ShowCount >= movie.minShowCount(cfg) {
+				newTheatres = append(newTheatres, theatre)
+				state.Theatres[known].LastSeen = scrapedAt
+				continue
+			}
+			record.HeldBack = true
+			state.Theatres[known] = record
+			continue
+		}
+		// Like prices, new formats are only kept once their alert went out
+		if len(changes.NewFormats) > 0 && bookable && cfg.NotifyNewFormats {
+			formatChanges = append(formatChanges, formatChange{
+				theatre:   theatre,
+				formats:   changes.NewFormats,
+				firstSeen: previous.FirstSeen,
+			})
+			record.Formats = previous.Formats
+		}
+		// The new price is only kept once its alert went out
+		if changes.PriceChanged && bookable {
+			priceChanges = append(priceChanges, priceChange{
+				theatre:       theatre,
+				previousPrice: previous.MinPrice,
+				price:         record.MinPrice,
+				firstSeen:     previous.FirstSeen,
+			})
+			record.MinPrice = previous.MinPrice
+		}
+		if changes.MoreShows {
+			if bookable {
+				moreShows = append(moreShows, showCountIncrease{
+					theatre:       theatre,
+					previousCount: previous.ShowCount,
+					firstSeen:     previous.FirstSeen,
+				})
+			}
+			// The count waits for the alert, but the theatre was still
+			// listed on this scrape, and its formats don't
+			state.Theatres[known].LastSeen = scrapedAt
+			state.Theatres[known].Formats = record.Formats
+			continue
+		}
+		// Always keep the latest count so increases are measured against
+		// the last scrape rather than the first one
+		state.Theatres[known] = record
+	}
+
+	// A scrape that found no theatres at all can't be told apart from stale
+	// selectors, so only treat theatres as removed when others were found
+	var removedTheatres []string
+	if len(scrapedNames) > 0 {
+		for _, theatre := range state.Theatres {
+			if !scrapedNames[cfg.TheatreNames.key(theatre.Name)] && !theatre.HeldBack {
+				removedTheatres = append(removedTheatres, theatre.Name)
+			}
+		}
+		// Held back theatres were never announced, so neither is their
+		// removal
+		state.Theatres = slices.DeleteFunc(state.Theatres, func(t TheatreRecord) bool {
+			return t.HeldBack && !scrapedNames[cfg.TheatreNames.key(t.Name)]
+		})
+	}
+
+	report.Theatres = len(scrapedNames)
+	report.Shows = totalShows
+	for _, theatre := range newTheatres {
+		report.NewTheatres = append(report.NewTheatres, theatre.Name)
+	}
+	for _, increase := range moreShows {
+		report.MoreShows = append(report.MoreShows, increase.theatre.Name)
+	}
+	for _, change := range priceChanges {
+		report.PriceChanges = append(report.PriceChanges, change.theatre.Name)
+	}
+	for _, change := range formatChanges {
+		report.FormatChanges = append(report.FormatChanges, change.theatre.Name)
+	}
+	report.RemovedTheatres = removedTheatres
+
+	soldOut := len(scrapedNames) > 0 && availableShows == 0
+	switch {
+	case !soldOut:
+		state.SoldOut = false
+	case !state.SoldOut:
+		// A date that never had a bookable show tracked didn't sell out, it
+		// opened that way
+		if !cfg.NotifySoldOut || len(state.Theatres) == 0 {
+			state.SoldOut = true
+			break
+		}
+		formattedDate, err := formatShowDate(date)
+		if err != nil {
+			state.SoldOut = true
+			break
+		}
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:          NotificationSoldOut,
+			Movie:         movie.Name,
+			City:          city.City,
+			Date:          formattedDate,
+			TotalTheatres: len(scrapedNames),
+			TotalShows:    totalShows,
+			BookingURL:    bookingURL,
+			ChatID:        movie.ChatID,
+		}, 0, func(state *DateState) {
+			state.SoldOut = true
+		})
+		logger.WithFields(logrus.Fields{
+			"movie":    movie.Name,
+			"city":     city.City,
+			"date":     formattedDate,
+			"theatres": len(scrapedNames),
+			"shows":    totalShows,
+		}).Info("Every show of the date sold out")
+	}
+
+	// The first scrape of a silent movie only records the theatres that were
+	// already showing, so later runs alert about the ones added after it
+	if firstScrape && len(newTheatres) > 0 && (movie.Silent || cfg.SuppressInitial) {
+		for _, theatre := range newTheatres {
+			state.Theatres = append(state.Theatres, theatre.record(scrapedAt))
+		}
+		logger.WithFields(logrus.Fields{
+			"movie":    movie.Name,
+			"city":     city.City,
+			"date":     date,
+			"theatres": len(newTheatres),
+		}).Info("Recorded theatres from first scrape without notifying")
+		return nil
+	}
+
+	if len(newTheatres) == 0 && len(moreShows) == 0 && len(priceChanges) == 0 && len(formatChanges) == 0 && len(removedTheatres) == 0 {
+		return nil
+	}
+
+	formattedDate, err := formatShowDate(date)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"movie": movie.Name,
+			"city":  city.City,
+			"date":  date,
+			"error": err,
+		}).Warn("Skipping notifications for movie with unparseable date")
+		return nil
+	}
+
+	// Batching sends one alert for every theatre that opened at once, which
+	// is delivered, and recorded, all or nothing
+	if cfg.BatchNotifications && len(newTheatres) > 1 {
+		summaries := make([]TheatreSummary, 0, len(newTheatres))
+		names := make([]string, 0, len(newTheatres))
+		for _, theatre := range newTheatres {
+			summaries = append(summaries, TheatreSummary{
+				Name:      theatre.Name,
+				ShowCount: theatre.ShowCount,
+				ShowTimes: theatre.showTimes(),
+			})
+			names = append(names, theatre.Name)
+		}
+
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:          NotificationNewShow,
+			Movie:         movie.Name,
+			City:          city.City,
+			Date:          formattedDate,
+			Theatres:      summaries,
+			TotalTheatres: len(scrapedNames),
+			TotalShows:    totalShows,
+			BookingURL:    bookingURL,
+			ChatID:        movie.ChatID,
+		}, len(newTheatres), func(state *DateState) {
+			for _, theatre := range newTheatres {
+				addTheatreRecord(cfg, state, theatre, scrapedAt)
+				recordNotified(movie, city.City, date, theatre.Name, scrapedAt)
+			}
+		})
+
+		logger.WithFields(logrus.Fields{
+			"movie":          movie.Name,
+			"city":           city.City,
+			"date":           formattedDate,
+			"theatres":       names,
+			"total_theatres": len(scrapedNames),
+			"total_shows":    totalShows,
+			"url":            bookingURL,
+		}).Info("Found new shows")
+	} else {
+		for _, theatre := range newTheatres {
+			notifications.send(city.City, date, NotificationPayload{
+				Kind:          NotificationNewShow,
+				Movie:         movie.Name,
+				City:          city.City,
+				Date:          formattedDate,
+				Theatre:       theatre.Name,
+				ShowCount:     theatre.ShowCount,
+				ShowTimes:     theatre.showTimes(),
+				TotalTheatres: len(scrapedNames),
+				TotalShows:    totalShows,
+				BookingURL:    theatre.bookingURL(bookingURL),
+				ChatID:        movie.ChatID,
+			}, 1, func(state *DateState) {
+				addTheatreRecord(cfg, state, theatre, scrapedAt)
+				recordNotified(movie, city.City, date, theatre.Name, scrapedAt)
+			})
+
+			logger.WithFields(logrus.Fields{
+				"movie":          movie.Name,
+				"city":           city.City,
+				"date":           formattedDate,
+				"theatre":        theatre.Name,
+				"shows":          theatre.ShowCount,
+				"timings":        theatre.showTimes(),
+				"total_theatres": len(scrapedNames),
+				"total_shows":    totalShows,
+				"url":            theatre.bookingURL(bookingURL),
+			}).Info("Found new show")
+		}
+	}
+
+	for _, increase := range moreShows {
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:              NotificationMoreShows,
+			Movie:             movie.Name,
+			City:              city.City,
+			Date:              formattedDate,
+			Theatre:           increase.theatre.Name,
+			ShowCount:         increase.theatre.ShowCount,
+			PreviousShowCount: increase.previousCount,
+			ShowTimes:         increase.theatre.showTimes(),
+			FirstSeen:         increase.firstSeen,
+			TotalTheatres:     len(scrapedNames),
+			TotalShows:        totalShows,
+			BookingURL:        increase.theatre.bookingURL(bookingURL),
+			ChatID:            movie.ChatID,
+		}, 0, func(state *DateState) {
+			known := slices.IndexFunc(state.Theatres, func(t TheatreRecord) bool {
+				return cfg.TheatreNames.key(t.Name) == cfg.TheatreNames.key(increase.theatre.Name)
+			})
+			if known >= 0 {
+				// A price change is recorded by its own alert
+				record := increase.theatre.update(state.Theatres[known], scrapedAt)
+				if state.Theatres[known].MinPrice > 0 {
+					record.MinPrice = state.Theatres[known].MinPrice
+				}
+				// and so are new formats
+				record.Formats = state.Theatres[known].Formats
+				state.Theatres[known] = record
+			}
+		})
+
+		logger.WithFields(logrus.Fields{
+			"movie":          movie.Name,
+			"city":           city.City,
+			"date":           formattedDate,
+			"theatre":        increase.theatre.Name,
+			"shows":          increase.theatre.ShowCount,
+			"previous_shows": increase.previousCount,
+			"timings":        increase.theatre.showTimes(),
+			"total_theatres": len(scrapedNames),
+			"total_shows":    totalShows,
+			"url":            bookingURL,
+		}).Info("More shows added")
+	}
+
+	for _, change := range priceChanges {
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:          NotificationPriceChanged,
+			Movie:         movie.Name,
+			City:          city.City,
+			Date:          formattedDate,
+			Theatre:       change.theatre.Name,
+			ShowCount:     change.theatre.ShowCount,
+			ShowTimes:     change.theatre.showTimes(),
+			PreviousPrice: change.previousPrice,
+			Price:         change.price,
+			FirstSeen:     change.firstSeen,
+			TotalTheatres: len(scrapedNames),
+			TotalShows:    totalShows,
+			BookingURL:    change.theatre.bookingURL(bookingURL),
+			ChatID:        movie.ChatID,
+		}, 0, func(state *DateState) {
+			known := slices.IndexFunc(state.Theatres, func(t TheatreRecord) bool {
+				return cfg.TheatreNames.key(t.Name) == cfg.TheatreNames.key(change.theatre.Name)
+			})
+			if known >= 0 {
+				state.Theatres[known].MinPrice = change.price
+			}
+		})
+
+		logger.WithFields(logrus.Fields{
+			"movie":          movie.Name,
+			"city":           city.City,
+			"date":           formattedDate,
+			"theatre":        change.theatre.Name,
+			"price":          change.price,
+			"previous_price": change.previousPrice,
+			"url":            bookingURL,
+		}).Info("Price changed")
+	}
+
+	for _, change := range formatChanges {
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:          NotificationNewFormat,
+			Movie:         movie.Name,
+			City:          city.City,
+			Date:          formattedDate,
+			Theatre:       change.theatre.Name,
+			ShowCount:     change.theatre.ShowCount,
+			ShowTimes:     change.theatre.showTimes(),
+			NewFormats:    change.formats,
+			FirstSeen:     change.firstSeen,
+			TotalTheatres: len(scrapedNames),
+			TotalShows:    totalShows,
+			BookingURL:    change.theatre.bookingURL(bookingURL),
+			ChatID:        movie.ChatID,
+		}, 0, func(state *DateState) {
+			known := slices.IndexFunc(state.Theatres, func(t TheatreRecord) bool {
+				return cfg.TheatreNames.key(t.Name) == cfg.TheatreNames.key(change.theatre.Name)
+			})
+			if known >= 0 {
+				state.Theatres[known].Formats = mergeFormats(state.Theatres[known].Formats, change.formats)
+			}
+		})
+
+		logger.WithFields(logrus.Fields{
+			"movie":   movie.Name,
+			"city":    city.City,
+			"date":    formattedDate,
+			"theatre": change.theatre.Name,
+			"formats": change.formats,
+			"url":     bookingURL,
+		}).Info("New format available")
+	}
+
+	for _, theatreName := range removedTheatres {
+		notifications.send(city.City, date, NotificationPayload{
+			Kind:       NotificationShowsRemoved,
+			Movie:      movie.Name,
+			City:       city.City,
+			Date:       formattedDate,
+			Theatre:    theatreName,
+			BookingURL: bookingURL,
+			ChatID:     movie.ChatID,
+		}, 0, func(state *DateState) {
+			state.Theatres = slices.DeleteFunc(state.Theatres, func(t TheatreRecord) bool {
+				return cfg.TheatreNames.key(t.Name) == cfg.TheatreNames.key(theatreName)
+			})
+		})
+
+		logger.WithFields(logrus.Fields{
+			"movie":   movie.Name,
+			"city":    city.City,
+			"date":    formattedDate,
+			"theatre": theatreName,
+			"url":     bookingURL,
+		}).Info("Shows removed")
+	}
+	return nil
+}
+
+// theatreScan counts what scrapeTheatres came across, for spotting stale
+// selectors.
+type theatreScan struct {
+	elements     int
+	missingNames int
+	showElements int
+	scrolls      int
+	// theatres counts the distinct theatres read, before the filters
+	theatres int
+}
+
+// ScrapeResult is what scrapeMovie read from the booking page of a movie for
+// one city and date.
+type ScrapeResult struct {
+	BookingURL string
+	// Attempts is how many navigations it took to load the page
+	Attempts int
+	// NoShows is set when the page loaded without a theatre list, which it
+	// has until the date's bookings open. Theatres is then empty.
+	NoShows bool
+	// BookingNotOpen is set when the page said bookings haven't opened yet,
+	// and BookingOpen when it listed theatres
+	BookingNotOpen bool
+	BookingOpen    bool
+	Theatres       []TheatreDetails
+	// Screenshot is the PNG of the page saved when loading it failed, with
+	// SCREENSHOT_ON_ERROR set
+	Screenshot string
+	// PosterURL is the poster the page links for previews, only read with
+	// POSTER_FROM_PAGE for movies without poster_url
+	PosterURL string
+}
+
+// scrapeMovie reads the theatres on the booking page of movie for one city and
+// date in a fresh page from pages, which is closed before it returns. It
+// doesn't look at or change the state of the movie. BookingURL and Attempts
+// of the result are set even when it fails, and the error then wraps one of
+// the scrape errors, or is ctx's error when ctx was cancelled.
+func scrapeMovie(ctx context.Context, cfg *Config, pages PageSource, movie *MovieDetails, city CityDetails, date string) (ScrapeResult, error) {
+	result := ScrapeResult{
+		BookingURL: buildBookingURL(movie.bookingURLTemplate(cfg), city.City, movie.SlugName, movie.Code, date),
+	}
+
+	page, closePage, err := pages.OpenPage(ctx, cfg, movie, city, date, result.BookingURL)
+	defer closePage()
+	if err != nil {
+		return result, err
+	}
+	return scrapeBookingPage(ctx, cfg, page, movie, city, date, result)
+}
+
+// scrapeBookingPage loads result.BookingURL into page and reads its theatres,
+// which is all of scrapeMovie once it has a page.
+func scrapeBookingPage(ctx context.Context, cfg *Config, page PageController, movie *MovieDetails, city CityDetails, date string, result ScrapeResult) (ScrapeResult, error) {
+	theatreContainer, attempts, err := navigateWithRetry(cfg, page, result.BookingURL, movie.pageSelectors().TheatreContainer)
+	result.Attempts = attempts
+	return readBookingPage(ctx, cfg, page, movie, city, date, theatreContainer, err, result)
+}
+
+// dateTabScrape is what scrapeDateTabs read for one date.
+type dateTabScrape struct {
+	result ScrapeResult
+	err    error
+}
+
+// scrapeDateTabs reads the theatres of movie in city for each of dates from
+// one page from pages: the booking page of the first date is loaded, and the
+// others are reached by clicking their tab in the page's date selector. A date
+// whose tab can't be found or clicked is loaded by its own URL with
+// scrapeMovie, as is every other date when the first page doesn't load. The
+// results are like scrapeMovie's, with Attempts counted as one for a date
+// reached by its tab.
+func scrapeDateTabs(ctx context.Context, cfg *Config, pages PageSource, movie *MovieDetails, city CityDetails, dates []string) (scrapes map[string]dateTabScrape) {
+	scrapes = make(map[string]dateTabScrape)
+	// Clicking through the tabs is one scrape as far as recovering goes, so
+	// a panic fails every date it didn't get to
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic(r, logrus.Fields{"movie": movie.Name, "city": city.City})
+			for _, date := range dates {
+				if _, ok := scrapes[date]; !ok {
+					scrapes[date] = dateTabScrape{
+						result: ScrapeResult{BookingURL: buildBookingURL(movie.bookingURLTemplate(cfg), city.City, movie.SlugName, movie.Code, date)},
+						err:    fmt.Errorf("%w: %v", ErrScrapePanic, r),
+					}
+				}
+			}
+		}
+	}()
+
+	pageSelectors := movie.pageSelectors()
+	first := ScrapeResult{
+		BookingURL: buildBookingURL(movie.bookingURLTemplate(cfg), city.City, movie.SlugName, movie.Code, dates[0]),
+	}
+	bookingPage, closePage, err := pages.OpenPage(ctx, cfg, movie, city, dates[0], first.BookingURL)
+	defer closePage()
+	if err != nil {
+		for _, date := range dates {
+			scrapes[date] = dateTabScrape{result: first, err: err}
+		}
+		return scrapes
+	}
+
+	theatreContainer, attempts, err := navigateWithRetry(cfg, bookingPage, first.BookingURL, pageSelectors.TheatreContainer)
+	first.Attempts = attempts
+	// Without the page there are no tabs to click, so the later dates are
+	// loaded by URL, unless the run is over anyway. Neither has the page a
+	// redirect ended up at.
+	loaded := err == nil || errors.Is(err, ErrBookingNotOpen) && !errors.Is(err, ErrRedirected)
+	first, err = readBookingPage(ctx, cfg, bookingPage, movie, city, dates[0], theatreContainer, err, first)
+	scrapes[dates[0]] = dateTabScrape{result: first, err: err}
+
+	for _, date := range dates[1:] {
+		if ctx.Err() != nil {
+			scrapes[date] = dateTabScrape{err: ctx.Err()}
+			continue
+		}
+		if !loaded {
+			result, err := scrapeMovie(ctx, cfg, pages, movie, city, date)
+			scrapes[date] = dateTabScrape{result: result, err: err}
+			continue
+		}
+
+		result := ScrapeResult{
+			BookingURL: buildBookingURL(movie.bookingURLTemplate(cfg), city.City, movie.SlugName, movie.Code, date),
+			Attempts:   1,
+		}
+		theatreContainer, err := openDateTab(cfg, bookingPage, pageSelectors, date)
+		if errors.Is(err, errDateTabNotFound) {
+			logger.WithFields(logrus.Fields{
+				"movie":    movie.Name,
+				"city":     city.City,
+				"date":     date,
+				"selector": pageSelectors.DateTab,
+				"error":    err,
+			}).Info("Date tab not found, loading the date by URL")
+			result, err := scrapeMovie(ctx, cfg, pages, movie, city, date)
+			scrapes[date] = dateTabScrape{result: result, err: err}
+			continue
+		}
+		result, err = readBookingPage(ctx, cfg, bookingPage, movie, city, date, theatreContainer, err, result)
+		scrapes[date] = dateTabScrape{result: result, err: err}
+	}
+	return scrapes
+}
+
+// errDateTabNotFound is returned by openDateTab when the page has no tab for
+// the date, or clicking it failed.
+var errDateTabNotFound = errors.New("date tab not found")
+
+// openDateTab clicks the tab of date in the date selector of page and waits
+// for the theatre container it renders, bounded like a navigation.
+func openDateTab(cfg *Config, page PageController, pageSelectors Selectors, date string) (ElementController, error) {
+	attemptPage, cancelTimeout := page.Timeout(cfg.BrowserTimeout)
+	defer cancelTimeout()
+
+	tabs, err := attemptPage.Elements(pageSelectors.DateTab)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDateTabNotFound, err)
+	}
+	var tab ElementController
+	for _, candidate := range tabs {
+		if dateTabMatches(candidate, date) {
+			tab = candidate
+			break
+		}
+	}
+	if tab == nil {
+		return nil, fmt.Errorf("%w: none of %d tabs is for %s", errDateTabNotFound, len(tabs), date)
+	}
+
+	logger.WithField("date", date).Debug("Clicking date tab")
+	if err := tab.Click(); err != nil {
+		return nil, fmt.Errorf("%w: error clicking tab: %w", errDateTabNotFound, err)
+	}
+
+	// Like after a navigation, the list may keep rendering well after the
+	// click, see loadTheatreContainer
+	stablePage, cancelStableTimeout := attemptPage.Timeout(cfg.DOMStableTimeout)
+	err = stablePage.WaitDOMStable(time.Second, 0)
+	cancelStableTimeout()
+	if err != nil && attemptPage.Context().Err() != nil {
+		return nil, navigationError(fmt.Errorf("error waiting for DOM to stabilize: %w", err))
+	}
+	if isChallengePage(attemptPage) {
+		return nil, ErrBlocked
+	}
+	if bookingNotOpen(attemptPage, pageSelectors.TheatreContainer) {
+		return nil, ErrBookingNotOpen
+	}
+
+	containerPage, cancelContainerTimeout := attemptPage.Timeout(cfg.ContainerTimeout)
+	container, err := containerPage.Element(pageSelectors.TheatreContainer)
+	cancelContainerTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrContainerNotFound, err)
+	}
+	return container, nil
+}
+
+// dateTabMatches reports whether tab is the date selector tab of date, going
+// by its link, which ends in the date like the booking URL, or its id or
+// data-date attribute.
+func dateTabMatches(tab ElementController, date string) bool {
+	if link, err := tab.Link(); err == nil && link != "" {
+		if parsed, err := url.Parse(link); err == nil && strings.HasSuffix(strings.TrimRight(parsed.Path, "/"), "/"+date) {
+			return true
+		}
+	}
+	for _, name := range []string{"id", "data-date"} {
+		if value, err := tab.Attribute(name); err == nil && value != nil && *value == date {
+			return true
+		}
+	}
+	return false
+}
+
+// openBookingPage opens a page of browser for scraping movie in city on date,
+// with a random fingerprint and the booking headers of cfg for bookingURL. The
+// page is bound by ctx, and the returned func closes it, which the caller has
+// to call even when opening failed.
+func openBookingPage(ctx context.Context, cfg *Config, browser *rod.Browser, movie *MovieDetails, city CityDetails, date string, bookingURL string) (*rod.Page, func(), error) {
+	// A browser that can't open a page fails this date rather than
+	// panicking, the other dates and movies may still get one
+	page, err := stealth.Page(browser)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("%w: %w", ErrNewPage, err)
+	}
+	stopNetworkLog := func() {}
+	closePage := func() {
+		stopNetworkLog()
+		if !cfg.BrowserHeadless || cfg.BrowserDevtools {
+			select {
+			case <-time.After(headfulInspectTime):
+			case <-ctx.Done():
+			}
+		}
+		page.Close()
+	}
+	// Only the scrape is cancelled, closePage keeps the original context so
+	// the page is still closed after a shutdown signal
+	scrapePage := page.Context(ctx)
+	if cfg.NetworkDebug {
+		stopNetworkLog = logNetworkResponses(scrapePage, movie, city)
+	}
+
+	if err := applyRandomFingerprint(scrapePage); err != nil {
+		logger.WithFields(logrus.Fields{
+			"movie": movie.Name,
+			"city":  city.City,
+			"date":  date,
+			"error": err,
+		}).Warn("Error applying browser fingerprint, using the default")
+	}
+	// Without them the page may list the theatres of another region, which
+	// would look like every tracked theatre was removed
+	if err := applyBookingHeaders(cfg, scrapePage, bookingURL); err != nil {
+		return scrapePage, closePage, err
+	}
+	return scrapePage, closePage, nil
+}
+
+// readBookingPage reads the theatres in theatreContainer, which loading the
+// booking page of movie for city and date into bookingPage found, or failed
+// to find with err. It fills in result the way scrapeMovie returns it.
+func readBookingPage(ctx context.Context, cfg *Config, bookingPage PageController, movie *MovieDetails, city CityDetails, date string, theatreContainer ElementController, err error, result ScrapeResult) (ScrapeResult, error) {
+	pageSelectors := movie.pageSelectors()
+	attempts := result.Attempts
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	// Nothing to parse until bookings open, the theatres come with them
+	if errors.Is(err, ErrBookingNotOpen) {
+		fields := logrus.Fields{
+			"movie": movie.Name,
+			"city":  city.City,
+			"date":  date,
+		}
+		if errors.Is(err, ErrRedirected) {
+			fields["error"] = err
+			logger.WithFields(fields).Info("Redirected away from the booking page, bookings likely not open")
+		} else {
+			logger.WithFields(fields).Info("Bookings not open yet, skipping the theatre list")
+		}
+		result.NoShows = true
+		result.BookingNotOpen = true
+		return result, nil
+	}
+	if err != nil && cfg.ScreenshotOnError {
+		result.Screenshot = saveErrorScreenshot(cfg, bookingPage, movie, city.City, date)
+	}
+	// BookMyShow leaves the theatre list out until a date has shows, so a
+	// container that never appeared on any attempt means there are none yet
+	if errors.Is(err, ErrContainerNotFound) {
+		logger.WithFields(logrus.Fields{
+			"movie":      movie.Name,
+			"city":       city.City,
+			"date":       date,
+			"attempts":   attempts,
+			"selector":   pageSelectors.TheatreContainer,
+			"screenshot": result.Screenshot,
+		}).Info("Theatre container never appeared, no shows listed yet")
+		result.NoShows = true
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if attempts > 1 {
+		logger.WithFields(logrus.Fields{
+			"movie":    movie.Name,
+			"city":     city.City,
+			"date":     date,
+			"attempts": attempts,
+		}).Info("Found theatre container after retrying")
+	}
+
+	// Bound the theatre lookups below, which wait for elements to appear
+	theatreContainer, cancelTimeout := theatreContainer.Timeout(cfg.BrowserTimeout)
+	defer cancelTimeout()
+
+	theatreDetails, scan, err := scrapeTheatres(cfg, movie, theatreContainer)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", ErrTheatreList, err)
+	}
+	if scan.elements > 0 {
+		theatreListScrolls.Observe(float64(scan.scrolls))
+		fields := logrus.Fields{
+			"movie":    movie.Name,
+			"city":     city.City,
+			"date":     date,
+			"theatres": scan.theatres,
+			"matched":  len(theatreDetails),
+			"scrolls":  scan.scrolls,
+		}
+		// The hint is what tells a list that stopped scrolling early apart
+		// from a short one
+		hint := readTheatreCountHint(bookingPage)
+		if hint > 0 {
+			fields["hinted_theatres"] = hint
+		}
+		logger.WithFields(fields).Debug("Read theatre list")
+		if theatreListShort(scan.theatres, hint) {
+			theatreListShortTotal.WithLabelValues(movie.Name).Inc()
+			logger.WithFields(fields).Warn("Scraped fewer theatres than the page says it lists, scrolling may not have loaded all of them")
+		}
+	}
+
+	// An empty theatre list on a page that loaded is BookMyShow listing no
+	// shows, while a list with content the selector doesn't match more
+	// likely means the selector went stale
+	if scan.elements == 0 && listsNothing(bookingPage, theatreContainer) {
+		logger.WithFields(logrus.Fields{
+			"movie": movie.Name,
+			"city":  city.City,
+			"date":  date,
+		}).Info("No shows currently listed")
+		result.NoShows = true
+	} else if scan.elements == 0 {
+		warnStaleSelector(movie, "theatre", pageSelectors.Theatre)
+	}
+	if scan.elements > 0 && scan.missingNames == scan.elements {
+		warnStaleSelector(movie, "theatre_name", pageSelectors.TheatreName)
+	}
+	if scan.elements > scan.missingNames && scan.showElements == 0 {
+		warnStaleSelector(movie, "show", pageSelectors.Show)
+	}
+
+	result.Theatres = theatreDetails
+	result.BookingOpen = len(theatreDetails) > 0
+	if cfg.PosterFromPage && movie.PosterURL == "" {
+		result.PosterURL = readPosterURL(bookingPage)
+	}
+	return result, nil
+}
+
+// scrapeTheatres parses the theatres in container. The theatre list is a
+// virtualized grid that only renders the rows in view, so it is scrolled
+// down a screen at a time, collecting theatres as they render, until the
+// bottom is reached or a scroll turns up no theatres that weren't seen yet.
+func scrapeTheatres(cfg *Config, movie *MovieDetails, container ElementController) ([]TheatreDetails, theatreScan, error) {
+	var scan theatreScan
+	var theatreDetails []TheatreDetails
+	seenNames := make(map[string]bool)
+
+	for {
+		theatreElements, err := container.Elements(movie.pageSelectors().Theatre)
+		if err != nil {
+			return nil, scan, err
+		}
+
+		logger.WithFields(logrus.Fields{
+			"movie":    movie.Name,
+			"elements": len(theatreElements),
+			"scrolls":  scan.scrolls,
+		}).Debug("Found theatre elements")
+
+		newNames := 0
+		for _, theatreEl := range theatreElements {
+			scan.elements++
+			theatre, ok := parseTheatre(cfg, movie, theatreEl, &scan)
+			if !ok {
+				continue
+			}
+			key := cfg.TheatreNames.key(theatre.Name)
+			if seenNames[key] {
+				continue
+			}
+			seenNames[key] = true
+			scan.theatres++
+			newNames++
+			if !movie.matchesTheatre(theatre.Name) {
+				continue
+			}
+			// With a formats, languages or time filter a theatre only
+			// counts if one of its shows passes it
+			if theatre.ShowCount == 0 && (len(movie.FormatsFilter) > 0 || len(movie.Languages) > 0 || movie.TimeWindow != nil) {
+				continue
+			}
+			theatreDetails = append(theatreDetails, theatre)
+		}
+
+		if len(theatreElements) == 0 || (scan.scrolls > 0 && newNames == 0) || scan.scrolls >= maxTheatreScrolls {
+			return theatreDetails, scan, nil
+		}
+
+		scrolled, err := container.ScrollDown()
+		if err != nil {
+			return nil, scan, fmt.Errorf("error scrolling theatre list: %w", err)
+		}
+		if !scrolled {
+			return theatreDetails, scan, nil
+		}
+		scan.scrolls++
+
+		// Give the grid a moment to render the rows scrolled into view
+		_ = container.WaitStable(scrollSettleTime, scrollSettleTimeout)
+	}
+}
+
+// parseTheatre reads the name and shows of a rendered theatre row, reporting
+// false for rows without a readable name.
+func parseTheatre(cfg *Config, movie *MovieDetails, theatreEl ElementController, scan *theatreScan) (TheatreDetails, bool) {
+	pageSelectors := movie.pageSelectors()
+
+	// Don't wait long for a name that isn't there, the row has rendered by
+	// now, but it may still be filling in
+	var theatreName string
+	var err error
+	retries, ok := retryInnerLookup(func() bool {
+		var theatreNameDiv ElementController
+		theatreNameDiv, err = theatreEl.Element(pageSelectors.TheatreName)
+		if err != nil || theatreNameDiv == nil {
+			return false
+		}
+		theatreName, err = theatreNameDiv.Text()
+		return err == nil && strings.TrimSpace(theatreName) != ""
+	})
+	if !ok {
+		scan.missingNames++
+		logger.WithFields(logrus.Fields{
+			"movie":   movie.Name,
+			"retries": retries,
+			"error":   err,
+		}).Debug("Skipping theatre element without a readable name")
+		return TheatreDetails{}, false
+	}
+	logInnerRetries(movie, theatreName, "name", retries)
+
+	var theatreShowsEl []ElementController
+	retries, _ = retryInnerLookup(func() bool {
+		theatreShowsEl, _ = theatreEl.Elements(pageSelectors.Show)
+		return len(theatreShowsEl) > 0
+	})
+	logInnerRetries(movie, theatreName, "shows", retries)
+	// More showtimes can still be loading into a row that already has some
+	if len(theatreShowsEl) > 0 && cfg.ShowSettleTimeout > 0 {
+		theatreShowsEl = settleShows(movie, theatreName, theatreEl, pageSelectors.Show, theatreShowsEl, cfg.ShowSettleTimeout)
+	}
+	scan.showElements += len(theatreShowsEl)
+
+	// Shows without their own language label take the one of their theatre
+	// block
+	var theatreLanguage string
+	if len(movie.Languages) > 0 {
+		theatreText, _ := theatreEl.Text()
+		theatreLanguage = findLanguage(labelWords(theatreText))
+	}
+
+	var shows []ShowDetails
+	for _, showEl := range theatreShowsEl {
+		showText, _ := showEl.Text()
+		show := parseShow(showText)
+		if show.Language == "" {
+			show.Language = theatreLanguage
+		}
+		if !movie.matchesFormat(show.Format) || !movie.matchesLanguage(show.Language) || !movie.matchesShowTime(show.Time) {
+			continue
+		}
+		show.Availability = readShowAvailability(pageSelectors, showEl, showText)
+		show.BookingURL = readShowLink(showEl)
+		shows = append(shows, show)
+	}
+
+	availableCount := 0
+	for _, show := range shows {
+		if show.Availability != ShowSoldOut {
+			availableCount++
+		}
+	}
+
+	return TheatreDetails{
+		Name:           theatreName,
+		ShowCount:      len(shows),
+		Shows:          shows,
+		AvailableCount: availableCount,
+	}, true
+}
+
+// retryInnerLookup calls lookup until it succeeds, up to innerLookupAttempts
+// times with innerLookupWait in between, for parts of a theatre row that may
+// not have rendered yet when the row is first read. It returns how many
+// retries were needed and whether lookup succeeded in the end.
+func retryInnerLookup(lookup func() bool) (int, bool) {
+	for attempt := 1; ; attempt++ {
+		if lookup() {
+			return attempt - 1, true
+		}
+		if attempt == innerLookupAttempts {
+			return attempt - 1, false
+		}
+		time.Sleep(innerLookupWait)
+	}
+}
+
+// settleShows looks the shows of theatreEl up again, innerLookupWait apart,
+// until their count stays the same between two lookups or timeout runs out,
+// and returns the last ones found.
+func settleShows(movie *MovieDetails, theatre string, theatreEl ElementController, selector string, shows []ElementController, timeout time.Duration) []ElementController {
+	first := len(shows)
+	deadline := time.Now().Add(timeout)
+	settled := false
+	for !settled && time.Now().Before(deadline) {
+		time.Sleep(innerLookupWait)
+		// A row that is re-rendering can come up empty, which isn't its
+		// final count either
+		again, err := theatreEl.Elements(selector)
+		if err != nil || len(again) == 0 {
+			break
+		}
+		settled = len(again) == len(shows)
+		shows = again
+	}
+
+	if !settled || len(shows) != first {
+		logger.WithFields(logrus.Fields{
+			"movie":   movie.Name,
+			"theatre": theatre,
+			"first":   first,
+			"shows":   len(shows),
+			"settled": settled,
+		}).Debug("Show count of theatre changed while it was read")
+	}
+	return shows
+}
+
+// logInnerRetries logs that reading part of the row of theatre took retries,
+// when it took any.
+func logInnerRetries(movie *MovieDetails, theatre string, part string, retries int) {
+	if retries == 0 {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"movie":   movie.Name,
+		"theatre": theatre,
+		"part":    part,
+		"retries": retries,
+	}).Debug("Theatre row was still rendering, read it after retrying")
+}
+
+// navigateWithRetry loads url in page and waits for the theatre container
+// matched by containerSelector, making up to cfg.NavigationAttempts tries with
+// exponential backoff between them. It returns the container along with the
+// number of attempts that were made.
+func navigateWithRetry(cfg *Config, page PageController, url string, containerSelector string) (ElementController, int, error) {
+	attempts := cfg.NavigationAttempts
+	backoff := navigationBackoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		// Retries count against BMS_MAX_RPS like any other navigation
+		if err := cfg.NavigationLimiter.Wait(page.Context()); err != nil {
+			return nil, attempt, err
+		}
+		var container ElementController
+		container, err = loadTheatreContainer(cfg, page, url, containerSelector)
+		if err == nil {
+			return container, attempt, nil
+		}
+
+		// Retrying straight away only gets challenged again, a date that
+		// isn't open yet won't be a second later, and there's no point
+		// retrying once the whole run is cancelled or out of time
+		if page.Context().Err() != nil || errors.Is(err, ErrBlocked) || errors.Is(err, ErrBookingNotOpen) {
+			return nil, attempt, err
+		}
+
+		logger.WithFields(logrus.Fields{
+			"url":     url,
+			"attempt": attempt,
+			"error":   err,
+		}).Warn("Navigation attempt failed")
+
+		if attempt < attempts {
+			select {
+			case <-time.After(backoff):
+			case <-page.Context().Done():
+				return nil, attempt, page.Context().Err()
+			}
+			backoff *= 2
+		}
+	}
+	return nil, attempts, err
+}
+
+// loadTheatreContainer makes a single attempt at navigating page to url and
+// finding the theatre container matched by containerSelector, bounded by its
+// own timeout.
+func loadTheatreContainer(cfg *Config, page PageController, url string, containerSelector string) (ElementController, error) {
+	attemptPage, cancelTimeout := page.Timeout(cfg.BrowserTimeout)
+	defer cancelTimeout()
+
+	logger.WithField("url", url).Debug("Navigating to booking page")
+	if err := attemptPage.Navigate(url); err != nil {
+		return nil, navigationError(fmt.Errorf("error navigating to %s: %w", url, err))
+	}
+
+	// Heavy pages can keep mutating for a long time, so bound the wait
+	// separately from the rest of the attempt. A page that never settles can
+	// still have rendered the theatre list, which is waited for below.
+	stablePage, cancelStableTimeout := attemptPage.Timeout(cfg.DOMStableTimeout)
+	err := stablePage.WaitDOMStable(time.Second, 0)
+	cancelStableTimeout()
+	if err != nil && attemptPage.Context().Err() != nil {
+		return nil, navigationError(fmt.Errorf("error waiting for DOM to stabilize: %w", err))
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url":   url,
+			"error": err,
+		}).Debug("Page didn't stabilize, waiting for the theatre container anyway")
+	}
+
+	// A challenge page never gets a theatre container, so catch it before
+	// waiting out the timeout for one
+	if isChallengePage(attemptPage) {
+		return nil, ErrBlocked
+	}
+	// Neither does a date whose bookings haven't opened, whether the page
+	// says so or sent the browser somewhere else
+	if finalURL, redirected := redirectedFrom(attemptPage, url, containerSelector); redirected {
+		return nil, fmt.Errorf("%w to %s: %w", ErrRedirected, finalURL, ErrBookingNotOpen)
+	}
+	if bookingNotOpen(attemptPage, containerSelector) {
+		return nil, ErrBookingNotOpen
+	}
+
+	// The virtualized list can render well after the DOM first looks stable,
+	// so wait for the container itself. Like every element found on the
+	// page, it isn't bound by this attempt's deadline, which ends on return.
+	containerPage, cancelContainerTimeout := attemptPage.Timeout(cfg.ContainerTimeout)
+	container, err := containerPage.Element(containerSelector)
+	cancelContainerTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrContainerNotFound, err)
+	}
+	return container, nil
+}
+
+// warnStaleSelector logs that a configured selector matched nothing on a page
+// that otherwise loaded, which usually means BookMyShow changed its markup.
+func warnStaleSelector(movie *MovieDetails, name string, selector string) {
+	logger.WithFields(logrus.Fields{
+		"movie":    movie.Name,
+		"selector": name,
+		"value":    selector,
+	}).Warn("Selector matched zero elements on a loaded page, it may be stale")
+}
+
+// listsNothing reports whether container is empty on a page that finished
+// loading far enough to have a title.
+func listsNothing(page PageController, container ElementController) bool {
+	title, _, err := page.Text()
+	if err != nil || strings.TrimSpace(title) == "" {
+		return false
+	}
+	children, err := container.Elements("*")
+	return err == nil && len(children) == 0
+}
+
+// jitter returns a random duration between half and one and a half times d,
+// so requests paced by it don't arrive at a fixed rhythm.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d)
+}
+
+// launchBrowser downloads the browser unless BROWSER_BIN_PATH names one, and
+// launches and connects to it the way cfg says.
+func launchBrowser(cfg *Config) (*rod.Browser, error) {
+	if cfg.BrowserProxy != nil {
+		// Only the host is logged, the URL may carry credentials
+		logger.WithFields(logrus.Fields{
+			"proxy":         cfg.BrowserProxy.Host,
+			"authenticated": cfg.BrowserProxy.User != nil,
+		}).Info("Routing browser traffic through proxy")
+	}
+
+	browserBin := cfg.BrowserBinPath
+	if browserBin != "" {
+		if _, err := os.Stat(browserBin); err != nil {
+			return nil, fmt.Errorf("error finding BROWSER_BIN_PATH: %v", err)
+		}
+		logger.WithField("path", browserBin).Info("Using browser binary from BROWSER_BIN_PATH")
+	} else {
+		err := retryBrowserLaunch("download", cfg.BrowserLaunchAttempts, func() error {
+			browserDownload := launcher.NewBrowser()
+			if cfg.BrowserCacheDir != "" {
+				browserDownload.RootDir = cfg.BrowserCacheDir
+			}
+			var err error
+			browserBin, err = browserDownload.Get()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error initializing browser: %v", err)
+		}
+		logger.WithField("path", browserBin).Info("Using cached browser binary")
+	}
+
+	var browser *rod.Browser
+	err := retryBrowserLaunch("launch", cfg.BrowserLaunchAttempts, func() error {
+		// A launcher only launches once, so every attempt gets its own.
+		// Chrome only opens devtools for visible windows. Passing the binary
+		// keeps the launcher from looking it up and validating it again.
+		browserLauncher := launcher.New().Bin(browserBin).Headless(cfg.BrowserHeadless && !cfg.BrowserDevtools).Devtools(cfg.BrowserDevtools)
+		if cfg.BrowserProxy != nil {
+			browserLauncher = browserLauncher.Proxy(cfg.BrowserProxy.Scheme + "://" + cfg.BrowserProxy.Host)
+		}
+		controlURL, err := browserLauncher.Launch()
+		if err != nil {
+			return fmt.Errorf("error launching browser: %v", err)
+		}
+
+		browser = rod.New().ControlURL(controlURL)
+		if err := browser.Connect(); err != nil {
+			browserLauncher.Kill()
+			browser = nil
+			return fmt.Errorf("error connecting to browser: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BrowserProxy != nil && cfg.BrowserProxy.User != nil {
+		if err := handleProxyAuth(browser, cfg.BrowserProxy); err != nil {
+			browser.Close()
+			return nil, fmt.Errorf("error setting up proxy authentication: %v", err)
+		}
+	}
+	return browser, nil
 }
 
-type TheatreDetails struct {
-	Name      string `json:"name"`
-	ShowCount int    `json:"show_count"`
+// retryBrowserLaunch runs step, downloading or launching the browser, up to
+// attempts times with a growing backoff, returning the last
+// error when every attempt failed.
+func retryBrowserLaunch(step string, attempts int, fn func() error) error {
+	backoff := browserLaunchBackoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		logger.WithFields(logrus.Fields{
+			"step":    step,
+			"attempt": attempt,
+			"error":   err,
+		}).Warn("Browser start attempt failed")
+
+		if attempt < attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %v", attempts, err)
 }
 
-type TelegramButton struct {
-	Text string `json:"text"`
-	URL  string `json:"url"`
+// dataPath returns the path set in the env var name, or filename inside
+// dataDir when it isn't set.
+func dataPath(name string, dataDir string, filename string) string {
+	if path := os.Getenv(name); path != "" {
+		return path
+	}
+	return filepath.Join(dataDir, filename)
 }
 
-type TelegramKeyboard struct {
-	InlineKeyboard [][]TelegramButton `json:"inline_keyboard"`
+// logDryRun logs the message a notifier would have sent had this not been a
+// dry run.
+func logDryRun(notifier string, body string) {
+	logger.WithFields(logrus.Fields{
+		"notifier": notifier,
+		"body":     body,
+	}).Info("Dry run, skipping notification")
 }
 
-const (
-	moviesFilename = "bms.json"
-	logFilename    = "bms.log"
-)
+// logPanic logs a recovered panic value together with the stack trace of the
+// panicking goroutine.
+func logPanic(r any, fields logrus.Fields) {
+	logger.WithFields(fields).WithFields(logrus.Fields{
+		"error": r,
+	}).Error("Recovered from panic")
 
-var (
-	logger           = logrus.New()
-	telegramBotToken string
-	telegramChatID   string
-)
+	stackBuf := make([]byte, 4096)
+	stackSize := runtime.Stack(stackBuf, false)
+	logger.WithFields(fields).WithFields(logrus.Fields{
+		"stack_trace": string(stackBuf[:stackSize]),
+		"goroutines":  runtime.NumGoroutine(),
+	}).Error("Stack trace and goroutine info")
+}
 
-func init() {
-	err := godotenv.Load()
-	if err != nil {
-		logger.Fatalf("Error loading .env file: %v", err)
+// validate checks that the movie has everything needed to build its booking
+// URLs, with every date in YYYYMMDD form.
+func (m *MovieDetails) validate() error {
+	required := []struct {
+		field string
+		value string
+	}{
+		{"name", m.Name},
+		{"slug_name", m.SlugName},
+	}
+	for _, f := range required {
+		if f.value == "" {
+			return fmt.Errorf("%s is required", f.field)
+		}
 	}
 
-	// Load and validate required env vars
-	telegramBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
-	if telegramBotToken == "" {
-		logger.Fatal("TELEGRAM_BOT_TOKEN environment variable not set")
+	if m.City == "" && len(m.Cities) == 0 {
+		return errors.New("city or cities is required")
+	}
+	if m.City != "" && len(m.Cities) > 0 {
+		return errors.New("only one of city and cities can be set")
+	}
+	for _, city := range m.Cities {
+		if city.City == "" {
+			return errors.New("every entry of cities needs a city")
+		}
 	}
 
-	telegramChatID = os.Getenv("TELEGRAM_CHAT_ID")
-	if telegramChatID == "" {
-		logger.Fatal("TELEGRAM_CHAT_ID environment variable not set")
+	if _, ok := eventBookingURLTemplates[m.EventType]; m.EventType != "" && m.EventType != "movie" && !ok {
+		return fmt.Errorf("event_type %q must be movie, event, play or sports", m.EventType)
 	}
 
-	logFile, err := os.OpenFile(logFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		logger.Fatalf("Error opening log file: %v", err)
+	if m.Date == "" && len(m.Dates) == 0 {
+		return errors.New("date or dates is required")
+	}
+	if m.Date != "" && len(m.Dates) > 0 {
+		return errors.New("only one of date and dates can be set")
+	}
+	if m.FoundThreshold < 0 {
+		return errors.New("found_threshold can't be negative")
+	}
+	if m.MinShowCount < 0 {
+		return errors.New("min_show_count can't be negative")
+	}
+	if m.TimeWindow != nil {
+		if err := m.TimeWindow.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, date := range m.showDates() {
+		if len(date) != 8 {
+			return fmt.Errorf("date %q must be in YYYYMMDD or YYYY-MM-DD form, or today, tomorrow or +Nd", date)
+		}
+		if _, err := time.Parse("20060102", date); err != nil {
+			return fmt.Errorf("date %q is not a valid YYYYMMDD date", date)
+		}
 	}
-	logger.SetOutput(logFile)
-	logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
+	return nil
+}
+
+// withoutTheatres returns a copy of the movie with the theatres of every city
+// and date left out, for stores that keep them separately.
+func (m MovieDetails) withoutTheatres() MovieDetails {
+	return m.withTheatres(func([]TheatreRecord) []TheatreRecord { return nil })
+}
+
+// withSortedTheatres returns a copy of the movie with the theatres of every
+// city and date sorted by name, so they are saved in the same order whatever
+// order they were scraped in.
+func (m MovieDetails) withSortedTheatres() MovieDetails {
+	return m.withTheatres(func(theatres []TheatreRecord) []TheatreRecord {
+		sorted := slices.Clone(theatres)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			return sorted[a].Name < sorted[b].Name
+		})
+		return sorted
 	})
+}
 
-	if _, err := launcher.NewBrowser().Get(); err != nil {
-		logger.Fatalf("Error initializing browser: %v", err)
+// withTheatres returns a copy of the movie with the theatres of every city and
+// date replaced by what theatres returns for them. The states are copied too,
+// so the movie itself is left as it was.
+func (m MovieDetails) withTheatres(theatres func([]TheatreRecord) []TheatreRecord) MovieDetails {
+	m.Theatres = theatres(m.Theatres)
+	m.DateStates = statesWithTheatres(m.DateStates, theatres)
+	if m.CityStates != nil {
+		cityStates := make(map[string]map[string]*DateState, len(m.CityStates))
+		for city, states := range m.CityStates {
+			cityStates[city] = statesWithTheatres(states, theatres)
+		}
+		m.CityStates = cityStates
 	}
+	return m
 }
 
-func main() {
-	startTime := time.Now()
-	defer func() {
-		if r := recover(); r != nil {
-			logger.WithFields(logrus.Fields{
-				"error": r,
-			}).Error("Recovered from panic")
+// statesWithTheatres copies states with the theatres of every date replaced
+// by what theatres returns for them.
+func statesWithTheatres(states map[string]*DateState, theatres func([]TheatreRecord) []TheatreRecord) map[string]*DateState {
+	if states == nil {
+		return nil
+	}
+	copies := make(map[string]*DateState, len(states))
+	for date, state := range states {
+		stateCopy := *state
+		stateCopy.Theatres = theatres(state.Theatres)
+		copies[date] = &stateCopy
+	}
+	return copies
+}
 
-			stackBuf := make([]byte, 4096)
-			stackSize := runtime.Stack(stackBuf, false)
-			logger.WithFields(logrus.Fields{
-				"stack_trace": string(stackBuf[:stackSize]),
-				"goroutines":  runtime.NumGoroutine(),
-			}).Error("Stack trace and goroutine info")
+// trackedTheatres returns how many theatres are tracked across every city and
+// date of the movie.
+func (m *MovieDetails) trackedTheatres() int {
+	count := 0
+	for _, state := range m.states() {
+		count += len(state.Theatres)
+	}
+	return count
+}
+
+// states returns the tracking state of every city and date of the movie that
+// has one.
+func (m *MovieDetails) states() []*DateState {
+	states := []*DateState{&m.DateState}
+	for _, state := range m.DateStates {
+		states = append(states, state)
+	}
+	for _, cityStates := range m.CityStates {
+		for _, state := range cityStates {
+			states = append(states, state)
 		}
-	}()
+	}
+	return states
+}
 
-	moviesList, err := loadMoviesFromJSON(moviesFilename)
-	if err != nil {
-		logger.WithError(err).Fatal("Error reading movies")
+// lastChecked returns when the movie was last known to be checked: its
+// LastChecked, or for entries from before it was kept the last time any of its
+// theatres was seen. It is zero for movies never checked.
+func (m *MovieDetails) lastChecked() time.Time {
+	checked := m.LastChecked
+	for _, state := range m.states() {
+		for _, theatre := range state.Theatres {
+			if theatre.LastSeen.After(checked) {
+				checked = theatre.LastSeen
+			}
+		}
 	}
+	return checked
+}
 
-	for i := range moviesList {
-		if moviesList[i].Found {
-			continue
+// enabled reports whether the movie is being watched, which it is unless
+// Enabled is explicitly false.
+func (m *MovieDetails) enabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// minShowCount returns how many shows a theatre needs to be notified about,
+// MIN_SHOW_COUNT unless the entry sets its own.
+func (m *MovieDetails) minShowCount(cfg *Config) int {
+	if m.MinShowCount > 0 {
+		return m.MinShowCount
+	}
+	return cfg.MinShowCount
+}
+
+// bookingURLTemplate returns the booking URL template for the entry's
+// event_type, BOOKING_URL_TEMPLATE for movies.
+func (m *MovieDetails) bookingURLTemplate(cfg *Config) string {
+	if template, ok := eventBookingURLTemplates[m.EventType]; ok {
+		return template
+	}
+	return cfg.BookingURLTemplate
+}
+
+// pageSelectors returns the selectors that read the booking page of the
+// entry's event_type.
+func (m *MovieDetails) pageSelectors() Selectors {
+	if _, ok := eventBookingURLTemplates[m.EventType]; ok && selectors.Events != nil {
+		return *selectors.Events
+	}
+	return selectors
+}
+
+// showCities returns every city the movie is watched in.
+func (m *MovieDetails) showCities() []CityDetails {
+	if len(m.Cities) > 0 {
+		return m.Cities
+	}
+	return []CityDetails{{City: m.City, CityCode: m.CityCode}}
+}
+
+// showDates returns every date watched for the movie.
+func (m *MovieDetails) showDates() []string {
+	if len(m.Dates) > 0 {
+		return m.Dates
+	}
+	return []string{m.Date}
+}
+
+// dateState returns the tracking state of one of the movie's dates in a city,
+// creating it for entries using Cities or Dates when that city and date
+// haven't been scraped before.
+func (m *MovieDetails) dateState(city string, date string) *DateState {
+	states := m.DateStates
+	if len(m.Cities) > 0 {
+		if m.CityStates == nil {
+			m.CityStates = make(map[string]map[string]*DateState)
+		}
+		if m.CityStates[city] == nil {
+			m.CityStates[city] = make(map[string]*DateState)
 		}
+		states = m.CityStates[city]
+	} else if len(m.Dates) == 0 {
+		return &m.DateState
+	} else if states == nil {
+		m.DateStates = make(map[string]*DateState)
+		states = m.DateStates
+	}
 
-		browser := rod.New().Timeout(time.Minute * 1)
-		if err := browser.Connect(); err != nil {
-			logger.WithError(err).Fatal("Error connecting to browser")
+	state, ok := states[date]
+	if !ok {
+		state = &DateState{Theatres: []TheatreRecord{}}
+		states[date] = state
+	}
+	return state
+}
+
+// matchesShowTime reports whether a show at showTime passes the movie's time
+// window.
+func (m MovieDetails) matchesShowTime(showTime string) bool {
+	return m.TimeWindow == nil || m.TimeWindow.contains(showTime)
+}
+
+// matchesFormat reports whether a show in the given format passes the movie's
+// formats filter.
+func (m MovieDetails) matchesFormat(format string) bool {
+	if len(m.FormatsFilter) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(m.FormatsFilter, func(f string) bool {
+		return strings.EqualFold(f, format)
+	})
+}
+
+// matchesTheatre reports whether a theatre passes the movie's theatres
+// filter.
+func (m MovieDetails) matchesTheatre(name string) bool {
+	if len(m.TheatresFilter) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	return slices.ContainsFunc(m.TheatresFilter, func(t string) bool {
+		return strings.Contains(name, strings.ToLower(t))
+	})
+}
+
+// matchesLanguage reports whether a show in the given language passes the
+// movie's languages filter.
+func (m MovieDetails) matchesLanguage(language string) bool {
+	if len(m.Languages) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(m.Languages, func(l string) bool {
+		return strings.EqualFold(l, language)
+	})
+}
+
+// TheatreChanges are what a fresh scrape of a theatre changed about its record
+// in state. Every alert about a scraped theatre is decided from them.
+type TheatreChanges struct {
+	// New is set for a theatre without a record, which leaves the rest
+	// unset
+	New bool
+	// MoreShows and FewerShows are set when the theatre lists more or
+	// fewer shows than recorded
+	MoreShows  bool
+	FewerShows bool
+	// PriceChanged is set when its cheapest ticket costs something else
+	// than recorded
+	PriceChanged bool
+	// NewFormats are the formats of its shows it wasn't recorded with
+	NewFormats []string
+}
+
+// Changed reports whether anything about the theatre changed.
+func (c TheatreChanges) Changed() bool {
+	return c.New || c.MoreShows || c.FewerShows || c.PriceChanged || len(c.NewFormats) > 0
+}
+
+// fields names what changed, for logging.
+func (c TheatreChanges) fields() []string {
+	var fields []string
+	if c.New {
+		fields = append(fields, "new")
+	}
+	if c.MoreShows || c.FewerShows {
+		fields = append(fields, "show_count")
+	}
+	if c.PriceChanged {
+		fields = append(fields, "min_price")
+	}
+	if len(c.NewFormats) > 0 {
+		fields = append(fields, "formats")
+	}
+	return fields
+}
+
+// diff compares the scraped theatre against previous, its record in state,
+// which is nil when it has none.
+func (t TheatreDetails) diff(previous *TheatreRecord) TheatreChanges {
+	if previous == nil {
+		return TheatreChanges{New: true}
+	}
+	var changes TheatreChanges
+	// Records migrated from the legacy format were never seen with a show
+	// count, so there is nothing to compare against yet
+	if !previous.LastSeen.IsZero() {
+		changes.MoreShows = t.ShowCount > previous.ShowCount
+		changes.FewerShows = t.ShowCount < previous.ShowCount
+	}
+	// Theatres recorded before prices were read have none to compare
+	// against, and neither do scrapes without prices
+	if price := t.minPrice(); previous.MinPrice > 0 && price > 0 {
+		changes.PriceChanged = price != previous.MinPrice
+	}
+	// Theatres recorded before formats were kept have none to compare
+	// against, so their formats are only taken in
+	if previous.Formats != nil {
+		for _, format := range t.formats() {
+			if !slices.Contains(previous.Formats, format) {
+				changes.NewFormats = append(changes.NewFormats, format)
+			}
 		}
-		defer browser.Close()
+	}
+	return changes
+}
 
-		page := stealth.MustPage(browser)
-		defer page.Close()
+// record converts the scraped theatre into its persisted form.
+func (t TheatreDetails) record(seen time.Time) TheatreRecord {
+	return TheatreRecord{
+		Name:      t.Name,
+		ShowCount: t.ShowCount,
+		FirstSeen: seen,
+		LastSeen:  seen,
+		MinPrice:  t.minPrice(),
+		Formats:   t.formats(),
+	}
+}
 
-		bookingURL := fmt.Sprintf("https://in.bookmyshow.com/movies/%s/%s/buytickets/%s/%s",
-			moviesList[i].City, moviesList[i].SlugName, moviesList[i].Code, moviesList[i].Date)
+// update returns the record of a theatre tracked as previous that was seen
+// again at seen, keeping when it was first seen and every format it was seen
+// with. Records that never had that time get seen instead, the earliest one
+// known.
+func (t TheatreDetails) update(previous TheatreRecord, seen time.Time) TheatreRecord {
+	record := t.record(seen)
+	if !previous.FirstSeen.IsZero() {
+		record.FirstSeen = previous.FirstSeen
+	}
+	record.Formats = mergeFormats(previous.Formats, record.Formats)
+	return record
+}
 
+// addTheatreRecord records theatre, announced as new at seen, in state. A
+// theatre that was held back already has a record, which is replaced.
+func addTheatreRecord(cfg *Config, state *DateState, theatre TheatreDetails, seen time.Time) {
+	known := slices.IndexFunc(state.Theatres, func(t TheatreRecord) bool {
+		return cfg.TheatreNames.key(t.Name) == cfg.TheatreNames.key(theatre.Name)
+	})
+	if known < 0 {
+		state.Theatres = append(state.Theatres, theatre.record(seen))
+		return
+	}
+	state.Theatres[known] = theatre.update(state.Theatres[known], seen)
+}
 
-		page.MustNavigate(bookingURL).MustWaitDOMStable()
+// formats returns the formats the shows of the theatre are in, sorted, leaving
+// out shows without one. It is never nil, so a record of a theatre without
+// formats still tells it was recorded with them.
+func (t TheatreDetails) formats() []string {
+	formats := []string{}
+	for _, show := range t.Shows {
+		if show.Format != "" && !slices.Contains(formats, show.Format) {
+			formats = append(formats, show.Format)
+		}
+	}
+	slices.Sort(formats)
+	return formats
+}
 
-		theatreContainer, err := page.Element(".ReactVirtualized__Grid__innerScrollContainer")
-		if err != nil {
-			logger.WithFields(logrus.Fields{
-				"movie": moviesList[i].Name,
-				"error": err,
-			}).Error("Error finding theatre container")
+// mergeFormats returns the formats of a and b, sorted and without duplicates.
+// Like formats, it is never nil.
+func mergeFormats(a []string, b []string) []string {
+	formats := append([]string{}, a...)
+	formats = append(formats, b...)
+	slices.Sort(formats)
+	return slices.Compact(formats)
+}
+
+// minPrice returns the cheapest ticket of the shows of the theatre, or zero
+// when none of them had a price.
+func (t TheatreDetails) minPrice() float64 {
+	var price float64
+	for _, show := range t.Shows {
+		if show.Price > 0 && (price == 0 || show.Price < price) {
+			price = show.Price
+		}
+	}
+	return price
+}
+
+// bookingURLPlaceholders are the fields every booking URL template has to
+// reference.
+var bookingURLPlaceholders = []string{"{city}", "{slug}", "{code}", "{date}"}
+
+// validateBookingURLTemplate checks that template references every booking
+// URL field and is an absolute URL.
+func validateBookingURLTemplate(template string) error {
+	var missing []string
+	for _, placeholder := range bookingURLPlaceholders {
+		if !strings.Contains(template, placeholder) {
+			missing = append(missing, placeholder)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	parsed, err := url.Parse(buildBookingURL(template, "city", "slug", "code", "20060102"))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute URL like %s", defaultBookingURLTemplate)
+	}
+	return nil
+}
+
+// buildBookingURL fills the placeholders of template in with the booking page
+// of a movie for one city and date.
+func buildBookingURL(template string, city string, slug string, code string, date string) string {
+	return strings.NewReplacer(
+		"{city}", city,
+		"{slug}", slug,
+		"{code}", code,
+		"{date}", date,
+	).Replace(template)
+}
+
+// bookingURL returns the seat map link of the theatre's first bookable show,
+// or fallback when none of its shows has one.
+func (t TheatreDetails) bookingURL(fallback string) string {
+	for _, show := range t.Shows {
+		if show.BookingURL != "" && show.Availability != ShowSoldOut {
+			return show.BookingURL
+		}
+	}
+	return fallback
+}
+
+// showTimes returns the valid showtimes of the theatre, labelled with their
+// format when one was found.
+func (t TheatreDetails) showTimes() []string {
+	var showTimes []string
+	for _, show := range t.Shows {
+		if show.Time == "" {
 			continue
 		}
+		if show.Format != "" {
+			showTimes = append(showTimes, fmt.Sprintf("%s (%s)", show.Time, show.Format))
+		} else {
+			showTimes = append(showTimes, show.Time)
+		}
+	}
+	return showTimes
+}
+
+// relativeDateRegex matches a watchlist date given as a number of days from
+// today, like "+3d".
+var relativeDateRegex = regexp.MustCompile(`^\+(\d+)d$`)
 
-		theatreElements, err := theatreContainer.Elements(".sc-e8nk8f-3.hStBrg")
+// normalizeDate turns a date written in the watchlist in a friendlier form
+// into YYYYMMDD. Besides YYYYMMDD itself it accepts YYYY-MM-DD, "today",
+// "tomorrow" and "+Nd" for N days after today, with today being the day of now.
+// Anything else is returned as is, for validate to reject.
+func normalizeDate(date string, now time.Time) string {
+	switch value := strings.ToLower(strings.TrimSpace(date)); {
+	case value == "today":
+		return now.Format("20060102")
+	case value == "tomorrow":
+		return now.AddDate(0, 0, 1).Format("20060102")
+	case relativeDateRegex.MatchString(value):
+		days, err := strconv.Atoi(relativeDateRegex.FindStringSubmatch(value)[1])
 		if err != nil {
-			logger.WithFields(logrus.Fields{
-				"movie": moviesList[i].Name,
-				"error": err,
-			}).Error("Error finding theatre elements")
-			continue
+			return date
 		}
+		return now.AddDate(0, 0, days).Format("20060102")
+	}
+	if parsed, err := time.Parse("2006-01-02", strings.TrimSpace(date)); err == nil {
+		return parsed.Format("20060102")
+	}
+	return date
+}
 
-		var theatreDetails []TheatreDetails
-		if len(theatreElements) > 0 {
-			for _, theatreEl := range theatreElements {
-				theatreNameDiv, _ := theatreEl.Element(".sc-1qdowf4-0.fbRYHb")
-				theatreShowsEl, _ := theatreEl.Elements(".sc-1la7659-0.bLMTPx")
-				theatreName, _ := theatreNameDiv.Text()
-				theatreDetails = append(theatreDetails, TheatreDetails{
-					Name:      theatreName,
-					ShowCount: len(theatreShowsEl),
-				})
-			}
+// normalizeDates rewrites every date of the movie into YYYYMMDD form, taking
+// relative ones from now.
+func (m *MovieDetails) normalizeDates(now time.Time) {
+	if m.Date != "" {
+		m.Date = normalizeDate(m.Date, now)
+	}
+	for i, date := range m.Dates {
+		m.Dates[i] = normalizeDate(date, now)
+	}
+}
+
+// formatShowDate turns a YYYYMMDD date into the DD-MM-YYYY form used in
+// notifications.
+func formatShowDate(date string) (string, error) {
+	showDate, err := time.Parse("20060102", date)
+	if err != nil {
+		return "", fmt.Errorf("error parsing date %q: %v", date, err)
+	}
+	return showDate.Format("02-01-2006"), nil
+}
+
+// readShowAvailability works out whether a show is sold out or filling fast,
+// preferring the availability selectors of pageSelectors and falling back to
+// the show's text and disabled state.
+func readShowAvailability(pageSelectors Selectors, showEl ElementController, text string) ShowAvailability {
+	if pageSelectors.ShowSoldOut != "" {
+		if soldOut, err := showEl.Matches(pageSelectors.ShowSoldOut); err == nil && soldOut {
+			return ShowSoldOut
+		}
+	}
+	if pageSelectors.ShowFillingFast != "" {
+		if fillingFast, err := showEl.Matches(pageSelectors.ShowFillingFast); err == nil && fillingFast {
+			return ShowFillingFast
 		}
+	}
 
-		var newTheatres []TheatreDetails
-		for _, theatre := range theatreDetails {
-			if theatre.Name == "" {
-				continue
-			}
+	upperText := strings.ToUpper(text)
+	switch {
+	case strings.Contains(upperText, "SOLD OUT"):
+		return ShowSoldOut
+	case strings.Contains(upperText, "FILLING FAST"), strings.Contains(upperText, "FAST FILLING"):
+		return ShowFillingFast
+	}
 
-			if !slices.Contains(moviesList[i].Theatres, theatre.Name) {
-				moviesList[i].Theatres = append(moviesList[i].Theatres, theatre.Name)
-				newTheatres = append(newTheatres, theatre)
-			}
+	for _, attr := range []string{"disabled", "aria-disabled"} {
+		if value, err := showEl.Attribute(attr); err == nil && value != nil && *value != "false" {
+			return ShowSoldOut
 		}
+	}
+	return ShowAvailable
+}
 
-		if len(newTheatres) > 0 {
-			showDate := moviesList[i].Date
-			formattedDate := fmt.Sprintf("%s-%s-%s", showDate[6:8], showDate[4:6], showDate[0:4])
+// readShowLink returns the absolute URL of the link on or around a show
+// element, or "" when there is none.
+func readShowLink(showEl ElementController) string {
+	link, err := showEl.Link()
+	if err != nil {
+		return ""
+	}
+	if !strings.HasPrefix(link, "https://") && !strings.HasPrefix(link, "http://") {
+		return ""
+	}
+	return link
+}
 
-			for _, theatre := range newTheatres {
-				notificationMsg := fmt.Sprintf("🎬 *New Show Added!*\n\n🎥 Movie: *%s*\n📅 Date: *%s*\n🏟️ Theatre: *%s*\nShows: *%d*",
-					moviesList[i].Name, formattedDate, theatre.Name, theatre.ShowCount)
-
-				bookingKeyboard := TelegramKeyboard{
-					InlineKeyboard: [][]TelegramButton{
-						{
-							{
-								Text: "🎟️ Book Now",
-								URL:  bookingURL,
-							},
-						},
-					},
-				}
+// parseShow reads the time, format badge and price out of the text of a show
+// element. Fields that can't be found are left empty.
+func parseShow(text string) ShowDetails {
+	var show ShowDetails
+	if showTime, ok := parseShowTime(text); ok {
+		show.Time = showTime
+	}
 
-				err = sendTelegramNotification(telegramChatID, notificationMsg, "Markdown", bookingKeyboard)
-				if err != nil {
-					logger.WithFields(logrus.Fields{
-						"movie":   moviesList[i].Name,
-						"theatre": theatre.Name,
-						"error":   err,
-					}).Error("Error sending Telegram notification")
-				}
+	upperText := strings.ToUpper(text)
+	words := labelWords(text)
+	for _, format := range showFormats {
+		if slices.Contains(words, format) {
+			show.Format = format
+			break
+		}
+	}
+	show.Language = findLanguage(words)
 
-				logger.WithFields(logrus.Fields{
-					"movie":   moviesList[i].Name,
-					"date":    formattedDate,
-					"theatre": theatre.Name,
-					"shows":   theatre.ShowCount,
-					"url":     bookingURL,
-				}).Info("Found new show")
-			}
+	if match := showPriceRegex.FindStringSubmatch(upperText); match != nil {
+		price, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", ""), 64)
+		if err == nil {
+			show.Price = price
 		}
 	}
+	return show
+}
+
+// labelWords splits the text of an element into upper-cased words, for
+// matching against format and language labels.
+func labelWords(text string) []string {
+	return strings.FieldsFunc(strings.ToUpper(text), func(r rune) bool {
+		return !('A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	})
+}
 
-	if err := saveMoviesToJSON(moviesFilename, moviesList); err != nil {
-		logger.WithError(err).Error("Error saving final state to JSON")
+// findLanguage returns the first of showLanguages among the upper-cased words
+// of a label, or "" when none of them is there.
+func findLanguage(words []string) string {
+	for _, language := range showLanguages {
+		if slices.Contains(words, language) {
+			return language
+		}
 	}
+	return ""
+}
 
-	duration := time.Since(startTime)
-	logger.WithField("duration_in_seconds", duration.Seconds()).Info("cron completed")
+// parseShowTime extracts a showtime like "10:30 AM" from the text of a show
+// element, reporting false when no line of the text is a valid time.
+func parseShowTime(text string) (string, bool) {
+	for _, line := range strings.Split(text, "\n") {
+		showTime, err := time.Parse("3:04 PM", strings.ToUpper(strings.TrimSpace(line)))
+		if err == nil {
+			return showTime.Format("3:04 PM"), true
+		}
+	}
+	return "", false
 }
 
-func loadMoviesFromJSON(filename string) ([]MovieDetails, error) {
+// loadMoviesFromJSON reads the watchlist from filename, resolving relative
+// dates against today in loc. On a first run without the file, an empty
+// watchlist is created there instead.
+func loadMoviesFromJSON(filename string, loc *time.Location) ([]MovieDetails, error) {
 	fileData, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := writeFileAtomic(filename, []byte("[]\n")); err != nil {
+			return nil, fmt.Errorf("error creating empty watchlist %s: %v", filename, err)
+		}
+		logger.WithField("file", filename).Warn("No watchlist yet, created an empty one. Add movies to it, or with --serve (POST /movies) or --bot (/add)")
+		return []MovieDetails{}, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error reading file %s: %v", filename, err)
 	}
 
+	fileData, migrated, err := migrateLegacyTheatres(fileData)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating %s: %v", filename, err)
+	}
+	if migrated {
+		logger.WithField("file", filename).Info("Upgraded legacy theatre names to theatre records")
+	}
+
 	var moviesList []MovieDetails
 	if err := json.Unmarshal(fileData, &moviesList); err != nil {
 		return nil, fmt.Errorf("error unmarshaling JSON: %v", err)
 	}
+	// Saving writes the resolved dates back, so "today" stays the day the
+	// entry was first loaded
+	now := time.Now().In(loc)
+	for i := range moviesList {
+		moviesList[i].normalizeDates(now)
+	}
+
+	if err := validateMovies(moviesList); err != nil {
+		return nil, err
+	}
 
 	return moviesList, nil
 }
 
-func saveMoviesToJSON(filename string, moviesList []MovieDetails) error {
-	jsonData, err := json.MarshalIndent(moviesList, "", "    ")
+// loadSelectorsFromJSON reads the page selectors from filename, falling back to
+// defaultSelectors for any that are missing.
+func loadSelectorsFromJSON(filename string) (Selectors, error) {
+	fileData, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultSelectors, nil
+	}
 	if err != nil {
-		return fmt.Errorf("error marshaling JSON: %v", err)
+		return Selectors{}, fmt.Errorf("error reading file %s: %v", filename, err)
 	}
 
-	if err := os.WriteFile(filename, jsonData, 0644); err != nil {
-		return fmt.Errorf("error writing file %s: %v", filename, err)
+	var loaded Selectors
+	if err := json.Unmarshal(fileData, &loaded); err != nil {
+		return Selectors{}, fmt.Errorf("error unmarshaling JSON: %v", err)
 	}
-	return nil
+
+	if loaded.TheatreContainer == "" {
+		loaded.TheatreContainer = defaultSelectors.TheatreContainer
+	}
+	if loaded.Theatre == "" {
+		loaded.Theatre = defaultSelectors.Theatre
+	}
+	if loaded.TheatreName == "" {
+		loaded.TheatreName = defaultSelectors.TheatreName
+	}
+	if loaded.Show == "" {
+		loaded.Show = defaultSelectors.Show
+	}
+	if loaded.DateTab == "" {
+		loaded.DateTab = defaultSelectors.DateTab
+	}
+
+	if events := loaded.Events; events != nil {
+		if events.Events != nil {
+			return Selectors{}, errors.New("events selectors can't have events of their own")
+		}
+		if events.TheatreContainer == "" {
+			events.TheatreContainer = loaded.TheatreContainer
+		}
+		if events.Theatre == "" {
+			events.Theatre = loaded.Theatre
+		}
+		if events.TheatreName == "" {
+			events.TheatreName = loaded.TheatreName
+		}
+		if events.Show == "" {
+			events.Show = loaded.Show
+		}
+		if events.DateTab == "" {
+			events.DateTab = loaded.DateTab
+		}
+	}
+	return loaded, nil
 }
 
-func sendTelegramNotification(chatID string, message string, parseMode string, keyboard TelegramKeyboard) error {
-	payload := map[string]interface{}{
-		"chat_id":      chatID,
-		"text":         message,
-		"parse_mode":   parseMode,
-		"reply_markup": keyboard,
+// migrateLegacyTheatres upgrades movie entries whose "theatres" is the old
+// plain list of theatre names into a list of theatre records, reporting whether
+// anything had to be changed. The upgraded records have no LastSeen, marking
+// their show count as unknown.
+func migrateLegacyTheatres(fileData []byte) ([]byte, bool, error) {
+	var rawMovies []map[string]json.RawMessage
+	if err := json.Unmarshal(fileData, &rawMovies); err != nil {
+		return nil, false, fmt.Errorf("error unmarshaling JSON: %v", err)
 	}
 
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("error marshaling payload: %v", err)
+	migrated := false
+	for _, rawMovie := range rawMovies {
+		var theatreNames []string
+		if err := json.Unmarshal(rawMovie["theatres"], &theatreNames); err != nil || len(theatreNames) == 0 {
+			// Already records, or nothing to upgrade
+			continue
+		}
+
+		records := make([]TheatreRecord, 0, len(theatreNames))
+		for _, name := range theatreNames {
+			records = append(records, TheatreRecord{Name: name})
+		}
+
+		recordsJSON, err := json.Marshal(records)
+		if err != nil {
+			return nil, false, fmt.Errorf("error marshaling theatre records: %v", err)
+		}
+		rawMovie["theatres"] = recordsJSON
+		migrated = true
+	}
+
+	if !migrated {
+		return fileData, false, nil
 	}
 
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", telegramBotToken)
-	response, err := http.Post(apiURL, "application/json", bytes.NewBuffer(payloadJSON))
+	migratedData, err := json.Marshal(rawMovies)
 	if err != nil {
-		return fmt.Errorf("error making telegram request: %v", err)
+		return nil, false, fmt.Errorf("error marshaling JSON: %v", err)
 	}
-	defer response.Body.Close()
+	return migratedData, true, nil
+}
+
+// saveMoviesToJSON writes the watchlist to filename. The entries are sorted by
+// code and date, and their theatres by name, so a file kept in git only
+// changes where the watchlist did, not with the order of concurrent scrapes.
+// moviesList itself isn't reordered. compact leaves out the indentation.
+func saveMoviesToJSON(filename string, moviesList []MovieDetails, compact bool) error {
+	sorted := make([]MovieDetails, len(moviesList))
+	for i, movie := range moviesList {
+		sorted[i] = movie.withSortedTheatres()
+	}
+	sort.SliceStable(sorted, func(a, b int) bool {
+		if sorted[a].Code != sorted[b].Code {
+			return sorted[a].Code < sorted[b].Code
+		}
+		return sorted[a].Date < sorted[b].Date
+	})
 
-	var apiResponse struct {
-		Ok          bool   `json:"ok"`
-		Description string `json:"description"`
+	var jsonData []byte
+	var err error
+	if compact {
+		jsonData, err = json.Marshal(sorted)
+	} else {
+		jsonData, err = json.MarshalIndent(sorted, "", "    ")
+	}
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %v", err)
 	}
 
-	if err := json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
-		return fmt.Errorf("error decoding response: %v", err)
+	return writeFileAtomic(filename, jsonData)
+}
+
+// writeFileAtomic replaces filename with data. It writes next to the real file
+// and renames it into place, so a crash mid-write leaves the previous contents
+// intact.
+func writeFileAtomic(filename string, data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file for %s: %v", filename, err)
 	}
+	tempName := tempFile.Name()
+	defer os.Remove(tempName)
 
-	if !apiResponse.Ok {
-		return fmt.Errorf("telegram API error: %s", apiResponse.Description)
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("error writing temp file %s: %v", tempName, err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("error syncing temp file %s: %v", tempName, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("error closing temp file %s: %v", tempName, err)
+	}
+	if err := os.Chmod(tempName, 0644); err != nil {
+		return fmt.Errorf("error setting permissions on %s: %v", tempName, err)
 	}
 
+	if err := os.Rename(tempName, filename); err != nil {
+		return fmt.Errorf("error replacing %s: %v", filename, err)
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,861 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testBookingURL is the booking page the scrape tests navigate to.
+const testBookingURL = "https://in.bookmyshow.com/buytickets/l2-empuraan-kochi/movie-koch-ET00305698-MT/20250327"
+
+// useDefaultSelectors sets the page selectors to the defaults for the rest
+// of the test.
+func useDefaultSelectors(t *testing.T) {
+	t.Helper()
+	previous := selectors
+	selectors = defaultSelectors
+	t.Cleanup(func() { selectors = previous })
+}
+
+// newTestConfig returns the least configuration a scrape runs with.
+func newTestConfig() *Config {
+	return &Config{
+		NavigationAttempts: 1,
+		TheatreNames:       newTheatreNames(nil, nil),
+	}
+}
+
+func TestScrapeBookingPage(t *testing.T) {
+	useDefaultSelectors(t)
+	page := newFakePage(t, `<html><head><title>L2: Empuraan Tickets</title></head><body>
+<div class="ReactVirtualized__Grid__innerScrollContainer">
+	<div class="sc-e8nk8f-3 hStBrg">
+		<span class="sc-1qdowf4-0 fbRYHb">PVR: Lulu, Kochi</span>
+		<div class="sc-1la7659-0 bLMTPx"><a href="https://in.bookmyshow.com/seatlayout/1">10:30 AM<br/>IMAX<br/>&#8377;350</a></div>
+		<div class="sc-1la7659-0 bLMTPx">01:45 PM<br/>SOLD OUT</div>
+	</div>
+	<div class="sc-e8nk8f-3 hStBrg">
+		<span class="sc-1qdowf4-0 fbRYHb">Cinepolis: Centre Square Mall, Kochi</span>
+		<div class="sc-1la7659-0 bLMTPx">07:00 PM</div>
+	</div>
+</div>
+</body></html>`)
+	movie := &MovieDetails{Name: "L2: Empuraan"}
+
+	result, err := scrapeBookingPage(context.Background(), newTestConfig(), page, movie, CityDetails{City: "kochi"}, "20250327", ScrapeResult{BookingURL: testBookingURL})
+	if err != nil {
+		t.Fatalf("scrapeBookingPage() error = %v", err)
+	}
+	if !reflect.DeepEqual(page.navigated, []string{testBookingURL}) {
+		t.Errorf("navigated = %v, want only %s", page.navigated, testBookingURL)
+	}
+	if result.Attempts != 1 || !result.BookingOpen || result.NoShows {
+		t.Errorf("Attempts, BookingOpen, NoShows = %d, %t, %t, want 1, true, false", result.Attempts, result.BookingOpen, result.NoShows)
+	}
+	want := []TheatreDetails{
+		{
+			Name:      "PVR: Lulu, Kochi",
+			ShowCount: 2,
+			Shows: []ShowDetails{
+				{Time: "10:30 AM", Format: "IMAX", Price: 350, Availability: ShowAvailable, BookingURL: "https://in.bookmyshow.com/seatlayout/1"},
+				{Time: "1:45 PM", Availability: ShowSoldOut},
+			},
+			AvailableCount: 1,
+		},
+		{
+			Name:           "Cinepolis: Centre Square Mall, Kochi",
+			ShowCount:      1,
+			Shows:          []ShowDetails{{Time: "7:00 PM", Availability: ShowAvailable}},
+			AvailableCount: 1,
+		},
+	}
+	if !reflect.DeepEqual(result.Theatres, want) {
+		t.Errorf("Theatres = %+v, want %+v", result.Theatres, want)
+	}
+}
+
+func TestScrapeBookingPageWithoutTheatreList(t *testing.T) {
+	useDefaultSelectors(t)
+	tests := []struct {
+		name        string
+		html        string
+		finalURL    string
+		wantErr     error
+		wantNoShows bool
+		wantNotOpen bool
+	}{
+		{
+			name:        "bookings not open",
+			html:        `<html><head><title>L2: Empuraan</title></head><body><p>Bookings open on Thursday</p></body></html>`,
+			wantNoShows: true,
+			wantNotOpen: true,
+		},
+		{
+			name:        "redirected to the movie page",
+			html:        `<html><head><title>L2: Empuraan</title></head><body><p>Book tickets</p></body></html>`,
+			finalURL:    "https://in.bookmyshow.com/kochi/movies/l2-empuraan/ET00305698",
+			wantNoShows: true,
+			wantNotOpen: true,
+		},
+		{
+			name:    "challenged",
+			html:    `<html><head><title>Just a moment...</title></head><body><form id="challenge-form"></form></body></html>`,
+			wantErr: ErrBlocked,
+		},
+		{
+			name:        "container never appears",
+			html:        `<html><head><title>L2: Empuraan Tickets</title></head><body><p>Select a show</p></body></html>`,
+			wantNoShows: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := newFakePage(t, tt.html)
+			page.finalURL = tt.finalURL
+			movie := &MovieDetails{Name: "L2: Empuraan"}
+
+			result, err := scrapeBookingPage(context.Background(), newTestConfig(), page, movie, CityDetails{City: "kochi"}, "20250327", ScrapeResult{BookingURL: testBookingURL})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("scrapeBookingPage() error = %v, want %v", err, tt.wantErr)
+			}
+			if result.NoShows != tt.wantNoShows || result.BookingNotOpen != tt.wantNotOpen {
+				t.Errorf("NoShows, BookingNotOpen = %t, %t, want %t, %t", result.NoShows, result.BookingNotOpen, tt.wantNoShows, tt.wantNotOpen)
+			}
+			if len(result.Theatres) != 0 {
+				t.Errorf("Theatres = %+v, want none", result.Theatres)
+			}
+		})
+	}
+}
+
+// fixtureContainer returns the theatre container of the saved booking page
+// testdata/name.
+func fixtureContainer(t *testing.T, name string) (*fakePage, ElementController) {
+	t.Helper()
+	page := loadFakePage(t, name)
+	container, err := page.Element(defaultSelectors.TheatreContainer)
+	if err != nil {
+		t.Fatalf("finding the theatre container of %s: %v", name, err)
+	}
+	return page, container
+}
+
+func TestScrapeTheatresFixtures(t *testing.T) {
+	useDefaultSelectors(t)
+	tests := []struct {
+		fixture  string
+		want     []TheatreDetails
+		wantScan theatreScan
+	}{
+		{
+			fixture: "no_shows.html",
+		},
+		{
+			fixture: "one_theatre.html",
+			want: []TheatreDetails{
+				{
+					Name:      "PVR: Lulu, Kochi",
+					ShowCount: 3,
+					Shows: []ShowDetails{
+						{Time: "9:00 AM", Format: "IMAX", Price: 450, Availability: ShowAvailable, BookingURL: "https://in.bookmyshow.com/booktickets/PVLU/10001"},
+						{Time: "12:30 PM", Price: 250, Availability: ShowFillingFast, BookingURL: "https://in.bookmyshow.com/booktickets/PVLU/10002"},
+						{Time: "4:15 PM", Format: "3D", Availability: ShowSoldOut},
+					},
+					AvailableCount: 2,
+				},
+			},
+			wantScan: theatreScan{elements: 1, showElements: 3, theatres: 1},
+		},
+		{
+			fixture: "many_theatres.html",
+			want: []TheatreDetails{
+				{
+					Name:      "PVR: Lulu, Kochi",
+					ShowCount: 2,
+					Shows: []ShowDetails{
+						{Time: "9:00 AM", Format: "IMAX", Price: 450, Availability: ShowAvailable},
+						{Time: "6:45 PM", Format: "IMAX", Price: 450, Availability: ShowAvailable},
+					},
+					AvailableCount: 2,
+				},
+				{
+					Name:           "Cinepolis: Centre Square Mall, Kochi",
+					ShowCount:      1,
+					Shows:          []ShowDetails{{Time: "10:15 AM", Format: "4DX", Price: 600, Availability: ShowAvailable}},
+					AvailableCount: 1,
+				},
+				{
+					Name:      "Vanitha Cineplex: Edappally",
+					ShowCount: 3,
+					Shows: []ShowDetails{
+						{Time: "11:00 AM", Price: 180, Availability: ShowAvailable},
+						{Time: "2:30 PM", Price: 180, Availability: ShowAvailable},
+						{Time: "10:00 PM", Availability: ShowSoldOut},
+					},
+					AvailableCount: 2,
+				},
+				{
+					Name: "Shenoys: MG Road, Kochi",
+				},
+			},
+			wantScan: theatreScan{elements: 4, showElements: 6, theatres: 4},
+		},
+		{
+			fixture: "missing_name.html",
+			want: []TheatreDetails{
+				{
+					Name:           "Sridhar Theatre: Shanmugham Road",
+					ShowCount:      1,
+					Shows:          []ShowDetails{{Time: "11:45 AM", Price: 150, Availability: ShowAvailable}},
+					AvailableCount: 1,
+				},
+			},
+			wantScan: theatreScan{elements: 2, missingNames: 1, showElements: 1, theatres: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			_, container := fixtureContainer(t, tt.fixture)
+			movie := &MovieDetails{Name: "L2: Empuraan"}
+
+			got, scan, err := scrapeTheatres(newTestConfig(), movie, container)
+			if err != nil {
+				t.Fatalf("scrapeTheatres() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scrapeTheatres() = %+v, want %+v", got, tt.want)
+			}
+			if scan != tt.wantScan {
+				t.Errorf("scan = %+v, want %+v", scan, tt.wantScan)
+			}
+		})
+	}
+}
+
+func TestNoShowsFixtureListsNothing(t *testing.T) {
+	useDefaultSelectors(t)
+	page, container := fixtureContainer(t, "no_shows.html")
+	if !listsNothing(page, container) {
+		t.Error("listsNothing() = false for a loaded page with an empty theatre list")
+	}
+}
+
+func TestParseTheatreFixtures(t *testing.T) {
+	useDefaultSelectors(t)
+	_, container := fixtureContainer(t, "missing_name.html")
+	rows, err := container.Elements(defaultSelectors.Theatre)
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("Elements() = %d rows, %v, want 2", len(rows), err)
+	}
+	movie := &MovieDetails{Name: "L2: Empuraan"}
+
+	var scan theatreScan
+	if theatre, ok := parseTheatre(newTestConfig(), movie, rows[0], &scan); ok {
+		t.Errorf("parseTheatre() of the row without a name = %+v, want it skipped", theatre)
+	}
+	if scan.missingNames != 1 || scan.showElements != 0 {
+		t.Errorf("scan after the row without a name = %+v, want one missing name and no shows", scan)
+	}
+
+	theatre, ok := parseTheatre(newTestConfig(), movie, rows[1], &scan)
+	if !ok {
+		t.Fatal("parseTheatre() skipped the row with a name")
+	}
+	if theatre.Name != "Sridhar Theatre: Shanmugham Road" || theatre.ShowCount != 1 || theatre.Shows[0].Price != 150 {
+		t.Errorf("parseTheatre() = %+v, want Sridhar Theatre: Shanmugham Road with one show at 150", theatre)
+	}
+}
+
+// recordingNotifier is a Notifier that keeps every alert it is sent.
+type recordingNotifier struct {
+	sent []NotificationPayload
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(msg NotificationPayload) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+// testShowDate is the date the processShowDate tests scrape.
+const testShowDate = "20991231"
+
+// processTestShowDate runs processShowDate for the first movie of movies on
+// testShowDate with a scrape that finds theatres, and delivers the alerts it
+// queued to cfg's notifiers.
+func processTestShowDate(t *testing.T, cfg *Config, movies []MovieDetails, theatres []TheatreDetails) {
+	t.Helper()
+	notifications := newNotificationQueue(cfg)
+	movie := &movies[0]
+	city := CityDetails{City: "kochi"}
+	scrape := func() (ScrapeResult, error) {
+		return ScrapeResult{BookingURL: testBookingURL, Theatres: theatres, BookingOpen: len(theatres) > 0}, nil
+	}
+	if err := processShowDate(context.Background(), cfg, notifications.forMovie(0, movie), movie, city, testShowDate, movie.dateState(city.City, testShowDate), scrape); err != nil {
+		t.Fatalf("processShowDate() error = %v", err)
+	}
+	notifications.Flush(movies)
+}
+
+// testTheatre returns a scraped theatre with shows, each costing price and
+// in format when it isn't empty.
+func testTheatre(name string, shows int, price float64, format string) TheatreDetails {
+	theatre := TheatreDetails{Name: name, ShowCount: shows, AvailableCount: shows}
+	for i := 0; i < shows; i++ {
+		theatre.Shows = append(theatre.Shows, ShowDetails{Time: "10:00 AM", Price: price, Format: format, Availability: ShowAvailable})
+	}
+	return theatre
+}
+
+func TestTheatreDetailsDiff(t *testing.T) {
+	seen := time.Date(2025, 3, 26, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		theatre  TheatreDetails
+		previous *TheatreRecord
+		want     TheatreChanges
+	}{
+		{
+			name:    "added",
+			theatre: testTheatre("PVR", 2, 250, "IMAX"),
+			want:    TheatreChanges{New: true},
+		},
+		{
+			name:     "unchanged",
+			theatre:  testTheatre("PVR", 2, 250, "IMAX"),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, MinPrice: 250, Formats: []string{"IMAX"}},
+		},
+		{
+			name:     "more shows",
+			theatre:  testTheatre("PVR", 4, 250, ""),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, MinPrice: 250, Formats: []string{}},
+			want:     TheatreChanges{MoreShows: true},
+		},
+		{
+			name:     "shows removed",
+			theatre:  testTheatre("PVR", 1, 250, ""),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 3, LastSeen: seen, MinPrice: 250, Formats: []string{}},
+			want:     TheatreChanges{FewerShows: true},
+		},
+		{
+			name:     "legacy record without a show count",
+			theatre:  testTheatre("PVR", 4, 250, ""),
+			previous: &TheatreRecord{Name: "PVR"},
+		},
+		{
+			name:     "price",
+			theatre:  testTheatre("PVR", 2, 180, ""),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, MinPrice: 250, Formats: []string{}},
+			want:     TheatreChanges{PriceChanged: true},
+		},
+		{
+			name:     "price not recorded before",
+			theatre:  testTheatre("PVR", 2, 180, ""),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, Formats: []string{}},
+		},
+		{
+			name:     "price not scraped",
+			theatre:  testTheatre("PVR", 2, 0, ""),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, MinPrice: 250, Formats: []string{}},
+		},
+		{
+			name:     "format",
+			theatre:  TheatreDetails{Name: "PVR", ShowCount: 2, Shows: []ShowDetails{{Format: "IMAX"}, {Format: "4DX"}}},
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, Formats: []string{"IMAX"}},
+			want:     TheatreChanges{NewFormats: []string{"4DX"}},
+		},
+		{
+			name:     "format after none recorded",
+			theatre:  testTheatre("PVR", 2, 0, "IMAX"),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, Formats: []string{}},
+			want:     TheatreChanges{NewFormats: []string{"IMAX"}},
+		},
+		{
+			name:     "formats not recorded before",
+			theatre:  testTheatre("PVR", 2, 0, "IMAX"),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen},
+		},
+		{
+			name:     "format dropped",
+			theatre:  testTheatre("PVR", 2, 0, "2D"),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, Formats: []string{"2D", "IMAX"}},
+		},
+		{
+			name:     "everything",
+			theatre:  testTheatre("PVR", 5, 300, "ICE"),
+			previous: &TheatreRecord{Name: "PVR", ShowCount: 2, LastSeen: seen, MinPrice: 250, Formats: []string{"2D"}},
+			want:     TheatreChanges{MoreShows: true, PriceChanged: true, NewFormats: []string{"ICE"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.theatre.diff(tt.previous)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff() = %+v, want %+v", got, tt.want)
+			}
+			if got.Changed() != !reflect.DeepEqual(tt.want, TheatreChanges{}) {
+				t.Errorf("Changed() = %t for %+v", got.Changed(), got)
+			}
+		})
+	}
+}
+
+func TestProcessShowDateRemovedTheatre(t *testing.T) {
+	notifier := &recordingNotifier{}
+	cfg := &Config{Notifiers: []Notifier{notifier}, TheatreNames: newTheatreNames(nil, nil)}
+	movies := []MovieDetails{{Name: "L2: Empuraan", SlugName: "l2-empuraan", Code: "ET00305698", City: "kochi", Date: testShowDate}}
+
+	processTestShowDate(t, cfg, movies, []TheatreDetails{testTheatre("PVR", 2, 250, ""), testTheatre("Cinepolis", 2, 250, "")})
+	notifier.sent = nil
+	processTestShowDate(t, cfg, movies, []TheatreDetails{testTheatre("PVR", 2, 250, "")})
+
+	if len(notifier.sent) != 1 || notifier.sent[0].Kind != NotificationShowsRemoved || notifier.sent[0].Theatre != "Cinepolis" {
+		t.Fatalf("sent %+v, want one removal alert for Cinepolis", notifier.sent)
+	}
+	state := movies[0].dateState("kochi", testShowDate)
+	if len(state.Theatres) != 1 || state.Theatres[0].Name != "PVR" {
+		t.Errorf("state.Theatres = %+v, want only PVR left", state.Theatres)
+	}
+}
+
+func TestScrapeMoviesUpdatesEveryMovie(t *testing.T) {
+	useDefaultSelectors(t)
+	notifier := &recordingNotifier{}
+	cfg := newTestConfig()
+	cfg.Notifiers = []Notifier{notifier}
+	cfg.ScraperConcurrency = 3
+	cfg.PagesPerMovie = 1
+	cfg.BookingURLTemplate = defaultBookingURLTemplate
+	cfg.ShowLocation = time.UTC
+
+	pages := &fakePages{t: t, html: make(map[string]string)}
+	var movies []MovieDetails
+	for i := range 8 {
+		movie := MovieDetails{
+			Name:     fmt.Sprintf("Movie %d", i),
+			SlugName: fmt.Sprintf("movie-%d", i),
+			Code:     fmt.Sprintf("ET%08d", i),
+			City:     "kochi",
+			Date:     testShowDate,
+		}
+		bookingURL := buildBookingURL(cfg.BookingURLTemplate, movie.City, movie.SlugName, movie.Code, movie.Date)
+		pages.html[bookingURL] = fmt.Sprintf(`<html><head><title>%s</title></head><body>
+<div class="ReactVirtualized__Grid__innerScrollContainer">
+	<div class="sc-e8nk8f-3 hStBrg">
+		<span class="sc-1qdowf4-0 fbRYHb">Theatre of %s</span>
+		<div class="sc-1la7659-0 bLMTPx">10:00 AM</div>
+	</div>
+</div>
+</body></html>`, movie.Name, movie.Name)
+		movies = append(movies, movie)
+	}
+	// A movie that was already found isn't scraped again
+	movies[5].Found = true
+
+	notifications := newNotificationQueue(cfg)
+	var finished []int
+	skipped := scrapeMovies(context.Background(), cfg, pages, notifications, movies, func(result movieJob) {
+		finished = append(finished, result.index)
+		if result.err != nil {
+			t.Errorf("scraping %s failed: %v", result.movie.Name, result.err)
+		}
+	})
+	notifications.Flush(movies)
+
+	if skipped != 0 {
+		t.Errorf("skipped %d movies, want none", skipped)
+	}
+	slices.Sort(finished)
+	if want := []int{0, 1, 2, 3, 4, 6, 7}; !reflect.DeepEqual(finished, want) {
+		t.Errorf("finished movies %v, want %v", finished, want)
+	}
+	if len(pages.opened) != 7 {
+		t.Errorf("opened %d pages, want one per due movie", len(pages.opened))
+	}
+	alerted := make(map[string]bool)
+	for _, msg := range notifier.sent {
+		if msg.Kind == NotificationNewShow {
+			alerted[msg.Movie] = true
+		}
+	}
+	for i, movie := range movies {
+		state := movie.dateState("kochi", testShowDate)
+		if i == 5 {
+			if len(state.Theatres) != 0 || !movie.LastChecked.IsZero() {
+				t.Errorf("found movie was scraped: %+v", movie)
+			}
+			continue
+		}
+		if len(state.Theatres) != 1 || state.Theatres[0].Name != "Theatre of "+movie.Name {
+			t.Errorf("%s has theatres %+v, want its own one theatre", movie.Name, state.Theatres)
+		}
+		if movie.LastChecked.IsZero() {
+			t.Errorf("%s wasn't marked checked", movie.Name)
+		}
+		if !alerted[movie.Name] {
+			t.Errorf("no new show alert for %s", movie.Name)
+		}
+	}
+}
+
+// writeTestFile writes data to name in a temporary directory of the test and
+// returns its path.
+func writeTestFile(t *testing.T, name string, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadMoviesFromJSONTheatreFormats(t *testing.T) {
+	lastSeen := time.Date(2025, 3, 26, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		json string
+		want []TheatreRecord
+	}{
+		{
+			name: "legacy theatre names",
+			json: `[{"name": "L2: Empuraan", "slug_name": "l2-empuraan", "code": "ET00305698", "city": "kochi", "city_code": "KOCH", "date": "20991231", "found": false, "theatres": ["PVR: Lulu, Kochi", "Cinepolis: Centre Square Mall, Kochi"]}]`,
+			want: []TheatreRecord{{Name: "PVR: Lulu, Kochi"}, {Name: "Cinepolis: Centre Square Mall, Kochi"}},
+		},
+		{
+			name: "theatre records",
+			json: `[{"name": "L2: Empuraan", "slug_name": "l2-empuraan", "code": "ET00305698", "city": "kochi", "city_code": "KOCH", "date": "20991231", "found": false, "theatres": [{"name": "PVR: Lulu, Kochi", "show_count": 4, "first_seen": "2025-03-26T10:00:00Z", "last_seen": "2025-03-26T10:00:00Z", "min_price": 250, "formats": ["IMAX"]}]}]`,
+			want: []TheatreRecord{{Name: "PVR: Lulu, Kochi", ShowCount: 4, FirstSeen: lastSeen, LastSeen: lastSeen, MinPrice: 250, Formats: []string{"IMAX"}}},
+		},
+		{
+			name: "no theatres yet",
+			json: `[{"name": "L2: Empuraan", "slug_name": "l2-empuraan", "code": "ET00305698", "city": "kochi", "city_code": "KOCH", "date": "20991231", "found": false, "theatres": []}]`,
+			want: []TheatreRecord{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "bms.json", tt.json)
+
+			movies, err := loadMoviesFromJSON(path, time.UTC)
+			if err != nil {
+				t.Fatalf("loadMoviesFromJSON() error = %v", err)
+			}
+			if len(movies) != 1 {
+				t.Fatalf("loaded %d movies, want 1", len(movies))
+			}
+			if movies[0].Code != "ET00305698" || movies[0].Date != "20991231" {
+				t.Errorf("loaded %+v, want the rest of the entry kept", movies[0])
+			}
+			if !reflect.DeepEqual(movies[0].Theatres, tt.want) {
+				t.Errorf("Theatres = %+v, want %+v", movies[0].Theatres, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyTheatresLeavesRecordsAlone(t *testing.T) {
+	data := []byte(`[{"name": "L2: Empuraan", "theatres": [{"name": "PVR: Lulu, Kochi", "show_count": 4}]}]`)
+	migrated, changed, err := migrateLegacyTheatres(data)
+	if err != nil {
+		t.Fatalf("migrateLegacyTheatres() error = %v", err)
+	}
+	if changed || string(migrated) != string(data) {
+		t.Errorf("migrateLegacyTheatres() = %s, %t, want the records unchanged", migrated, changed)
+	}
+}
+
+func TestParseTheatreWithoutNameDiv(t *testing.T) {
+	useDefaultSelectors(t)
+	tests := []struct {
+		name string
+		html string
+	}{
+		{
+			name: "name div missing",
+			html: `<div class="sc-e8nk8f-3 hStBrg"><div class="sc-1la7659-0 bLMTPx">10:00 AM</div></div>`,
+		},
+		{
+			name: "name div empty",
+			html: `<div class="sc-e8nk8f-3 hStBrg"><span class="sc-1qdowf4-0 fbRYHb">  </span><div class="sc-1la7659-0 bLMTPx">10:00 AM</div></div>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := newFakePage(t, tt.html).Element(defaultSelectors.Theatre)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var scan theatreScan
+			theatre, ok := parseTheatre(newTestConfig(), &MovieDetails{Name: "L2: Empuraan"}, row, &scan)
+			if ok {
+				t.Errorf("parseTheatre() = %+v, want the row skipped", theatre)
+			}
+			if scan.missingNames != 1 {
+				t.Errorf("missingNames = %d, want 1", scan.missingNames)
+			}
+		})
+	}
+}
+
+func TestFormatShowDate(t *testing.T) {
+	tests := []struct {
+		date    string
+		want    string
+		wantErr bool
+	}{
+		{date: "20250327", want: "27-03-2025"},
+		{date: "202503", wantErr: true},
+		{date: "2025", wantErr: true},
+		{date: "", wantErr: true},
+		{date: "20251340", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := formatShowDate(tt.date)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("formatShowDate(%q) = %q, %v, want %q and an error %t", tt.date, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProcessShowDateShortDate(t *testing.T) {
+	notifier := &recordingNotifier{}
+	cfg := &Config{Notifiers: []Notifier{notifier}, TheatreNames: newTheatreNames(nil, nil)}
+	movies := []MovieDetails{{Name: "L2: Empuraan", SlugName: "l2-empuraan", Code: "ET00305698", City: "kochi", Date: "202503"}}
+	movie := &movies[0]
+	city := CityDetails{City: "kochi"}
+	scrape := func() (ScrapeResult, error) {
+		return ScrapeResult{BookingURL: testBookingURL, Theatres: []TheatreDetails{testTheatre("PVR", 2, 250, "")}, BookingOpen: true}, nil
+	}
+
+	notifications := newNotificationQueue(cfg)
+	if err := processShowDate(context.Background(), cfg, notifications.forMovie(0, movie), movie, city, movie.Date, movie.dateState(city.City, movie.Date), scrape); err != nil {
+		t.Fatalf("processShowDate() error = %v, want the date skipped", err)
+	}
+	notifications.Flush(movies)
+	if len(notifier.sent) != 0 {
+		t.Errorf("sent %+v, want no alerts for a date that can't be formatted", notifier.sent)
+	}
+}
+
+const validWatchlist = `[{"name": "L2: Empuraan", "slug_name": "l2-empuraan", "code": "ET00305698", "city": "kochi", "city_code": "KOCH", "date": "20991231", "found": false, "theatres": [{"name": "PVR: Lulu, Kochi", "show_count": 4}]}]`
+
+// tempFiles returns the temp files writeFileAtomic left next to filename.
+func tempFiles(t *testing.T, filename string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filename + ".tmp-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestPartialTempFileNeverReplacesWatchlist(t *testing.T) {
+	path := writeTestFile(t, "bms.json", validWatchlist)
+	// What a crash in the middle of a save leaves behind
+	partial := path + ".tmp-1234"
+	if err := os.WriteFile(partial, []byte(`[{"name": "L2: Empuraan", "slug_na`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, err := loadMoviesFromJSON(path, time.UTC)
+	if err != nil {
+		t.Fatalf("loadMoviesFromJSON() error = %v, want the valid watchlist loaded", err)
+	}
+	if len(movies) != 1 || len(movies[0].Theatres) != 1 {
+		t.Fatalf("loaded %+v, want the one movie with its theatre", movies)
+	}
+
+	// A save that fails before all of it is written leaves the file as it was
+	movies[0].Theatres[0].MinPrice = math.NaN()
+	if err := saveMoviesToJSON(path, movies, false); err == nil {
+		t.Fatal("saveMoviesToJSON() error = nil for a price JSON can't hold")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != validWatchlist {
+		t.Errorf("bms.json = %q, %v after a failed save, want it unchanged", data, err)
+	}
+
+	// A save that succeeds replaces the file, never with the partial one
+	movies[0].Theatres[0].MinPrice = 250
+	if err := saveMoviesToJSON(path, movies, false); err != nil {
+		t.Fatalf("saveMoviesToJSON() error = %v", err)
+	}
+	saved, err := loadMoviesFromJSON(path, time.UTC)
+	if err != nil {
+		t.Fatalf("loadMoviesFromJSON() of the saved file error = %v", err)
+	}
+	if len(saved) != 1 || saved[0].Theatres[0].MinPrice != 250 {
+		t.Errorf("saved %+v, want the movie with its new price", saved)
+	}
+	if leftover := tempFiles(t, path); !reflect.DeepEqual(leftover, []string{partial}) {
+		t.Errorf("temp files = %v, want only the crashed one left alone", leftover)
+	}
+}
+
+func TestWriteFileAtomicFailureCleansUp(t *testing.T) {
+	// A directory in the way makes the final rename fail
+	path := filepath.Join(t.TempDir(), "bms.json")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "keep"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte(validWatchlist)); err == nil {
+		t.Fatal("writeFileAtomic() error = nil, want the rename to fail")
+	}
+	if leftover := tempFiles(t, path); len(leftover) != 0 {
+		t.Errorf("temp files = %v left after a failed write, want none", leftover)
+	}
+}
+
+func TestProcessShowDateDuplicateTheatres(t *testing.T) {
+	notifier := &recordingNotifier{}
+	cfg := &Config{Notifiers: []Notifier{notifier}, TheatreNames: newTheatreNames(nil, nil)}
+	movies := []MovieDetails{{Name: "L2: Empuraan", SlugName: "l2-empuraan", Code: "ET00305698", City: "kochi", Date: testShowDate}}
+
+	// Lazy loading can render a row twice, and not always identically
+	processTestShowDate(t, cfg, movies, []TheatreDetails{
+		testTheatre("PVR: Lulu, Kochi", 2, 250, ""),
+		testTheatre("PVR: Lulu, Kochi", 2, 250, ""),
+		testTheatre("  pvr:  Lulu, Kochi ", 2, 250, ""),
+	})
+
+	if len(notifier.sent) != 1 || notifier.sent[0].Theatre != "PVR: Lulu, Kochi" {
+		t.Fatalf("sent %+v, want a single alert for PVR: Lulu, Kochi", notifier.sent)
+	}
+	if state := movies[0].dateState("kochi", testShowDate); len(state.Theatres) != 1 {
+		t.Errorf("state.Theatres = %+v, want the theatre recorded once", state.Theatres)
+	}
+}
+
+func TestScrapeTheatresDuplicateRows(t *testing.T) {
+	useDefaultSelectors(t)
+	row := `<div class="sc-e8nk8f-3 hStBrg"><span class="sc-1qdowf4-0 fbRYHb">PVR: Lulu, Kochi</span><div class="sc-1la7659-0 bLMTPx">10:00 AM</div></div>`
+	page := newFakePage(t, `<div class="ReactVirtualized__Grid__innerScrollContainer">`+row+row+`</div>`)
+	container, err := page.Element(defaultSelectors.TheatreContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	theatres, scan, err := scrapeTheatres(newTestConfig(), &MovieDetails{Name: "L2: Empuraan"}, container)
+	if err != nil {
+		t.Fatalf("scrapeTheatres() error = %v", err)
+	}
+	if len(theatres) != 1 || scan.elements != 2 || scan.theatres != 1 {
+		t.Errorf("scrapeTheatres() = %+v, %+v, want the theatre once out of two rows", theatres, scan)
+	}
+}
+
+// benchmarkTheatres returns count theatre records and the names of a scrape
+// finding them all again, in another order.
+func benchmarkTheatres(count int) ([]TheatreRecord, []string) {
+	records := make([]TheatreRecord, 0, count)
+	scraped := make([]string, 0, count)
+	for i := range count {
+		records = append(records, TheatreRecord{Name: fmt.Sprintf("Theatre %d: Some Mall, Kochi", i)})
+		scraped = append(scraped, fmt.Sprintf("Theatre %d: Some Mall, Kochi", count-1-i))
+	}
+	return records, scraped
+}
+
+// BenchmarkKnownTheatresSet looks scraped theatres up in state the way
+// processShowDate does, through a set of their keys built once per date.
+func BenchmarkKnownTheatresSet(b *testing.B) {
+	names := newTheatreNames(nil, nil)
+	records, scraped := benchmarkTheatres(500)
+	for b.Loop() {
+		knownTheatres := make(map[string]int, len(records))
+		for i, theatre := range records {
+			knownTheatres[names.key(theatre.Name)] = i
+		}
+		for _, name := range scraped {
+			if _, ok := knownTheatres[names.key(name)]; !ok {
+				b.Fatal("theatre not found")
+			}
+		}
+	}
+}
+
+// BenchmarkKnownTheatresLinearScan is the same lookup as a scan of state for
+// each scraped theatre, as it was done before the set.
+func BenchmarkKnownTheatresLinearScan(b *testing.B) {
+	names := newTheatreNames(nil, nil)
+	records, scraped := benchmarkTheatres(500)
+	for b.Loop() {
+		for _, name := range scraped {
+			key := names.key(name)
+			if !slices.ContainsFunc(records, func(theatre TheatreRecord) bool { return names.key(theatre.Name) == key }) {
+				b.Fatal("theatre not found")
+			}
+		}
+	}
+}
+
+func TestSaveMoviesToJSONIsStable(t *testing.T) {
+	newMovies := func() []MovieDetails {
+		var movies []MovieDetails
+		for _, code := range []string{"ET00305698", "ET00395817", "ET00123456"} {
+			for _, date := range []string{"20991231", "20991230"} {
+				movie := MovieDetails{Name: "Movie " + code, SlugName: "movie", Code: code, City: "kochi", Date: date}
+				movie.Theatres = []TheatreRecord{{Name: "PVR: Lulu, Kochi"}, {Name: "Cinepolis"}, {Name: "Vanitha Cineplex"}}
+				movie.DateStates = map[string]*DateState{
+					"20991229": {Theatres: []TheatreRecord{{Name: "Shenoys"}, {Name: "Carnival"}}},
+				}
+				movies = append(movies, movie)
+			}
+		}
+		return movies
+	}
+
+	dir := t.TempDir()
+	wantPath := filepath.Join(dir, "want.json")
+	if err := saveMoviesToJSON(wantPath, newMovies(), false); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(wantPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random := rand.New(rand.NewPCG(1, 2))
+	for i := range 20 {
+		movies := newMovies()
+		random.Shuffle(len(movies), func(a, b int) { movies[a], movies[b] = movies[b], movies[a] })
+		for j := range movies {
+			theatres := movies[j].Theatres
+			random.Shuffle(len(theatres), func(a, b int) { theatres[a], theatres[b] = theatres[b], theatres[a] })
+			dated := movies[j].DateStates["20991229"].Theatres
+			random.Shuffle(len(dated), func(a, b int) { dated[a], dated[b] = dated[b], dated[a] })
+		}
+		before := fmt.Sprintf("%+v", movies)
+
+		path := filepath.Join(dir, fmt.Sprintf("shuffled-%d.json", i))
+		if err := saveMoviesToJSON(path, movies, false); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("shuffle %d saved\n%s\nwant\n%s", i, got, want)
+		}
+		if after := fmt.Sprintf("%+v", movies); after != before {
+			t.Errorf("shuffle %d: saving reordered the watchlist itself", i)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var matrixTemplate = template.Must(template.New("matrix").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<h4>{{.Kind.Title}}</h4>
+<p>🎥 Movie: <b>{{.Movie}}</b><br>
+📍 City: <b>{{.City}}</b><br>
+📅 Date: <b>{{.Date}}</b><br>
+{{- if .Theatres}}
+{{- range .Theatres}}
+🏟️ <b>{{.Name}}</b>: {{.ShowCount}} shows{{if .ShowTimes}} ({{join .ShowTimes ", "}}){{end}}<br>
+{{- end}}
+{{- else if .Theatre}}
+🏟️ Theatre: <b>{{.Theatre}}</b><br>
+{{- end}}
+{{- if .ListsShows}}
+{{- if .ShowTimes}}
+🕒 Timings: <b>{{join .ShowTimes ", "}}</b><br>
+{{- end}}
+Shows: <b>{{.ShowCount}}</b>{{if .ShowsIncreased}} (was {{.PreviousShowCount}}){{end}}<br>
+{{- end}}
+{{- with .PriceChange}}
+💰 Price: <b>{{.}}</b><br>
+{{- end}}
+{{- with .FormatChange}}
+🆕 <b>{{.}}</b><br>
+{{- end}}
+{{- with .AvailableSince}}
+⏳ {{.}}<br>
+{{- end}}
+{{- with .Totals}}
+📊 {{.}}<br>
+{{- end}}
+</p>
+<p><a href="{{.BookingURL}}">🎟️ Book Now</a></p>`))
+
+// matrixTxnCounter keeps the transaction IDs of messages sent within the same
+// nanosecond apart.
+var matrixTxnCounter atomic.Int64
+
+// MatrixNotifier posts alerts to a Matrix room through the client-server API
+// of a homeserver.
+type MatrixNotifier struct {
+	// Homeserver is the base URL of the homeserver, e.g.
+	// https://matrix.example.org
+	Homeserver string
+	Token      string
+	RoomID     string
+	Client     *http.Client
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+func (n *MatrixNotifier) Name() string {
+	return "matrix"
+}
+
+func (n *MatrixNotifier) Notify(msg NotificationPayload) error {
+	data := struct {
+		NotificationPayload
+		ListsShows     bool
+		ShowsIncreased bool
+		Totals         string
+		PriceChange    string
+		FormatChange   string
+		AvailableSince string
+	}{
+		NotificationPayload: msg,
+		ListsShows:          msg.Kind != NotificationShowsRemoved && msg.Theatre != "" && len(msg.Theatres) == 0,
+		ShowsIncreased:      msg.Kind == NotificationMoreShows,
+		Totals:              msg.totals(),
+		PriceChange:         msg.priceChange(),
+		FormatChange:        msg.formatChange(),
+		AvailableSince:      msg.availableSince(),
+	}
+
+	var formatted bytes.Buffer
+	if err := matrixTemplate.Execute(&formatted, data); err != nil {
+		return fmt.Errorf("error rendering matrix message: %v", err)
+	}
+
+	theatre := msg.Theatre
+	if len(msg.Theatres) > 0 {
+		theatre = fmt.Sprintf("%d theatres", len(msg.Theatres))
+	} else if theatre == "" {
+		theatre = fmt.Sprintf("%d theatres", msg.TotalTheatres)
+	}
+	payload := map[string]interface{}{
+		"msgtype": "m.text",
+		// Shown by clients that don't render HTML
+		"body":           fmt.Sprintf("%s %s at %s, %s on %s: %s", msg.Kind.Title(), msg.Movie, theatre, msg.City, msg.Date, msg.BookingURL),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted.String(),
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), string(payloadJSON))
+		return nil
+	}
+
+	// The transaction ID makes the homeserver drop a message sent twice by
+	// a retried request
+	txnID := fmt.Sprintf("bms-%d-%d", time.Now().UnixNano(), matrixTxnCounter.Add(1))
+	apiURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(n.Homeserver, "/"), url.PathEscape(n.RoomID), txnID)
+	request, err := http.NewRequest(http.MethodPut, apiURL, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return fmt.Errorf("error creating matrix request: %v", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+n.Token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error making matrix request: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("matrix API error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// metricsRegistry holds only the scraper's own metrics, keeping Go runtime
+// metrics out of the pushgateway.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	moviesCheckedTotal = promauto.With(metricsRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "bms_movies_checked_total",
+		Help: "Movies checked for new shows.",
+	})
+	moviesWithNewShowsTotal = promauto.With(metricsRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "bms_movies_with_new_shows_total",
+		Help: "Movies where at least one new theatre was found.",
+	})
+	notificationsSentTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "bms_notifications_sent_total",
+		Help: "Notifications delivered, by notifier.",
+	}, []string{"notifier"})
+	notificationFailuresTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "bms_notification_failures_total",
+		Help: "Notifications that failed to send, by notifier.",
+	}, []string{"notifier"})
+	scrapeErrorsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "bms_scrape_errors_total",
+		Help: "Failed booking page scrapes, by movie and error type.",
+	}, []string{"movie", "error_type"})
+	theatreListScrolls = promauto.With(metricsRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "bms_theatre_list_scrolls",
+		Help:    "Scroll steps taken to load the theatre list of a booking page.",
+		Buckets: []float64{0, 1, 2, 5, 10, 20, maxTheatreScrolls},
+	})
+	theatreListShortTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "bms_theatre_list_short_total",
+		Help: "Theatre lists that had fewer theatres than their page said, by movie.",
+	}, []string{"movie"})
+	scrapeDurationSeconds = promauto.With(metricsRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "bms_scrape_duration_seconds",
+		Help: "Duration of the last scrape run.",
+	})
+)
+
+// serveMetrics exposes the metrics for Prometheus to scrape on addr.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	logger.WithField("addr", addr).Info("Serving metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.WithError(err).Error("Error serving metrics")
+	}
+}
+
+// pushMetrics sends the final values of a run to a Prometheus pushgateway,
+// since a one-shot run usually exits before it gets scraped.
+func pushMetrics(url string) error {
+	return push.New(url, "bms_scraper").Gatherer(metricsRegistry).Push()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/sirupsen/logrus"
+)
+
+// logNetworkResponses logs the status and URL of every XHR and fetch response
+// page receives at debug level, to tell whether BookMyShow answered the
+// booking page's API calls with real theatres or an error, until the returned
+// func is called. The date isn't logged, since with date tabs one page loads
+// several, but it is in the URLs.
+func logNetworkResponses(page *rod.Page, movie *MovieDetails, city CityDetails) func() {
+	ctx, cancel := context.WithCancel(page.GetContext())
+	wait := page.Context(ctx).EachEvent(func(e *proto.NetworkResponseReceived) {
+		if e.Type != proto.NetworkResourceTypeXHR && e.Type != proto.NetworkResourceTypeFetch {
+			return
+		}
+		logger.WithFields(logrus.Fields{
+			"movie":  movie.Name,
+			"city":   city.City,
+			"type":   e.Type,
+			"status": e.Response.Status,
+			"mime":   e.Response.MIMEType,
+			"bytes":  e.Response.EncodedDataLength,
+			"url":    e.Response.URL,
+		}).Debug("Network response")
+	})
+	go wait()
+	return cancel
+}
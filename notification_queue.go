@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// notificationQueueSize is how many alerts can wait to be sent before
+// enqueueing another blocks the scrape.
+const notificationQueueSize = 100
+
+// queuedNotification is an alert waiting to be sent, with the change to the
+// state of its movie's city and date that is made once it was delivered.
+type queuedNotification struct {
+	index       int
+	movie       *MovieDetails
+	city        string
+	date        string
+	payload     NotificationPayload
+	newTheatres int
+	apply       func(state *DateState)
+}
+
+// NotificationQueue sends alerts from a goroutine of its own, so a slow
+// notifier doesn't hold up scraping. Delivered alerts are only written to the
+// watchlist by Flush, from the goroutine that owns it, so like before a failed
+// alert leaves state as it was and is retried next run. That is also how alerts
+// are held back during quiet hours.
+type NotificationQueue struct {
+	cfg      *Config
+	notifier *MultiNotifier
+	queue    chan queuedNotification
+	done     chan struct{}
+
+	mu        sync.Mutex
+	delivered []queuedNotification
+}
+
+// newNotificationQueue starts sending the alerts queued for the run.
+func newNotificationQueue(cfg *Config) *NotificationQueue {
+	q := &NotificationQueue{
+		cfg:      cfg,
+		notifier: &MultiNotifier{Notifiers: cfg.Notifiers},
+		queue:    make(chan queuedNotification, notificationQueueSize),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *NotificationQueue) run() {
+	defer close(q.done)
+	sent := 0
+	for notification := range q.queue {
+		fields := logrus.Fields{
+			"movie":   notification.movie.Name,
+			"city":    notification.city,
+			"date":    notification.date,
+			"kind":    notification.payload.Kind.Title(),
+			"theatre": notification.payload.Theatre,
+		}
+		if quiet := q.cfg.QuietHours; quiet != nil && quiet.contains(time.Now()) {
+			if quiet.Drop {
+				logger.WithFields(fields).Info("Quiet hours, recording alert without sending it")
+				q.mu.Lock()
+				q.delivered = append(q.delivered, notification)
+				q.mu.Unlock()
+			} else {
+				logger.WithFields(fields).Info("Quiet hours, holding alert back until they end")
+			}
+			continue
+		}
+		// An alert delivered by a run that crashed before saving its state
+		// comes up again, but only its state change is still missing
+		key := deliveryKey(notification.payload)
+		if deliveries != nil && !q.cfg.DryRun && !q.cfg.Preview && deliveries.Recent(key, time.Now(), q.cfg.DeliveryDedupWindow) {
+			logger.WithFields(fields).Info("Alert was already delivered, recording it without sending it again")
+			q.mu.Lock()
+			q.delivered = append(q.delivered, notification)
+			q.mu.Unlock()
+			continue
+		}
+		// That many alerts in one run more likely means stale selectors or
+		// lost state than theatres opening, so past the cap they are only
+		// logged, and stay unrecorded for the next run
+		if q.cfg.MaxNotificationsPerRun > 0 && sent >= q.cfg.MaxNotificationsPerRun {
+			if sent == q.cfg.MaxNotificationsPerRun {
+				alertNotificationCap(q.cfg)
+				sent++
+			}
+			logger.WithFields(fields).Warn("Notification cap reached, not sending alert")
+			continue
+		}
+		sent++
+		payload := notification.payload
+		// A dry run doesn't create links with the shortener either
+		if q.cfg.Shortener != nil && payload.BookingURL != "" && !q.cfg.DryRun {
+			payload.BookingURL = shortenBookingURL(q.cfg.Shortener, payload.BookingURL)
+		}
+		if err := q.notifier.Notify(payload); err == nil {
+			// Saved straight away, a crash is what the log is for
+			if deliveries != nil && !q.cfg.DryRun && !q.cfg.Preview {
+				deliveries.Record(key, time.Now())
+				if err := deliveries.Save(q.cfg.DeliveryDedupWindow); err != nil {
+					logger.WithError(err).Error("Error saving delivery log")
+				}
+			}
+			q.mu.Lock()
+			q.delivered = append(q.delivered, notification)
+			q.mu.Unlock()
+		}
+	}
+}
+
+// deliveryKey identifies an alert in the delivery log by what it announces, so
+// the same alert raised again by a later run has the same key.
+func deliveryKey(payload NotificationPayload) string {
+	parts := []string{
+		payload.Kind.Title(), payload.Movie, payload.City, payload.Date, payload.Theatre,
+		strconv.Itoa(payload.ShowCount), formatPrice(payload.Price),
+	}
+	parts = append(parts, payload.NewFormats...)
+	for _, theatre := range payload.Theatres {
+		parts = append(parts, theatre.Name, strconv.Itoa(theatre.ShowCount))
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(hash[:])
+}
+
+// forMovie returns what queues the alerts about the movie at index in the
+// watchlist.
+func (q *NotificationQueue) forMovie(index int, movie *MovieDetails) movieNotifications {
+	return movieNotifications{queue: q, index: index, movie: movie}
+}
+
+// Flush waits for every queued alert to be sent, then applies the delivered
+// ones to their entries of moviesList and marks the entries that reached their
+// FoundThreshold found. Nothing can be queued after it.
+func (q *NotificationQueue) Flush(moviesList []MovieDetails) {
+	close(q.queue)
+	<-q.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	foundNewShows := make(map[int]bool)
+	for _, notification := range q.delivered {
+		movie := &moviesList[notification.index]
+		notification.apply(movie.dateState(notification.city, notification.date))
+		if notification.newTheatres > 0 {
+			runCounts.theatresAdded.Add(int64(notification.newTheatres))
+			foundNewShows[notification.index] = true
+		}
+	}
+
+	for index := range foundNewShows {
+		movie := &moviesList[index]
+		moviesWithNewShowsTotal.Inc()
+		runCounts.moviesWithNewShows.Add(1)
+
+		if movie.StopOnFirstFind || movie.RemoveWhenFound {
+			movie.Found = true
+			logger.WithField("movie", movie.Name).Info("Found new shows, no longer watching the movie")
+		}
+	}
+
+	// Theatres recorded without an alert count too, so every movie is
+	// checked rather than only those with delivered alerts
+	for i := range moviesList {
+		movie := &moviesList[i]
+		if movie.Found || movie.FoundThreshold == 0 {
+			continue
+		}
+		if theatres := movie.trackedTheatres(); theatres >= movie.FoundThreshold {
+			movie.Found = true
+			logger.WithFields(logrus.Fields{
+				"movie":     movie.Name,
+				"theatres":  theatres,
+				"threshold": movie.FoundThreshold,
+			}).Info("Movie reached its found threshold, no longer watching it")
+		}
+	}
+}
+
+// movieNotifications queues the alerts about one movie of the watchlist.
+type movieNotifications struct {
+	queue *NotificationQueue
+	index int
+	movie *MovieDetails
+	// posterURL is the poster read off the booking page, for movies
+	// without poster_url
+	posterURL string
+}
+
+// send queues payload about the movie in city on date, with the poster of the
+// movie. Once it was delivered, apply makes the change it announced to their
+// state, and newTheatres is counted as added.
+func (n movieNotifications) send(city string, date string, payload NotificationPayload, newTheatres int, apply func(state *DateState)) {
+	if payload.PosterURL == "" {
+		payload.PosterURL = n.movie.PosterURL
+	}
+	if payload.PosterURL == "" {
+		payload.PosterURL = n.posterURL
+	}
+	logger.WithFields(logrus.Fields{
+		"movie":   n.movie.Name,
+		"city":    city,
+		"date":    date,
+		"kind":    payload.Kind.Title(),
+		"pending": len(n.queue.queue),
+	}).Debug("Queueing notification")
+
+	n.queue.queue <- queuedNotification{
+		index:       n.index,
+		movie:       n.movie,
+		city:        city,
+		date:        date,
+		payload:     payload,
+		newTheatres: newTheatres,
+		apply:       apply,
+	}
+}
+
+// shortenBookingURL returns the short URL of bookingURL, or bookingURL itself
+// when shortener fails, so an outage of the shortener never holds up alerts.
+func shortenBookingURL(shortener *URLShortener, bookingURL string) string {
+	shortURL, err := shortener.Shorten(bookingURL)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url":   bookingURL,
+			"error": err,
+		}).Warn("Error shortening booking URL, sending the full one")
+		return bookingURL
+	}
+	return shortURL
+}
+
+// alertNotificationCap tells the Telegram chat of cfg that the run reached
+// MAX_NOTIFICATIONS_PER_RUN. Like the blocked alert it goes through Telegram
+// alone.
+func alertNotificationCap(cfg *Config) {
+	logger.WithField("cap", cfg.MaxNotificationsPerRun).Error("Notification cap reached, something may be wrong")
+
+	payload := NotificationPayload{
+		Kind:            NotificationCapReached,
+		NotificationCap: cfg.MaxNotificationsPerRun,
+	}
+	for _, notifier := range cfg.Notifiers {
+		if notifier.Name() != "telegram" {
+			continue
+		}
+		if err := notifier.Notify(payload); err != nil {
+			logger.WithError(err).Error("Error sending notification cap alert")
+		}
+	}
+}
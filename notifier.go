@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NotificationKind tells notifiers what happened to the theatre in a payload.
+type NotificationKind int
+
+const (
+	// NotificationNewShow is sent when a theatre starts listing shows.
+	NotificationNewShow NotificationKind = iota
+	// NotificationShowsRemoved is sent when a previously seen theatre no
+	// longer lists any shows.
+	NotificationShowsRemoved
+	// NotificationMoreShows is sent when a known theatre lists more shows
+	// than it did before.
+	NotificationMoreShows
+	// NotificationBlocked is sent to the operator when BookMyShow answers
+	// with a bot challenge instead of the booking page.
+	NotificationBlocked
+	// NotificationSummary is sent at the end of a run with what it found,
+	// when SEND_SUMMARY is set.
+	NotificationSummary
+	// NotificationPriceChanged is sent when the cheapest ticket of a known
+	// theatre costs something else than on the previous scrape.
+	NotificationPriceChanged
+	// NotificationCapReached is sent once in a run that hit
+	// MAX_NOTIFICATIONS_PER_RUN, in place of the alerts past the cap.
+	NotificationCapReached
+	// NotificationMovieFailing is sent to the operator when a movie failed
+	// to scrape MOVIE_ERROR_ALERT_AFTER runs in a row.
+	NotificationMovieFailing
+	// NotificationBookingOpened is sent when the booking page of a date
+	// lists theatres for the first time, with NOTIFY_BOOKING_OPEN set.
+	NotificationBookingOpened
+	// NotificationSoldOut is sent when every show of a date that had
+	// bookable ones sold out, with NOTIFY_SOLD_OUT set.
+	NotificationSoldOut
+	// NotificationNewFormat is sent when a known theatre lists shows in a
+	// format it was never seen with, with NOTIFY_NEW_FORMATS set.
+	NotificationNewFormat
+)
+
+// Title returns the headline notifiers show for this kind of alert.
+func (k NotificationKind) Title() string {
+	switch k {
+	case NotificationShowsRemoved:
+		return "❌ Shows Removed"
+	case NotificationMoreShows:
+		return "🔼 More shows added"
+	case NotificationBlocked:
+		return "🚫 Blocked by BookMyShow"
+	case NotificationSummary:
+		return "📊 Run Summary"
+	case NotificationPriceChanged:
+		return "💰 Price changed"
+	case NotificationCapReached:
+		return "⚠️ Notification cap reached"
+	case NotificationMovieFailing:
+		return "🔁 Movie keeps failing"
+	case NotificationBookingOpened:
+		return "🎟️ Bookings open"
+	case NotificationSoldOut:
+		return "🔥 Fully sold out"
+	case NotificationNewFormat:
+		return "🆕 New format available"
+	default:
+		return "🎬 New Show Added!"
+	}
+}
+
+// sampleNotification is the alert custom templates are rendered with when they
+// are loaded, so a broken one is caught before anything is scraped.
+var sampleNotification = NotificationPayload{
+	Kind:       NotificationNewShow,
+	Movie:      "Empuraan",
+	City:       "kochi",
+	Date:       "27-03-2025",
+	Theatre:    "PVR Lulu",
+	ShowCount:  2,
+	ShowTimes:  []string{"10:30 AM", "2:15 PM"},
+	BookingURL: "https://in.bookmyshow.com",
+}
+
+// NotificationPayload carries everything known about a show alert so each
+// notifier can render it in its platform's native format.
+type NotificationPayload struct {
+	Kind       NotificationKind
+	Movie      string
+	City       string
+	Date       string
+	Theatre    string
+	ShowCount  int
+	ShowTimes  []string
+	BookingURL string
+
+	// PreviousShowCount is the show count before the increase, only set for
+	// NotificationMoreShows.
+	PreviousShowCount int
+
+	// PreviousPrice and Price are the cheapest ticket of the theatre before
+	// and after the change, only set for NotificationPriceChanged.
+	PreviousPrice float64
+	Price         float64
+
+	// NewFormats are the formats the theatre lists shows in for the first
+	// time, only set for NotificationNewFormat.
+	NewFormats []string
+
+	// FirstSeen is when a known theatre was first recorded, for alerts about
+	// a change to one. It is zero for the other kinds and for theatres
+	// recorded before it was kept.
+	FirstSeen time.Time
+
+	// TotalTheatres and TotalShows count every theatre scraped for the movie
+	// and date, and their shows, for alerts about theatres showing it. They
+	// are zero for the other kinds.
+	TotalTheatres int
+	TotalShows    int
+
+	// Theatres lists every theatre of a batched NotificationNewShow, which
+	// leaves Theatre, ShowCount and ShowTimes unset.
+	Theatres []TheatreSummary
+
+	// Summary holds the counts of a NotificationSummary, which leaves the
+	// show fields unset.
+	Summary RunSummary
+
+	// NotificationCap is the MAX_NOTIFICATIONS_PER_RUN a
+	// NotificationCapReached was sent for.
+	NotificationCap int
+
+	// ConsecutiveErrors and LastError are how many runs in a row the movie
+	// of a NotificationMovieFailing failed, and the latest error.
+	ConsecutiveErrors int
+	LastError         string
+
+	// ChatID overrides the Telegram chat the alert is sent to when set.
+	ChatID string
+
+	// PosterURL is the image of the movie, shown by the notifiers that can
+	// when it is set.
+	PosterURL string
+}
+
+// TheatreSummary is one of the theatres of a batched alert.
+type TheatreSummary struct {
+	Name      string
+	ShowCount int
+	ShowTimes []string
+}
+
+// totals describes how widely the movie is showing on the date, or returns ""
+// when the payload doesn't carry totals.
+func (p NotificationPayload) totals() string {
+	if p.TotalTheatres == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Now showing in %d theatres, %d shows total", p.TotalTheatres, p.TotalShows)
+}
+
+// priceChange describes the price change of a NotificationPriceChanged, or
+// returns "" for the other kinds.
+func (p NotificationPayload) priceChange() string {
+	if p.Kind != NotificationPriceChanged {
+		return ""
+	}
+	return fmt.Sprintf("%s (was %s)", formatPrice(p.Price), formatPrice(p.PreviousPrice))
+}
+
+// formatChange describes the formats of a NotificationNewFormat, or returns
+// "" for the other kinds.
+func (p NotificationPayload) formatChange() string {
+	if p.Kind != NotificationNewFormat {
+		return ""
+	}
+	return strings.Join(p.NewFormats, ", ") + " now available"
+}
+
+// availableSince describes how long the theatre has been listed, or returns ""
+// when the payload doesn't say.
+func (p NotificationPayload) availableSince() string {
+	if p.FirstSeen.IsZero() {
+		return ""
+	}
+	return "Available since " + formatAge(time.Since(p.FirstSeen))
+}
+
+// formatAge renders age roughly, like "3 hours ago" or "2 days ago".
+func formatAge(age time.Duration) string {
+	count, unit := int(age.Hours()/24), "day"
+	switch {
+	case age < time.Hour:
+		count, unit = int(age.Minutes()), "minute"
+	case age < 48*time.Hour:
+		count, unit = int(age.Hours()), "hour"
+	}
+	if count != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s ago", count, unit)
+}
+
+// formatPrice renders a ticket price in rupees.
+func formatPrice(price float64) string {
+	return "₹" + strconv.FormatFloat(price, 'f', -1, 64)
+}
+
+// Notifier delivers show alerts to a single destination.
+type Notifier interface {
+	// Name identifies the notifier in logs.
+	Name() string
+	Notify(msg NotificationPayload) error
+}
+
+// MultiNotifier sends every alert through all of Notifiers. One of them
+// failing doesn't keep the alert from the others, and only counts as a failed
+// alert, which is retried next run, when none of them delivered it.
+type MultiNotifier struct {
+	Notifiers []Notifier
+}
+
+func (n *MultiNotifier) Name() string {
+	return "multi"
+}
+
+// Notify logs every notifier that failed, and returns their errors joined when
+// all of them did.
+func (n *MultiNotifier) Notify(msg NotificationPayload) error {
+	var errs []error
+	for _, notifier := range n.Notifiers {
+		if err := notifier.Notify(msg); err != nil {
+			notificationFailuresTotal.WithLabelValues(notifier.Name()).Inc()
+			logger.WithFields(logrus.Fields{
+				"movie":    msg.Movie,
+				"theatre":  msg.Theatre,
+				"notifier": notifier.Name(),
+				"error":    err,
+			}).Error("Error sending notification")
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+			continue
+		}
+		notificationsSentTotal.WithLabelValues(notifier.Name()).Inc()
+	}
+
+	if len(errs) == len(n.Notifiers) {
+		return errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		logger.WithFields(logrus.Fields{
+			"movie":     msg.Movie,
+			"theatre":   msg.Theatre,
+			"failed":    len(errs),
+			"notifiers": len(n.Notifiers),
+		}).Warn("Notification delivered by some notifiers only")
+	}
+	return nil
+}
+
+// truncateLines cuts text down to limit, as measured by length, by dropping
+// whole lines from its end and saying how many went in their place. Cutting
+// between lines keeps the formatting of each kept line intact. A first line
+// that is too long on its own is cut short with an ellipsis.
+func truncateLines(text string, limit int, length func(string) int) string {
+	if length(text) <= limit {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for kept := len(lines) - 1; kept > 0; kept-- {
+		truncated := strings.Join(lines[:kept], "\n") + fmt.Sprintf("\n…and %d more", len(lines)-kept)
+		if length(truncated) <= limit {
+			return truncated
+		}
+	}
+	runes := []rune(lines[0])
+	for len(runes) > 0 && length(string(runes)+"…") > limit {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// byteLength is a length for truncateLines measuring in bytes, for platforms
+// whose limits are in bytes rather than characters.
+func byteLength(text string) int {
+	return len(text)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		limit  int
+		length func(string) int
+		want   string
+	}{
+		{
+			name:   "fits",
+			text:   "one\ntwo\nthree",
+			limit:  13,
+			length: utf8.RuneCountInString,
+			want:   "one\ntwo\nthree",
+		},
+		{
+			name:   "drops whole lines",
+			text:   "one\ntwo\nthree\nfour",
+			limit:  17,
+			length: utf8.RuneCountInString,
+			want:   "one\n…and 3 more",
+		},
+		{
+			name:   "long first line",
+			text:   "a very long first line\ntwo",
+			limit:  8,
+			length: utf8.RuneCountInString,
+			want:   "a very …",
+		},
+		{
+			name:   "counts bytes",
+			text:   "🎥 one\n🎥 two\n🎥 three",
+			limit:  22,
+			length: byteLength,
+			want:   "🎥 one\n…and 2 more",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateLines(tt.text, tt.limit, tt.length)
+			if got != tt.want {
+				t.Errorf("truncateLines() = %q, want %q", got, tt.want)
+			}
+			if tt.length(got) > tt.limit {
+				t.Errorf("truncateLines() is %d long, over the limit of %d", tt.length(got), tt.limit)
+			}
+		})
+	}
+}
+
+func TestTruncateLinesKeepsLinesIntact(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, "🏟️ *Theatre* with a long enough name to add up")
+	}
+	got := truncateLines(strings.Join(lines, "\n"), 1000, utf8.RuneCountInString)
+	kept := strings.Split(got, "\n")
+	marker := kept[len(kept)-1]
+	if !strings.HasPrefix(marker, "…and ") || !strings.HasSuffix(marker, " more") {
+		t.Fatalf("last line = %q, want the count of dropped lines", marker)
+	}
+	for _, line := range kept[:len(kept)-1] {
+		if line != lines[0] {
+			t.Errorf("kept line %q, want only whole lines", line)
+		}
+	}
+}
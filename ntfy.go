@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// defaultNtfyServer is the server alerts are published to when NTFY_SERVER
+// isn't set.
+const defaultNtfyServer = "https://ntfy.sh"
+
+// ntfyMessageLimit is the longest message ntfy.sh shows as a notification, in
+// bytes. Longer ones become an attachment.
+const ntfyMessageLimit = 4096
+
+// ntfyTags are the tags of each kind of alert, which ntfy shows as emojis
+// in front of the title.
+var ntfyTags = map[NotificationKind]string{
+	NotificationNewShow:       "clapper",
+	NotificationMoreShows:     "arrow_up_small",
+	NotificationShowsRemoved:  "x",
+	NotificationPriceChanged:  "moneybag",
+	NotificationBookingOpened: "tickets",
+	NotificationSoldOut:       "fire",
+	NotificationNewFormat:     "new",
+}
+
+// NtfyNotifier publishes alerts to an ntfy topic as push notifications with a
+// button opening the booking page.
+type NtfyNotifier struct {
+	Server string
+	Topic  string
+	// Token, or User and Pass, authenticate to servers with access control.
+	// Public topics need neither.
+	Token  string
+	User   string
+	Pass   string
+	Client *http.Client
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+func (n *NtfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n *NtfyNotifier) Notify(msg NotificationPayload) error {
+	lines := []string{
+		fmt.Sprintf("🎥 %s", msg.Movie),
+		fmt.Sprintf("📍 %s, 📅 %s", msg.City, msg.Date),
+	}
+	if len(msg.Theatres) > 0 {
+		for _, theatre := range msg.Theatres {
+			lines = append(lines, fmt.Sprintf("🏟️ %s: %d shows", theatre.Name, theatre.ShowCount))
+		}
+	} else if msg.Theatre != "" {
+		lines = append(lines, "🏟️ "+msg.Theatre)
+		if msg.Kind != NotificationShowsRemoved {
+			if len(msg.ShowTimes) > 0 {
+				lines = append(lines, "🕒 "+strings.Join(msg.ShowTimes, ", "))
+			}
+			shows := fmt.Sprintf("Shows: %d", msg.ShowCount)
+			if msg.Kind == NotificationMoreShows {
+				shows += fmt.Sprintf(" (was %d)", msg.PreviousShowCount)
+			}
+			lines = append(lines, shows)
+			if change := msg.priceChange(); change != "" {
+				lines = append(lines, "💰 "+change)
+			}
+			if change := msg.formatChange(); change != "" {
+				lines = append(lines, "🆕 "+change)
+			}
+			if since := msg.availableSince(); since != "" {
+				lines = append(lines, "⏳ "+since)
+			}
+		}
+	}
+	if totals := msg.totals(); totals != "" {
+		lines = append(lines, "📊 "+totals)
+	}
+	body := truncateLines(strings.Join(lines, "\n"), ntfyMessageLimit, byteLength)
+
+	// New theatres are what the alerts are for, removed ones matter least
+	priority := "default"
+	switch msg.Kind {
+	case NotificationNewShow, NotificationBookingOpened:
+		priority = "high"
+	case NotificationShowsRemoved:
+		priority = "low"
+	}
+
+	headers := map[string]string{
+		// Header values have to be ASCII, ntfy decodes RFC 2047 titles
+		"Title":    mime.BEncoding.Encode("utf-8", msg.Kind.Title()),
+		"Priority": priority,
+		"Tags":     ntfyTags[msg.Kind],
+		"Click":    msg.BookingURL,
+		"Actions":  "view, Book Now, " + msg.BookingURL,
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), fmt.Sprintf("%v\n%s", headers, body))
+		return nil
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimRight(n.Server, "/")+"/"+n.Topic, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating ntfy request: %v", err)
+	}
+	for name, value := range headers {
+		if value != "" {
+			request.Header.Set(name, value)
+		}
+	}
+	if n.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+n.Token)
+	} else if n.User != "" {
+		request.SetBasicAuth(n.User, n.Pass)
+	}
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error making ntfy request: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("ntfy API error: %s: %s", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// PageController is the part of a browser page the scraper drives, so the
+// code that loads and reads booking pages doesn't depend on Chromium itself.
+type PageController interface {
+	Navigate(url string) error
+	// WaitDOMStable waits until the DOM changes by no more than diff over d
+	WaitDOMStable(d time.Duration, diff float64) error
+	// Element waits for the first element matching selector to appear
+	Element(selector string) (ElementController, error)
+	// Elements returns the elements matching selector without waiting
+	Elements(selector string) ([]ElementController, error)
+	// Text returns the title and the visible text of the page
+	Text() (string, string, error)
+	// URL returns the URL the page is at, after any redirects
+	URL() (string, error)
+	// Timeout returns the page with its calls bounded by d, and the func
+	// that releases the timeout
+	Timeout(d time.Duration) (PageController, func())
+	// Context is done once the scrape of the page is cancelled
+	Context() context.Context
+	// Screenshot returns a PNG of the part of the page in view
+	Screenshot() ([]byte, error)
+}
+
+// ElementController is the part of a page element the scraper reads.
+type ElementController interface {
+	// Element returns the first descendant matching selector, without
+	// waiting for one to appear
+	Element(selector string) (ElementController, error)
+	Elements(selector string) ([]ElementController, error)
+	Text() (string, error)
+	Matches(selector string) (bool, error)
+	// Attribute returns the value of the attribute name, nil when the
+	// element doesn't have it
+	Attribute(name string) (*string, error)
+	// Link returns the URL of the link on or around the element, empty when
+	// there is none
+	Link() (string, error)
+	// ScrollDown scrolls the list the element is in, or the page when the
+	// list itself doesn't scroll, down by a screen and reports whether it
+	// moved
+	ScrollDown() (bool, error)
+	// Click clicks the element with the left mouse button
+	Click() error
+	// WaitStable waits up to timeout for the page of the element to stay
+	// unchanged for d
+	WaitStable(d time.Duration, timeout time.Duration) error
+	// Timeout returns the element with its calls, and those of the
+	// elements found through it, bounded by d, and the func that releases
+	// the timeout
+	Timeout(d time.Duration) (ElementController, func())
+}
+
+// PageSource opens the pages booking pages are scraped in.
+type PageSource interface {
+	// OpenPage opens a page for scraping movie in city on date from
+	// bookingURL, bound by ctx. The returned func closes it, and has to be
+	// called even when opening failed.
+	OpenPage(ctx context.Context, cfg *Config, movie *MovieDetails, city CityDetails, date string, bookingURL string) (PageController, func(), error)
+}
+
+// browserPages is the PageSource of fresh pages of a rod browser.
+type browserPages struct {
+	browser *rod.Browser
+}
+
+func (b browserPages) OpenPage(ctx context.Context, cfg *Config, movie *MovieDetails, city CityDetails, date string, bookingURL string) (PageController, func(), error) {
+	page, closePage, err := openBookingPage(ctx, cfg, b.browser, movie, city, date, bookingURL)
+	if err != nil {
+		return nil, closePage, err
+	}
+	return newRodPage(page), closePage, nil
+}
+
+// rodPage is a PageController for a page of the rod browser.
+type rodPage struct {
+	page *rod.Page
+	// base is the context of the page before any timeout, which elements
+	// found on it are moved back to so they outlive the timeout
+	base context.Context
+}
+
+// newRodPage returns the PageController of page.
+func newRodPage(page *rod.Page) *rodPage {
+	return &rodPage{page: page, base: page.GetContext()}
+}
+
+func (p *rodPage) Navigate(url string) error {
+	return p.page.Navigate(url)
+}
+
+func (p *rodPage) WaitDOMStable(d time.Duration, diff float64) error {
+	return p.page.WaitDOMStable(d, diff)
+}
+
+func (p *rodPage) Element(selector string) (ElementController, error) {
+	element, err := p.page.Element(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &rodElement{element: element.Context(p.base)}, nil
+}
+
+func (p *rodPage) Elements(selector string) ([]ElementController, error) {
+	elements, err := p.page.Elements(selector)
+	if err != nil {
+		return nil, err
+	}
+	for i, element := range elements {
+		elements[i] = element.Context(p.base)
+	}
+	return rodElements(elements), nil
+}
+
+func (p *rodPage) Text() (string, string, error) {
+	result, err := p.page.Eval(`() => [document.title, document.body ? document.body.innerText : ""]`)
+	if err != nil {
+		return "", "", err
+	}
+	return result.Value.Get("0").Str(), result.Value.Get("1").Str(), nil
+}
+
+func (p *rodPage) URL() (string, error) {
+	info, err := p.page.Info()
+	if err != nil {
+		return "", err
+	}
+	return info.URL, nil
+}
+
+func (p *rodPage) Timeout(d time.Duration) (PageController, func()) {
+	page := p.page.Timeout(d)
+	return &rodPage{page: page, base: p.base}, func() { page.CancelTimeout() }
+}
+
+func (p *rodPage) Context() context.Context {
+	return p.page.GetContext()
+}
+
+func (p *rodPage) Screenshot() ([]byte, error) {
+	return p.page.Screenshot(false, nil)
+}
+
+// rodElement is an ElementController for an element of a rod page.
+type rodElement struct {
+	element *rod.Element
+}
+
+// rodElements wraps every element of elements as an ElementController.
+func rodElements(elements rod.Elements) []ElementController {
+	controllers := make([]ElementController, 0, len(elements))
+	for _, element := range elements {
+		controllers = append(controllers, &rodElement{element: element})
+	}
+	return controllers
+}
+
+func (e *rodElement) Element(selector string) (ElementController, error) {
+	element, err := e.element.Sleeper(rod.NotFoundSleeper).Element(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &rodElement{element: element}, nil
+}
+
+func (e *rodElement) Elements(selector string) ([]ElementController, error) {
+	elements, err := e.element.Elements(selector)
+	if err != nil {
+		return nil, err
+	}
+	return rodElements(elements), nil
+}
+
+func (e *rodElement) Text() (string, error) {
+	return e.element.Text()
+}
+
+func (e *rodElement) Matches(selector string) (bool, error) {
+	return e.element.Matches(selector)
+}
+
+func (e *rodElement) Attribute(name string) (*string, error) {
+	return e.element.Attribute(name)
+}
+
+func (e *rodElement) Link() (string, error) {
+	result, err := e.element.Eval(`() => {
+		const link = this.closest("a[href]") || this.querySelector("a[href]");
+		return link ? link.href : "";
+	}`)
+	if err != nil {
+		return "", err
+	}
+	return result.Value.Str(), nil
+}
+
+func (e *rodElement) ScrollDown() (bool, error) {
+	result, err := e.element.Eval(`() => {
+		const grid = this.closest(".ReactVirtualized__Grid") || this.parentElement;
+		const scroller = grid && grid.scrollHeight > grid.clientHeight ? grid : document.scrollingElement;
+		const before = scroller.scrollTop;
+		scroller.scrollTop += scroller.clientHeight || window.innerHeight;
+		return scroller.scrollTop > before;
+	}`)
+	if err != nil {
+		return false, err
+	}
+	return result.Value.Bool(), nil
+}
+
+func (e *rodElement) Click() error {
+	return e.element.Click(proto.InputMouseButtonLeft, 1)
+}
+
+func (e *rodElement) WaitStable(d time.Duration, timeout time.Duration) error {
+	page := e.element.Page().Timeout(timeout)
+	defer page.CancelTimeout()
+	return page.WaitDOMStable(d, 0)
+}
+
+func (e *rodElement) Timeout(d time.Duration) (ElementController, func()) {
+	element := e.element.Timeout(d)
+	return &rodElement{element: element}, func() { element.CancelTimeout() }
+}
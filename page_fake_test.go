@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errFakeNotFound is returned by the fake page and its elements when nothing
+// matches a selector, where rod would wait for a match until it times out.
+var errFakeNotFound = errors.New("no element matches the selector")
+
+// htmlNode is an element of a parsed HTML document, or a text node when tag
+// is empty.
+type htmlNode struct {
+	tag      string
+	attrs    map[string]string
+	text     string
+	parent   *htmlNode
+	children []*htmlNode
+}
+
+// parseHTML parses src into a tree under a root node, as leniently as
+// encoding/xml allows, which is enough for the saved booking pages.
+func parseHTML(src string) (*htmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(src))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	root := &htmlNode{tag: "#document"}
+	current := root
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing HTML: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			node := &htmlNode{tag: strings.ToLower(token.Name.Local), attrs: make(map[string]string), parent: current}
+			for _, attr := range token.Attr {
+				node.attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			current.children = append(current.children, node)
+			current = node
+		case xml.EndElement:
+			// Close up to the matching element, leaving stray end tags alone
+			tag := strings.ToLower(token.Name.Local)
+			for node := current; node != root; node = node.parent {
+				if node.tag == tag {
+					current = node.parent
+					break
+				}
+			}
+		case xml.CharData:
+			current.children = append(current.children, &htmlNode{text: string(token), parent: current})
+		}
+	}
+}
+
+// innerText joins the text under n a line per text node, roughly like a
+// browser's innerText.
+func (n *htmlNode) innerText() string {
+	var lines []string
+	var walk func(*htmlNode)
+	walk = func(node *htmlNode) {
+		if node.tag == "" {
+			if line := strings.Join(strings.Fields(node.text), " "); line != "" {
+				lines = append(lines, line)
+			}
+			return
+		}
+		if node.tag == "script" || node.tag == "style" || node.tag == "title" {
+			return
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(lines, "\n")
+}
+
+// find returns the elements under n that match selector, in document order.
+func (n *htmlNode) find(selector string) ([]*htmlNode, error) {
+	groups, err := parseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	var found []*htmlNode
+	var walk func(*htmlNode)
+	walk = func(node *htmlNode) {
+		for _, child := range node.children {
+			if child.tag == "" {
+				continue
+			}
+			if groups.matches(child) {
+				found = append(found, child)
+			}
+			walk(child)
+		}
+	}
+	walk(n)
+	return found, nil
+}
+
+// selectorGroup is a comma separated list of selectors, each a list of
+// compound selectors joined by the descendant combinator.
+type selectorGroup [][]compoundSelector
+
+// compoundSelector is the part of a selector that matches a single element.
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+// attrSelector matches an attribute, by presence when op is empty.
+type attrSelector struct {
+	name  string
+	op    string
+	value string
+}
+
+// parseSelector parses the CSS the scraper's selectors are written in: tags,
+// ids, classes, attribute tests and descendant combinators.
+func parseSelector(selector string) (selectorGroup, error) {
+	var group selectorGroup
+	for _, part := range strings.Split(selector, ",") {
+		var chain []compoundSelector
+		for _, field := range strings.Fields(part) {
+			compound, err := parseCompound(field)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing selector %q: %v", selector, err)
+			}
+			chain = append(chain, compound)
+		}
+		if len(chain) == 0 {
+			return nil, fmt.Errorf("error parsing selector %q: empty selector", selector)
+		}
+		group = append(group, chain)
+	}
+	return group, nil
+}
+
+func parseCompound(s string) (compoundSelector, error) {
+	var compound compoundSelector
+	name := func() string {
+		end := strings.IndexAny(s, ".#[")
+		if end < 0 {
+			end = len(s)
+		}
+		value := s[:end]
+		s = s[end:]
+		return value
+	}
+	compound.tag = strings.ToLower(name())
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			compound.classes = append(compound.classes, name())
+		case '#':
+			s = s[1:]
+			compound.id = name()
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return compound, errors.New("unclosed attribute selector")
+			}
+			compound.attrs = append(compound.attrs, parseAttrSelector(s[1:end]))
+			s = s[end+1:]
+		}
+	}
+	return compound, nil
+}
+
+func parseAttrSelector(s string) attrSelector {
+	for _, op := range []string{"*=", "^=", "$=", "~=", "="} {
+		if i := strings.Index(s, op); i >= 0 {
+			return attrSelector{
+				name:  strings.ToLower(s[:i]),
+				op:    op,
+				value: strings.Trim(s[i+len(op):], `"'`),
+			}
+		}
+	}
+	return attrSelector{name: strings.ToLower(s)}
+}
+
+func (g selectorGroup) matches(node *htmlNode) bool {
+	for _, chain := range g {
+		if chainMatches(chain, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// chainMatches reports whether node matches the last compound of chain with
+// the ones before it matched by its ancestors, in order.
+func chainMatches(chain []compoundSelector, node *htmlNode) bool {
+	last := len(chain) - 1
+	if !chain[last].matches(node) {
+		return false
+	}
+	for ancestor := node.parent; last > 0 && ancestor != nil; ancestor = ancestor.parent {
+		if chain[last-1].matches(ancestor) {
+			last--
+		}
+	}
+	return last == 0
+}
+
+func (c compoundSelector) matches(node *htmlNode) bool {
+	if node.tag == "" || node.attrs == nil {
+		return false
+	}
+	if c.tag != "" && c.tag != "*" && c.tag != node.tag {
+		return false
+	}
+	if c.id != "" && node.attrs["id"] != c.id {
+		return false
+	}
+	classes := strings.Fields(node.attrs["class"])
+	for _, class := range c.classes {
+		found := false
+		for _, have := range classes {
+			found = found || have == class
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, attr := range c.attrs {
+		value, ok := node.attrs[attr.name]
+		if !ok {
+			return false
+		}
+		switch attr.op {
+		case "=":
+			ok = value == attr.value
+		case "*=":
+			ok = strings.Contains(value, attr.value)
+		case "^=":
+			ok = strings.HasPrefix(value, attr.value)
+		case "$=":
+			ok = strings.HasSuffix(value, attr.value)
+		case "~=":
+			ok = false
+			for _, word := range strings.Fields(value) {
+				ok = ok || word == attr.value
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fakePage is a PageController over a static HTML document, which every
+// navigation loads whatever the URL.
+type fakePage struct {
+	doc *htmlNode
+	// navigated holds the URLs Navigate was called with
+	navigated []string
+	// finalURL is where the page reports being after a navigation, the
+	// URL navigated to when empty
+	finalURL string
+}
+
+// newFakePage returns a fakePage for the HTML src.
+func newFakePage(t *testing.T, src string) *fakePage {
+	t.Helper()
+	doc, err := parseHTML(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakePage{doc: doc}
+}
+
+// loadFakePage returns a fakePage for the HTML file at testdata/name.
+func loadFakePage(t *testing.T, name string) *fakePage {
+	t.Helper()
+	src, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newFakePage(t, string(src))
+}
+
+func (p *fakePage) Navigate(url string) error {
+	p.navigated = append(p.navigated, url)
+	return nil
+}
+
+func (p *fakePage) WaitDOMStable(d time.Duration, diff float64) error {
+	return nil
+}
+
+func (p *fakePage) Element(selector string) (ElementController, error) {
+	elements, err := p.Elements(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, errFakeNotFound
+	}
+	return elements[0], nil
+}
+
+func (p *fakePage) Elements(selector string) ([]ElementController, error) {
+	return fakeElements(p.doc, selector)
+}
+
+func (p *fakePage) Text() (string, string, error) {
+	var title, body string
+	if titles, _ := p.doc.find("title"); len(titles) > 0 {
+		for _, child := range titles[0].children {
+			title += child.text
+		}
+	}
+	if bodies, _ := p.doc.find("body"); len(bodies) > 0 {
+		body = bodies[0].innerText()
+	}
+	return strings.TrimSpace(title), body, nil
+}
+
+func (p *fakePage) URL() (string, error) {
+	if p.finalURL != "" {
+		return p.finalURL, nil
+	}
+	if len(p.navigated) == 0 {
+		return "about:blank", nil
+	}
+	return p.navigated[len(p.navigated)-1], nil
+}
+
+func (p *fakePage) Timeout(d time.Duration) (PageController, func()) {
+	return p, func() {}
+}
+
+func (p *fakePage) Context() context.Context {
+	return context.Background()
+}
+
+func (p *fakePage) Screenshot() ([]byte, error) {
+	return nil, errors.New("fake page can't take screenshots")
+}
+
+// fakeElement is an ElementController for an element of a fakePage. The
+// document is static, so its list never scrolls and it is always stable.
+type fakeElement struct {
+	node *htmlNode
+}
+
+// fakeElements returns the elements under node matching selector.
+func fakeElements(node *htmlNode, selector string) ([]ElementController, error) {
+	nodes, err := node.find(selector)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]ElementController, 0, len(nodes))
+	for _, node := range nodes {
+		elements = append(elements, &fakeElement{node: node})
+	}
+	return elements, nil
+}
+
+func (e *fakeElement) Element(selector string) (ElementController, error) {
+	elements, err := e.Elements(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, errFakeNotFound
+	}
+	return elements[0], nil
+}
+
+func (e *fakeElement) Elements(selector string) ([]ElementController, error) {
+	return fakeElements(e.node, selector)
+}
+
+func (e *fakeElement) Text() (string, error) {
+	return e.node.innerText(), nil
+}
+
+func (e *fakeElement) Matches(selector string) (bool, error) {
+	groups, err := parseSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return groups.matches(e.node), nil
+}
+
+func (e *fakeElement) Attribute(name string) (*string, error) {
+	value, ok := e.node.attrs[strings.ToLower(name)]
+	if !ok {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+func (e *fakeElement) Link() (string, error) {
+	for node := e.node; node != nil; node = node.parent {
+		if node.tag == "a" && node.attrs["href"] != "" {
+			return node.attrs["href"], nil
+		}
+	}
+	links, err := e.node.find("a[href]")
+	if err != nil || len(links) == 0 {
+		return "", err
+	}
+	return links[0].attrs["href"], nil
+}
+
+func (e *fakeElement) ScrollDown() (bool, error) {
+	return false, nil
+}
+
+func (e *fakeElement) Click() error {
+	return nil
+}
+
+func (e *fakeElement) WaitStable(d time.Duration, timeout time.Duration) error {
+	return nil
+}
+
+func (e *fakeElement) Timeout(d time.Duration) (ElementController, func()) {
+	return e, func() {}
+}
+
+// fakePages is a PageSource of fakePages, each showing the HTML of the
+// booking URL it is opened for.
+type fakePages struct {
+	t *testing.T
+	// html holds the page of each booking URL, an empty one for the rest
+	html map[string]string
+
+	mu sync.Mutex
+	// opened holds the booking URLs pages were opened for
+	opened []string
+}
+
+func (p *fakePages) OpenPage(ctx context.Context, cfg *Config, movie *MovieDetails, city CityDetails, date string, bookingURL string) (PageController, func(), error) {
+	p.mu.Lock()
+	p.opened = append(p.opened, bookingURL)
+	p.mu.Unlock()
+	doc, err := parseHTML(p.html[bookingURL])
+	if err != nil {
+		p.t.Error(err)
+		return nil, func() {}, err
+	}
+	return &fakePage{doc: doc}, func() {}, nil
+}
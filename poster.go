@@ -0,0 +1,21 @@
+package main
+
+import "strings"
+
+// posterSelector matches the meta tag BookMyShow's pages name the poster of
+// their movie in, for link previews.
+const posterSelector = `meta[property="og:image"]`
+
+// readPosterURL returns the poster image page links for previews, or "" when
+// it has none.
+func readPosterURL(page PageController) string {
+	metas, err := page.Elements(posterSelector)
+	if err != nil || len(metas) == 0 {
+		return ""
+	}
+	content, err := metas[0].Attribute("content")
+	if err != nil || content == nil || !strings.HasPrefix(*content, "https://") {
+		return ""
+	}
+	return *content
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is a daily window in which alerts aren't sent, e.g. overnight.
+// Start and End are times of day as offsets from midnight, and a window whose
+// End is before its Start spans midnight.
+type QuietHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+	// Drop records the alerts of the window as delivered without sending
+	// them. Otherwise they are held back, leaving state as it was so the
+	// first run after the window sends them.
+	Drop bool
+}
+
+// parseClock parses a time of day like 23:30 into its offset from midnight.
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("must be a time of day like 23:30")
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// contains reports whether now falls in the window.
+func (q *QuietHours) contains(now time.Time) bool {
+	now = now.In(q.Location)
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if q.Start < q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
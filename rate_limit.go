@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket holding a single token, shared by every
+// worker, so navigations to BookMyShow stay under BMS_MAX_RPS however many
+// pages load in parallel. Each token is handed out in the order it was asked
+// for.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is when the next token is available
+	next time.Time
+}
+
+// newRateLimiter returns a limiter handing out rps tokens a second.
+func newRateLimiter(rps float64) *RateLimiter {
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Wait blocks until a token is available, or returns ctx's error once it is
+// done first. A nil limiter never waits.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := at.Sub(now)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// currentReport collects the report of the run in progress, when
+// WRITE_REPORT_DIR is set.
+var currentReport *RunReport
+
+// RunReport is the machine-readable record of a single run, written to
+// WRITE_REPORT_DIR as report-<timestamp>.json.
+type RunReport struct {
+	StartedAt          time.Time `json:"started_at"`
+	FinishedAt         time.Time `json:"finished_at"`
+	DurationSeconds    float64   `json:"duration_in_seconds"`
+	Interrupted        bool      `json:"interrupted"`
+	MoviesChecked      int64     `json:"movies_checked"`
+	MoviesWithNewShows int64     `json:"movies_with_new_shows"`
+	TheatresAdded      int64     `json:"theatres_added"`
+	ScrapeErrors       int64     `json:"scrape_errors"`
+	// SaveError is set when the state couldn't be saved at the end of the
+	// run
+	SaveError string        `json:"save_error,omitempty"`
+	Movies    []MovieReport `json:"movies"`
+
+	mu sync.Mutex
+}
+
+// MovieReport is what happened to one movie during a run.
+type MovieReport struct {
+	Name  string       `json:"name"`
+	Code  string       `json:"code"`
+	Dates []DateReport `json:"dates"`
+}
+
+// DateReport is the outcome of scraping one city and date of a movie. Error
+// and ErrorType are set when the scrape failed, and the theatre fields only
+// when it didn't.
+type DateReport struct {
+	City      string `json:"city"`
+	Date      string `json:"date"`
+	URL       string `json:"url,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+	Cancelled bool   `json:"cancelled,omitempty"`
+	NoShows   bool   `json:"no_shows,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorType string `json:"error_type,omitempty"`
+	// Screenshot is the PNG saved of the page when it failed to load
+	Screenshot string `json:"screenshot,omitempty"`
+
+	// Theatres and Shows count everything scraped for the date
+	Theatres        int      `json:"theatres"`
+	Shows           int      `json:"shows"`
+	NewTheatres     []string `json:"new_theatres,omitempty"`
+	MoreShows       []string `json:"more_shows,omitempty"`
+	PriceChanges    []string `json:"price_changes,omitempty"`
+	FormatChanges   []string `json:"format_changes,omitempty"`
+	RemovedTheatres []string `json:"removed_theatres,omitempty"`
+	// TheatresSeen lists every scraped theatre with how long it has been
+	// listed
+	TheatresSeen []TheatreSeen `json:"theatres_seen,omitempty"`
+}
+
+// TheatreSeen is a theatre a scrape found, with when it was first and last
+// listed. FirstSeen is the time of the scrape for theatres found by it.
+type TheatreSeen struct {
+	Name      string    `json:"name"`
+	Shows     int       `json:"shows"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// addDate adds the outcome of a city and date to the report of movie.
+func (r *RunReport) addDate(movie *MovieDetails, date DateReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.Movies {
+		if r.Movies[i].Name == movie.Name && r.Movies[i].Code == movie.Code {
+			r.Movies[i].Dates = append(r.Movies[i].Dates, date)
+			return
+		}
+	}
+	r.Movies = append(r.Movies, MovieReport{
+		Name:  movie.Name,
+		Code:  movie.Code,
+		Dates: []DateReport{date},
+	})
+}
+
+// reportDate adds the outcome of a city and date of movie to the current
+// report, when one is being collected.
+func reportDate(movie *MovieDetails, date DateReport) {
+	if currentReport != nil {
+		currentReport.addDate(movie, date)
+	}
+}
+
+// write fills in the totals of the run, which finished after duration, and
+// writes the report to dir.
+func (r *RunReport) write(dir string, duration time.Duration, interrupted bool, saveErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = r.StartedAt.Add(duration)
+	r.DurationSeconds = duration.Seconds()
+	r.Interrupted = interrupted
+	r.MoviesChecked = runCounts.moviesChecked.Load()
+	r.MoviesWithNewShows = runCounts.moviesWithNewShows.Load()
+	r.TheatresAdded = runCounts.theatresAdded.Load()
+	r.ScrapeErrors = runScrapeErrors.Load()
+	if saveErr != nil {
+		r.SaveError = saveErr.Error()
+	}
+	if r.Movies == nil {
+		r.Movies = []MovieReport{}
+	}
+
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshaling report: %v", err)
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("report-%s.json", r.StartedAt.Format("20060102-150405")))
+	return writeFileAtomic(filename, data)
+}
+
+// cleanUpReports gzips the reports in dir last written more than
+// compressAfterDays ago, and deletes those, gzipped or not, older than
+// retentionDays. Either is skipped when zero. A report that couldn't be
+// cleaned up doesn't stop the others.
+func cleanUpReports(dir string, compressAfterDays int, retentionDays int, now time.Time) error {
+	if compressAfterDays == 0 && retentionDays == 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading report directory %s: %v", dir, err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		compressed := strings.HasSuffix(name, ".json.gz")
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, "report-") || !compressed && !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reading report %s: %v", name, err))
+			continue
+		}
+		path := filepath.Join(dir, name)
+		age := now.Sub(info.ModTime())
+
+		if retentionDays > 0 && age > time.Duration(retentionDays)*24*time.Hour {
+			if err := os.Remove(path); err != nil {
+				errs = append(errs, fmt.Errorf("error deleting report %s: %v", name, err))
+			}
+			continue
+		}
+		if compressAfterDays > 0 && !compressed && age > time.Duration(compressAfterDays)*24*time.Hour {
+			if err := compressReport(path, info.ModTime()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressReport replaces the report at path with a gzipped copy, which keeps
+// its modTime so it is deleted as old as the report was.
+func compressReport(path string, modTime time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading report %s: %v", path, err)
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Name = filepath.Base(path)
+	writer.ModTime = modTime
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("error compressing report %s: %v", path, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error compressing report %s: %v", path, err)
+	}
+
+	gzipPath := path + ".gz"
+	if err := writeFileAtomic(gzipPath, compressed.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(gzipPath, modTime, modTime); err != nil {
+		return fmt.Errorf("error setting time of report %s: %v", gzipPath, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("error deleting compressed report %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/stealth"
+	"github.com/sirupsen/logrus"
+)
+
+// movieCodePattern matches the event code of BookMyShow movies, like
+// ET00431676.
+var movieCodePattern = regexp.MustCompile(`\bET\d{8}\b`)
+
+// resolveCodeAfterErrors is how many runs in a row a movie has to fail before
+// its code is resolved again, in case BookMyShow moved the movie to a new one.
+const resolveCodeAfterErrors = 3
+
+// movieLanding returns the landing page of the movie with slug in city, and
+// the slug. slug can also be the URL of the landing page, whose path then
+// holds the slug after /movies/.
+func movieLanding(slug string, city string) (string, string) {
+	if !strings.HasPrefix(slug, "https://") && !strings.HasPrefix(slug, "http://") {
+		return fmt.Sprintf("https://in.bookmyshow.com/%s/movies/%s", url.PathEscape(city), url.PathEscape(slug)), slug
+	}
+	landingURL := slug
+	if parsed, err := url.Parse(landingURL); err == nil {
+		segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+		for i, segment := range segments {
+			if segment == "movies" && i+1 < len(segments) {
+				return landingURL, segments[i+1]
+			}
+		}
+	}
+	return landingURL, ""
+}
+
+// resolveMovieCode opens the landing page of the movie with slug in city and
+// reads the code of the movie off it. BookMyShow redirects the page to the
+// URL ending in the code, and otherwise links the booking or the landing page
+// of the movie from it.
+func resolveMovieCode(ctx context.Context, cfg *Config, browser *rod.Browser, slug string, city string) (string, error) {
+	landingURL, slug := movieLanding(slug, city)
+	landingPage, err := stealth.Page(browser)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNewPage, err)
+	}
+	defer landingPage.Close()
+	page := landingPage.Context(ctx).Timeout(cfg.BrowserTimeout)
+	defer page.CancelTimeout()
+
+	if err := cfg.NavigationLimiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	logger.WithField("url", landingURL).Debug("Navigating to movie landing page")
+	if err := page.Navigate(landingURL); err != nil {
+		return "", navigationError(fmt.Errorf("error navigating to %s: %w", landingURL, err))
+	}
+	if err := page.WaitDOMStable(time.Second, 0); err != nil && page.GetContext().Err() != nil {
+		return "", navigationError(fmt.Errorf("error waiting for DOM to stabilize: %w", err))
+	}
+	if isChallengePage(newRodPage(page)) {
+		return "", ErrBlocked
+	}
+
+	info, err := page.Info()
+	if err != nil {
+		return "", fmt.Errorf("error reading page URL: %v", err)
+	}
+	if code := movieCodePattern.FindString(info.URL); code != "" {
+		return code, nil
+	}
+
+	// Links to other movies carry codes too, so only those naming the slug
+	// of this one count
+	result, err := page.Eval(`() => Array.from(document.querySelectorAll("a[href]"), link => link.href)`)
+	if err != nil {
+		return "", fmt.Errorf("error reading page links: %v", err)
+	}
+	for _, link := range result.Value.Arr() {
+		href := link.Str()
+		if slug == "" || !strings.Contains(href, "/"+slug+"/") && !strings.Contains(href, "/"+slug+"-") {
+			continue
+		}
+		if code := movieCodePattern.FindString(href); code != "" {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("no movie code found on %s (%s)", landingURL, info.URL)
+}
+
+// resolveMovie resolves the code of the movie with slug in city, printing it,
+// and sets it on every watchlist entry of that slug and city with another one.
+func resolveMovie(w io.Writer, cfg *Config, slug string, city string) error {
+	browser, err := launchBrowser(cfg)
+	if err != nil {
+		return err
+	}
+	defer browser.Close()
+
+	code, err := resolveMovieCode(context.Background(), cfg, browser, slug, city)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Resolved %s in %s to %s\n", slug, city, code)
+	_, slug = movieLanding(slug, city)
+
+	storeLock, err := acquireStoreLock(storeLockPath)
+	if err != nil {
+		return err
+	}
+	defer storeLock.Release()
+
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		return err
+	}
+	updated := 0
+	for i := range moviesList {
+		movie := &moviesList[i]
+		if movie.SlugName != slug || movie.Code == code || !slices.ContainsFunc(movie.showCities(), func(c CityDetails) bool {
+			return c.City == city
+		}) {
+			continue
+		}
+		movie.Code = code
+		updated++
+	}
+	if updated == 0 {
+		return nil
+	}
+	if err := movieStore.Save(moviesList); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Updated the code of %d watchlist entries\n", updated)
+	return nil
+}
+
+// healMovieCodes resolves the code of the watched entries of moviesList that
+// have none, or that just failed resolveCodeAfterErrors runs in a row. An
+// entry whose code couldn't be resolved is left as it is.
+func healMovieCodes(ctx context.Context, cfg *Config, browser *rod.Browser, moviesList []MovieDetails) {
+	for i := range moviesList {
+		movie := &moviesList[i]
+		if movie.Found || movie.Expired || !movie.enabled() || movie.EventType != "" && movie.EventType != "movie" || !selectedForRun(cfg, movie) {
+			continue
+		}
+		if movie.Code != "" && movie.ConsecutiveErrors != resolveCodeAfterErrors {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		city := movie.showCities()[0].City
+		code, err := resolveMovieCode(ctx, cfg, browser, movie.SlugName, city)
+		fields := logrus.Fields{
+			"movie": movie.Name,
+			"slug":  movie.SlugName,
+			"city":  city,
+		}
+		if err != nil {
+			fields["error"] = err
+			fields["error_type"] = scrapeErrorType(err)
+			// Without a code there is no booking page, so the movie waits
+			// for a later run to resolve it
+			if movie.Code == "" {
+				logger.WithFields(fields).Error("Error resolving movie code, skipping the movie")
+			} else {
+				logger.WithFields(fields).Error("Error resolving movie code")
+			}
+			continue
+		}
+		if code == movie.Code {
+			continue
+		}
+		fields["code"] = code
+		fields["previous_code"] = movie.Code
+		logger.WithFields(fields).Info("Resolved movie code from its landing page")
+		movie.Code = code
+	}
+}
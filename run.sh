@@ -2,4 +2,4 @@
 
 export PATH=/usr/local/go/bin:$PATH
 
-go run main.go
\ No newline at end of file
+go run .
\ No newline at end of file
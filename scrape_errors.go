@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Scrape failures wrap one of these, so callers can tell what went wrong with
+// errors.Is and logs can carry it as a stable error_type.
+var (
+	// ErrBlocked is returned for pages where BookMyShow served a bot
+	// challenge or captcha instead of the booking page.
+	ErrBlocked = errors.New("blocked by bot challenge")
+	// ErrNavTimeout is returned when the booking page didn't load, or
+	// didn't settle, within the timeout.
+	ErrNavTimeout = errors.New("timed out loading booking page")
+	// ErrNewPage is returned when the browser couldn't open a page to
+	// load the booking page in.
+	ErrNewPage = errors.New("error opening browser page")
+	// ErrNavigation is returned when the browser failed to load the booking
+	// page for any other reason.
+	ErrNavigation = errors.New("error loading booking page")
+	// ErrContainerNotFound is returned when the booking page loaded but the
+	// theatre container selector matched nothing.
+	ErrContainerNotFound = errors.New("theatre container not found")
+	// ErrBookingNotOpen is returned when the booking page says bookings
+	// for the date haven't opened yet. It isn't a failure, the date simply
+	// has no shows to read.
+	ErrBookingNotOpen = errors.New("bookings not open yet")
+	// ErrRedirected is returned, wrapping ErrBookingNotOpen, when the
+	// booking page redirected elsewhere, which BookMyShow does for dates
+	// whose bookings haven't opened.
+	ErrRedirected = errors.New("redirected away from booking page")
+	// ErrTheatreList is returned when the theatres in the container couldn't
+	// be read.
+	ErrTheatreList = errors.New("error reading theatre list")
+	// ErrScrapePanic is recorded when scraping a date panicked.
+	ErrScrapePanic = errors.New("scrape panicked")
+	// ErrRunAborted is returned by a run that ON_SCRAPE_ERROR=abort stopped
+	// after a scrape error.
+	ErrRunAborted = errors.New("run aborted after a scrape error")
+	// ErrRunDeadline is returned by a run that RUN_DEADLINE cut short, and
+	// is the cause of the context it cancels.
+	ErrRunDeadline = errors.New("run deadline reached")
+)
+
+// navigationError wraps err from loading the booking page as an ErrNavTimeout
+// when it ran out of time and as an ErrNavigation otherwise.
+func navigationError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrNavTimeout, err)
+	}
+	return fmt.Errorf("%w: %w", ErrNavigation, err)
+}
+
+// scrapeErrorType returns the error_type logged and counted for err.
+func scrapeErrorType(err error) string {
+	switch {
+	case errors.Is(err, ErrBlocked):
+		return "blocked"
+	case errors.Is(err, ErrNavTimeout):
+		return "nav_timeout"
+	case errors.Is(err, ErrNewPage):
+		return "new_page"
+	case errors.Is(err, ErrNavigation):
+		return "navigation"
+	case errors.Is(err, ErrContainerNotFound):
+		return "container_not_found"
+	case errors.Is(err, ErrRedirected):
+		return "redirected"
+	case errors.Is(err, ErrBookingNotOpen):
+		return "booking_not_open"
+	case errors.Is(err, ErrTheatreList):
+		return "theatre_list"
+	case errors.Is(err, ErrScrapePanic):
+		return "panic"
+	default:
+		return "unknown"
+	}
+}
+
+// alertMovieFailing tells the operator over Telegram that movie failed to
+// scrape cfg.MovieErrorAlertAfter runs in a row. It goes to OPERATOR_CHAT_ID
+// when set and to the Telegram chat of the alerts otherwise.
+func alertMovieFailing(cfg *Config, movie *MovieDetails) {
+	logger.WithFields(logrus.Fields{
+		"movie":      movie.Name,
+		"runs":       movie.ConsecutiveErrors,
+		"last_error": movie.LastError,
+	}).Error("Movie keeps failing to scrape")
+
+	payload := NotificationPayload{
+		Kind:              NotificationMovieFailing,
+		Movie:             movie.Name,
+		ConsecutiveErrors: movie.ConsecutiveErrors,
+		LastError:         movie.LastError,
+		ChatID:            cfg.OperatorChatID,
+	}
+	for _, notifier := range cfg.Notifiers {
+		if notifier.Name() != "telegram" {
+			continue
+		}
+		if err := notifier.Notify(payload); err != nil {
+			logger.WithFields(logrus.Fields{
+				"movie": movie.Name,
+				"error": err,
+			}).Error("Error sending failing movie alert")
+		}
+	}
+}
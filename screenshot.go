@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// saveErrorScreenshot saves what page shows after it failed to load the
+// booking page of movie for one city and date as a PNG in
+// cfg.ScreenshotDir, returning its path. Failing to take the screenshot is
+// only logged, and an empty path returned.
+func saveErrorScreenshot(cfg *Config, page PageController, movie *MovieDetails, city string, date string) string {
+	fields := logrus.Fields{
+		"movie": movie.Name,
+		"city":  city,
+		"date":  date,
+	}
+
+	// The screenshot gets its own timeout since the attempt's ran out
+	screenshotPage, cancelTimeout := page.Timeout(cfg.BrowserTimeout)
+	data, err := screenshotPage.Screenshot()
+	cancelTimeout()
+	if err != nil {
+		fields["error"] = err
+		logger.WithFields(fields).Warn("Error taking screenshot of failed scrape")
+		return ""
+	}
+
+	filename := filepath.Join(cfg.ScreenshotDir, fmt.Sprintf("%s-%s-%s-%s.png", movie.Code, city, date, time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		fields["error"] = err
+		logger.WithFields(fields).Warn("Error saving screenshot of failed scrape")
+		return ""
+	}
+	return filename
+}
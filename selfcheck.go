@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// runSelfCheck scrapes the booking page of the movie SELFCHECK_CODE,
+// SELFCHECK_SLUG and SELFCHECK_CITY name, one known to be showing, and fails
+// unless the page had a theatre container and a theatre with a name in it.
+// When it fails with the movie still showing, the selectors went stale.
+func runSelfCheck(w io.Writer, cfg *Config) error {
+	if cfg.SelfCheckCode == "" || cfg.SelfCheckSlug == "" || cfg.SelfCheckCity == "" {
+		return errors.New("--selfcheck needs SELFCHECK_CODE, SELFCHECK_SLUG and SELFCHECK_CITY to be set")
+	}
+	date := normalizeDate(cfg.SelfCheckDate, time.Now().In(cfg.ShowLocation))
+	if _, err := time.Parse("20060102", date); err != nil {
+		return fmt.Errorf("invalid SELFCHECK_DATE %q: must be YYYYMMDD, YYYY-MM-DD, today, tomorrow or +Nd", cfg.SelfCheckDate)
+	}
+	movie := &MovieDetails{
+		Name:     cfg.SelfCheckSlug,
+		Code:     cfg.SelfCheckCode,
+		SlugName: cfg.SelfCheckSlug,
+		City:     cfg.SelfCheckCity,
+		Date:     date,
+	}
+
+	browser, err := launchBrowser(cfg)
+	if err != nil {
+		return err
+	}
+	defer browser.Close()
+
+	city := movie.showCities()[0]
+	pageSelectors := movie.pageSelectors()
+	result, err := scrapeMovie(context.Background(), cfg, browserPages{browser: browser}, movie, city, date)
+	fmt.Fprintf(w, "Checked %s\n", result.BookingURL)
+	switch {
+	case err != nil:
+		return fmt.Errorf("self-check failed, the booking page didn't load (%s): %v", scrapeErrorType(err), err)
+	case result.BookingNotOpen:
+		return errors.New("self-check failed, the booking page says bookings aren't open, pick a movie that is showing")
+	case result.NoShows || len(result.Theatres) == 0:
+		return fmt.Errorf("self-check failed, no theatres found with the %q theatre container and %q theatre selectors, BookMyShow may have changed its markup", pageSelectors.TheatreContainer, pageSelectors.Theatre)
+	}
+
+	shows := 0
+	for _, theatre := range result.Theatres {
+		shows += theatre.ShowCount
+	}
+	fmt.Fprintf(w, "ok      theatre container found\n")
+	fmt.Fprintf(w, "ok      %d theatres, the first one %q\n", len(result.Theatres), result.Theatres[0].Name)
+	if shows == 0 {
+		return fmt.Errorf("self-check failed, no shows found in %d theatres with the %q show selector", len(result.Theatres), pageSelectors.Show)
+	}
+	fmt.Fprintf(w, "ok      %d shows\n", shows)
+	fmt.Fprintln(w, "Self-check passed")
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newMovieRequest is the body accepted by POST /movies.
+type newMovieRequest struct {
+	Name      string        `json:"name"`
+	SlugName  string        `json:"slug_name"`
+	Code      string        `json:"code"`
+	City      string        `json:"city"`
+	CityCode  string        `json:"city_code"`
+	Cities    []CityDetails `json:"cities"`
+	Date      string        `json:"date"`
+	Dates     []string      `json:"dates"`
+	EventType string        `json:"event_type"`
+}
+
+// runServer serves the watchlist API on addr until the server fails. Relative
+// dates of the movies added are taken from the current day in location.
+func runServer(addr string, location *time.Location) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /movies", handleListMovies)
+	mux.HandleFunc("POST /movies", func(w http.ResponseWriter, r *http.Request) {
+		handleAddMovie(w, r, time.Now().In(location))
+	})
+
+	logger.WithField("addr", addr).Info("Serving watchlist API")
+	return http.ListenAndServe(addr, mux)
+}
+
+func handleListMovies(w http.ResponseWriter, r *http.Request) {
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		logger.WithError(err).Error("Error reading movies")
+		writeJSONError(w, http.StatusInternalServerError, "error reading watchlist")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, moviesList)
+}
+
+// handleAddMovie adds the movie in the request body to the watchlist, its dates
+// in any form bms.json accepts, relative ones taken from now.
+func handleAddMovie(w http.ResponseWriter, r *http.Request, now time.Time) {
+	var req newMovieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+
+	movie := MovieDetails{
+		Name:      req.Name,
+		SlugName:  req.SlugName,
+		Code:      req.Code,
+		City:      req.City,
+		CityCode:  req.CityCode,
+		Cities:    req.Cities,
+		Date:      req.Date,
+		Dates:     req.Dates,
+		EventType: req.EventType,
+	}
+	if len(movie.Dates) == 0 && len(movie.Cities) == 0 {
+		movie.Theatres = []TheatreRecord{}
+	}
+	movie.normalizeDates(now)
+	if err := movie.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A run in progress holds the lock until its final save, which would
+	// otherwise overwrite the movie added
+	storeLock, err := acquireStoreLock(storeLockPath)
+	if err != nil {
+		logger.WithError(err).Error("Error locking movies")
+		writeJSONError(w, http.StatusInternalServerError, "error locking watchlist")
+		return
+	}
+	defer storeLock.Release()
+
+	moviesList, err := movieStore.Load()
+	if err != nil {
+		logger.WithError(err).Error("Error reading movies")
+		writeJSONError(w, http.StatusInternalServerError, "error reading watchlist")
+		return
+	}
+
+	moviesList = append(moviesList, movie)
+	if err := movieStore.Save(moviesList); err != nil {
+		logger.WithError(err).Error("Error saving movies")
+		writeJSONError(w, http.StatusInternalServerError, "error saving watchlist")
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"movie": movie.Name,
+		"code":  movie.Code,
+		"dates": movie.showDates(),
+	}).Info("Added movie to watchlist")
+	writeJSON(w, http.StatusCreated, movie)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WithError(err).Error("Error writing response")
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useTestStore points movieStore at a copy of validWatchlist, and the store
+// lock at a file next to it, for the rest of the test.
+func useTestStore(t *testing.T) *JSONStore {
+	t.Helper()
+	path := writeTestFile(t, "bms.json", validWatchlist)
+	previousStore, previousLock := movieStore, storeLockPath
+	store := &JSONStore{Filename: path, Location: time.UTC}
+	movieStore, storeLockPath = store, filepath.Join(filepath.Dir(path), storeLockFilename)
+	t.Cleanup(func() { movieStore, storeLockPath = previousStore, previousLock })
+	return store
+}
+
+// racingStore is a Store that starts writer, another edit of the watchlist,
+// the first time it is loaded, and gives it until the Save that follows the
+// load to get its own save in.
+type racingStore struct {
+	Store
+	writer  func()
+	started atomic.Bool
+	done    chan struct{}
+}
+
+func (s *racingStore) Load() ([]MovieDetails, error) {
+	moviesList, err := s.Store.Load()
+	if s.started.CompareAndSwap(false, true) {
+		go func() {
+			defer close(s.done)
+			s.writer()
+		}()
+		select {
+		case <-s.done:
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	return moviesList, err
+}
+
+// postMovie adds the movie in body through POST /movies.
+func postMovie(t *testing.T, body string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handleAddMovie(recorder, httptest.NewRequest(http.MethodPost, "/movies", strings.NewReader(body)), time.Now())
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("POST /movies %s = %d %s, want 201", body, recorder.Code, recorder.Body)
+	}
+}
+
+// watchedCodes returns the codes of the movies in store.
+func watchedCodes(t *testing.T, store Store) []string {
+	t.Helper()
+	moviesList, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, movie := range moviesList {
+		codes = append(codes, movie.Code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// saveLikeARun adds movie to the watchlist in store the way a run saves it,
+// holding the store lock rather than anything of this process.
+func saveLikeARun(t *testing.T, store Store, movie MovieDetails) {
+	t.Helper()
+	storeLock, err := acquireStoreLock(storeLockPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer storeLock.Release()
+	moviesList, err := store.Load()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := store.Save(append(moviesList, movie)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddMovieKeepsConcurrentSave(t *testing.T) {
+	store := useTestStore(t)
+	racing := &racingStore{Store: store, done: make(chan struct{})}
+	racing.writer = func() {
+		saveLikeARun(t, store, MovieDetails{Name: "Thudarum", SlugName: "thudarum", Code: "ET00400002", City: "kochi", CityCode: "KOCH", Date: "20991230"})
+	}
+	movieStore = racing
+
+	postMovie(t, `{"name": "Bazooka", "slug_name": "bazooka", "code": "ET00400001", "city": "kochi", "city_code": "KOCH", "date": "20991230"}`)
+	<-racing.done
+
+	want := []string{"ET00305698", "ET00400001", "ET00400002"}
+	if codes := watchedCodes(t, store); !slices.Equal(codes, want) {
+		t.Errorf("watched codes = %v, want %v", codes, want)
+	}
+}
+
+func TestAddMovieNormalizesDates(t *testing.T) {
+	now := time.Date(2099, 12, 29, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date string
+		want string
+	}{
+		{date: "today", want: "20991229"},
+		{date: "tomorrow", want: "20991230"},
+		{date: "+2d", want: "20991231"},
+		{date: "2099-12-30", want: "20991230"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			store := useTestStore(t)
+			recorder := httptest.NewRecorder()
+			body := `{"name": "Bazooka", "slug_name": "bazooka", "code": "ET00400001", "city": "kochi", "city_code": "KOCH", "date": "` + tt.date + `"}`
+			handleAddMovie(recorder, httptest.NewRequest(http.MethodPost, "/movies", strings.NewReader(body)), now)
+			if recorder.Code != http.StatusCreated {
+				t.Fatalf("POST /movies = %d %s, want 201", recorder.Code, recorder.Body)
+			}
+			moviesList, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			index := slices.IndexFunc(moviesList, func(m MovieDetails) bool { return m.Code == "ET00400001" })
+			if index < 0 || moviesList[index].Date != tt.want {
+				t.Errorf("watchlist = %+v, want ET00400001 added on %s", moviesList, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// URLShortener shortens booking links through a shortening service before they
+// go into alerts, for tidier buttons and click tracking.
+type URLShortener struct {
+	// APIURL is POSTed {"url": "<booking URL>"} and answers with the short
+	// URL, either as JSON {"short_url": "..."} or as the plain response body
+	APIURL string
+	// Token is sent as a bearer token when set
+	Token  string
+	Client *http.Client
+}
+
+// Shorten returns the short URL of longURL.
+func (s *URLShortener) Shorten(longURL string) (string, error) {
+	payloadJSON, err := json.Marshal(map[string]string{"url": longURL})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.APIURL, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return "", fmt.Errorf("error creating shortener request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("error making shortener request: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("error reading shortener response: %v", err)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return "", fmt.Errorf("shortener API error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	shortURL := strings.TrimSpace(string(body))
+	var apiResponse struct {
+		ShortURL string `json:"short_url"`
+	}
+	if json.Unmarshal(body, &apiResponse) == nil && apiResponse.ShortURL != "" {
+		shortURL = apiResponse.ShortURL
+	}
+	// Anything but a link, like an error page served with 200, would break
+	// the button
+	if parsed, err := url.Parse(shortURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("shortener returned %q instead of a URL", shortURL)
+	}
+	return shortURL, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// slackFieldLimit is the longest text Slack accepts in a field of a section
+// block, in characters.
+const slackFieldLimit = 2000
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type      string         `json:"type"`
+	Text      *slackText     `json:"text,omitempty"`
+	Fields    []slackText    `json:"fields,omitempty"`
+	Elements  []slackElement `json:"elements,omitempty"`
+	Accessory *slackImage    `json:"accessory,omitempty"`
+}
+
+type slackImage struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+type slackElement struct {
+	Type  string    `json:"type"`
+	Text  slackText `json:"text"`
+	URL   string    `json:"url"`
+	Style string    `json:"style,omitempty"`
+}
+
+// SlackNotifier posts alerts as Block Kit messages to a Slack incoming
+// webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *SlackNotifier) Notify(msg NotificationPayload) error {
+	fields := []slackText{
+		{Type: "mrkdwn", Text: fmt.Sprintf("*📍 City*\n%s", msg.City)},
+		{Type: "mrkdwn", Text: fmt.Sprintf("*📅 Date*\n%s", msg.Date)},
+	}
+	if len(msg.Theatres) > 0 {
+		var theatres []string
+		for _, theatre := range msg.Theatres {
+			theatres = append(theatres, fmt.Sprintf("%s: %d shows", theatre.Name, theatre.ShowCount))
+		}
+		heading := "*🏟️ Theatres*\n"
+		fields = append(fields, slackText{Type: "mrkdwn", Text: heading + truncateLines(strings.Join(theatres, "\n"), slackFieldLimit-len(heading), utf8.RuneCountInString)})
+	} else if msg.Theatre != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: fmt.Sprintf("*🏟️ Theatre*\n%s", msg.Theatre)})
+		switch msg.Kind {
+		case NotificationNewShow, NotificationMoreShows, NotificationPriceChanged, NotificationNewFormat:
+			shows := fmt.Sprintf("*Shows*\n%d", msg.ShowCount)
+			if msg.Kind == NotificationMoreShows {
+				shows += fmt.Sprintf(" (was %d)", msg.PreviousShowCount)
+			}
+			fields = append(fields, slackText{Type: "mrkdwn", Text: shows})
+			if change := msg.priceChange(); change != "" {
+				fields = append(fields, slackText{Type: "mrkdwn", Text: "*💰 Price*\n" + change})
+			}
+			if change := msg.formatChange(); change != "" {
+				fields = append(fields, slackText{Type: "mrkdwn", Text: "*🆕 Format*\n" + change})
+			}
+			if since := msg.availableSince(); since != "" {
+				fields = append(fields, slackText{Type: "mrkdwn", Text: "*⏳ Listed*\n" + since})
+			}
+			if len(msg.ShowTimes) > 0 {
+				heading := "*🕒 Timings*\n"
+				fields = append(fields, slackText{Type: "mrkdwn", Text: heading + truncateLines(strings.Join(msg.ShowTimes, ", "), slackFieldLimit-len(heading), utf8.RuneCountInString)})
+			}
+		}
+	}
+
+	if totals := msg.totals(); totals != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*📊 Overall*\n" + totals})
+	}
+
+	details := slackBlock{Type: "section", Fields: fields}
+	if msg.PosterURL != "" {
+		details.Accessory = &slackImage{Type: "image", ImageURL: msg.PosterURL, AltText: msg.Movie}
+	}
+	payload := map[string]interface{}{
+		// Shown in notifications, where blocks aren't rendered
+		"text": fmt.Sprintf("%s %s", msg.Kind.Title(), msg.Movie),
+		"blocks": []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: msg.Movie}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*" + msg.Kind.Title() + "*"}},
+			details,
+			{Type: "actions", Elements: []slackElement{
+				{
+					Type:  "button",
+					Text:  slackText{Type: "plain_text", Text: "🎟️ Book Now"},
+					URL:   msg.BookingURL,
+					Style: "primary",
+				},
+			}},
+		},
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), string(payloadJSON))
+		return nil
+	}
+
+	response, err := http.Post(n.WebhookURL, "application/json", bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return fmt.Errorf("error making slack request: %v", err)
+	}
+	defer response.Body.Close()
+
+	// Webhooks answer 200 with "ok", and a plain text reason otherwise
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("slack API error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS movies (
+	position INTEGER PRIMARY KEY,
+	details  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS theatres (
+	code       TEXT NOT NULL,
+	city       TEXT NOT NULL,
+	date       TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	show_count INTEGER NOT NULL,
+	first_seen TEXT NOT NULL,
+	last_seen  TEXT,
+	active     INTEGER NOT NULL,
+	min_price  REAL NOT NULL DEFAULT 0,
+	formats    TEXT,
+	held_back  INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (code, city, date, name)
+);
+`
+
+// SQLiteStore keeps the watchlist in a SQLite database. Movie entries are
+// stored as JSON without their theatres, which live in their own table so
+// their history survives them being removed from the tracked state.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the database at path, creating the schema if needed.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %v", path, err)
+	}
+	// SQLite allows a single writer, so don't let the pool hand out more
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %v", err)
+	}
+	if err := migrateSQLiteSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// sqliteTheatreColumns are the columns added to the theatres table after it was
+// first created, with their definitions.
+var sqliteTheatreColumns = []struct {
+	name       string
+	definition string
+}{
+	{"min_price", "REAL NOT NULL DEFAULT 0"},
+	// NULL for theatres recorded before formats were kept
+	{"formats", "TEXT"},
+	{"held_back", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migrateSQLiteSchema adds the columns introduced after a database was created,
+// which CREATE TABLE IF NOT EXISTS leaves out.
+func migrateSQLiteSchema(db *sql.DB) error {
+	for _, column := range sqliteTheatreColumns {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('theatres') WHERE name = ?`, column.name).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("error reading schema: %v", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE theatres ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return fmt.Errorf("error adding %s column: %v", column.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Load() ([]MovieDetails, error) {
+	rows, err := s.db.Query(`SELECT details FROM movies ORDER BY position`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying movies: %v", err)
+	}
+	defer rows.Close()
+
+	var moviesList []MovieDetails
+	for rows.Next() {
+		var details string
+		if err := rows.Scan(&details); err != nil {
+			return nil, fmt.Errorf("error scanning movie: %v", err)
+		}
+
+		var movie MovieDetails
+		if err := json.Unmarshal([]byte(details), &movie); err != nil {
+			return nil, fmt.Errorf("error unmarshaling movie: %v", err)
+		}
+		moviesList = append(moviesList, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying movies: %v", err)
+	}
+
+	for i := range moviesList {
+		for _, city := range moviesList[i].showCities() {
+			for _, date := range moviesList[i].showDates() {
+				theatres, err := s.loadTheatres(moviesList[i], city.City, date)
+				if err != nil {
+					return nil, err
+				}
+				moviesList[i].dateState(city.City, date).Theatres = theatres
+			}
+		}
+	}
+
+	if err := validateMovies(moviesList); err != nil {
+		return nil, err
+	}
+	return moviesList, nil
+}
+
+// loadTheatres returns the theatres currently tracked for one city and date of
+// movie.
+func (s *SQLiteStore) loadTheatres(movie MovieDetails, city string, date string) ([]TheatreRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT name, show_count, first_seen, last_seen, min_price, formats, held_back FROM theatres
+		WHERE code = ? AND city = ? AND date = ? AND active = 1
+		ORDER BY first_seen, name`,
+		movie.Code, city, date)
+	if err != nil {
+		return nil, fmt.Errorf("error querying theatres: %v", err)
+	}
+	defer rows.Close()
+
+	theatres := []TheatreRecord{}
+	for rows.Next() {
+		var theatre TheatreRecord
+		var firstSeen string
+		var lastSeen sql.NullString
+		var formats sql.NullString
+		if err := rows.Scan(&theatre.Name, &theatre.ShowCount, &firstSeen, &lastSeen, &theatre.MinPrice, &formats, &theatre.HeldBack); err != nil {
+			return nil, fmt.Errorf("error scanning theatre: %v", err)
+		}
+		theatre.FirstSeen, err = time.Parse(time.RFC3339Nano, firstSeen)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing first_seen of %s: %v", theatre.Name, err)
+		}
+		if lastSeen.Valid {
+			theatre.LastSeen, err = time.Parse(time.RFC3339Nano, lastSeen.String)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing last_seen of %s: %v", theatre.Name, err)
+			}
+		}
+		if formats.Valid {
+			if err := json.Unmarshal([]byte(formats.String), &theatre.Formats); err != nil {
+				return nil, fmt.Errorf("error parsing formats of %s: %v", theatre.Name, err)
+			}
+		}
+		theatres = append(theatres, theatre)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying theatres: %v", err)
+	}
+	return theatres, nil
+}
+
+func (s *SQLiteStore) Save(moviesList []MovieDetails) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM movies`); err != nil {
+		return fmt.Errorf("error clearing movies: %v", err)
+	}
+	// Theatres still tracked are re-activated below, the rest stay behind as
+	// history
+	if _, err := tx.Exec(`UPDATE theatres SET active = 0`); err != nil {
+		return fmt.Errorf("error resetting theatres: %v", err)
+	}
+
+	now := time.Now()
+	for i := range moviesList {
+		movie := &moviesList[i]
+
+		details, err := json.Marshal(movie.withoutTheatres())
+		if err != nil {
+			return fmt.Errorf("error marshaling movie %s: %v", movie.Name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO movies (position, details) VALUES (?, ?)`, i, string(details)); err != nil {
+			return fmt.Errorf("error saving movie %s: %v", movie.Name, err)
+		}
+
+		for _, city := range movie.showCities() {
+			for _, date := range movie.showDates() {
+				for _, theatre := range movie.dateState(city.City, date).Theatres {
+					if err := saveTheatre(tx, movie, city.City, date, theatre, now); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// saveTheatre upserts a theatre tracked for one city and date of movie,
+// marking it active.
+func saveTheatre(tx *sql.Tx, movie *MovieDetails, city string, date string, theatre TheatreRecord, now time.Time) error {
+	firstSeen := theatre.FirstSeen
+	if firstSeen.IsZero() {
+		firstSeen = theatre.LastSeen
+	}
+	if firstSeen.IsZero() {
+		firstSeen = now
+	}
+	var lastSeen sql.NullString
+	if !theatre.LastSeen.IsZero() {
+		lastSeen = sql.NullString{String: theatre.LastSeen.Format(time.RFC3339Nano), Valid: true}
+	}
+	var formats sql.NullString
+	if theatre.Formats != nil {
+		encoded, err := json.Marshal(theatre.Formats)
+		if err != nil {
+			return fmt.Errorf("error marshaling formats of %s: %v", theatre.Name, err)
+		}
+		formats = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO theatres (code, city, date, name, show_count, first_seen, last_seen, active, min_price, formats, held_back)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT (code, city, date, name) DO UPDATE SET
+			show_count = excluded.show_count,
+			first_seen = excluded.first_seen,
+			min_price = excluded.min_price,
+			formats = COALESCE(excluded.formats, theatres.formats),
+			held_back = excluded.held_back,
+			last_seen = COALESCE(excluded.last_seen, theatres.last_seen),
+			active = 1`,
+		movie.Code, city, date, theatre.Name, theatre.ShowCount,
+		firstSeen.Format(time.RFC3339Nano), lastSeen, theatre.MinPrice, formats, theatre.HeldBack)
+	if err != nil {
+		return fmt.Errorf("error saving theatre %s of %s: %v", theatre.Name, movie.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store persists the watchlist along with the tracking state of each movie.
+type Store interface {
+	Load() ([]MovieDetails, error)
+	Save([]MovieDetails) error
+}
+
+// JSONStore keeps the watchlist in a single JSON file that is atomically
+// replaced on every save.
+type JSONStore struct {
+	Filename string
+	// Location is the timezone relative dates like "today" are resolved in
+	Location *time.Location
+	// Compact writes the file without indentation
+	Compact bool
+}
+
+func (s *JSONStore) Load() ([]MovieDetails, error) {
+	return loadMoviesFromJSON(s.Filename, s.Location)
+}
+
+func (s *JSONStore) Save(moviesList []MovieDetails) error {
+	return saveMoviesToJSON(s.Filename, moviesList, s.Compact)
+}
+
+// GlobJSONStore keeps the watchlist in several JSON files, e.g. one per person
+// or region, matched by a glob pattern and merged into one list. Each entry
+// remembers the file it came from and is saved back there. Entries added
+// since, which have no file yet, go to the first of the files.
+type GlobJSONStore struct {
+	// Pattern matches the watchlist files, or is a directory whose .json
+	// files are the watchlist
+	Pattern  string
+	Location *time.Location
+	// Compact writes the files without indentation
+	Compact bool
+
+	mu sync.Mutex
+	// files are the files the last Load read, so Save also rewrites the ones
+	// whose entries were all removed
+	files []string
+}
+
+// paths returns the watchlist files Pattern matches, sorted.
+func (s *GlobJSONStore) paths() ([]string, error) {
+	pattern := s.Pattern
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*.json")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WATCHLIST_GLOB %q: %v", s.Pattern, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("WATCHLIST_GLOB %q matches no files", s.Pattern)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (s *GlobJSONStore) Load() ([]MovieDetails, error) {
+	paths, err := s.paths()
+	if err != nil {
+		return nil, err
+	}
+
+	var moviesList []MovieDetails
+	for _, path := range paths {
+		movies, err := loadMoviesFromJSON(path, s.Location)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %v", path, err)
+		}
+		for i := range movies {
+			movies[i].source = path
+		}
+		moviesList = append(moviesList, movies...)
+	}
+
+	s.mu.Lock()
+	s.files = paths
+	s.mu.Unlock()
+	return moviesList, nil
+}
+
+func (s *GlobJSONStore) Save(moviesList []MovieDetails) error {
+	s.mu.Lock()
+	files := slices.Clone(s.files)
+	s.mu.Unlock()
+	if len(files) == 0 {
+		return errors.New("error saving watchlist: it wasn't loaded from any file")
+	}
+
+	byFile := make(map[string][]MovieDetails, len(files))
+	for _, file := range files {
+		byFile[file] = []MovieDetails{}
+	}
+	for _, movie := range moviesList {
+		file := movie.source
+		if file == "" {
+			file = files[0]
+		}
+		byFile[file] = append(byFile[file], movie)
+	}
+
+	for file, movies := range byFile {
+		if err := saveMoviesToJSON(file, movies, s.Compact); err != nil {
+			return fmt.Errorf("error saving %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// validateMovies runs validate on every entry of a freshly loaded watchlist,
+// naming the offending entry in the error.
+func validateMovies(moviesList []MovieDetails) error {
+	for i := range moviesList {
+		if err := moviesList[i].validate(); err != nil {
+			return fmt.Errorf("invalid movie at index %d (%q): %v", i, moviesList[i].Name, err)
+		}
+	}
+	return nil
+}
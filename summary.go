@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// runCounts tallies what the current run did, for the summary sent at its end.
+// Scrape errors are counted in runScrapeErrors instead, which health also
+// reads.
+var runCounts struct {
+	moviesChecked      atomic.Int64
+	moviesWithNewShows atomic.Int64
+	theatresAdded      atomic.Int64
+}
+
+// RunSummary is what a NotificationSummary reports about a finished run.
+type RunSummary struct {
+	MoviesChecked      int64
+	MoviesWithNewShows int64
+	TheatresAdded      int64
+	ScrapeErrors       int64
+	Duration           time.Duration
+}
+
+// resetRunCounts zeroes the counts at the start of a run.
+func resetRunCounts() {
+	runCounts.moviesChecked.Store(0)
+	runCounts.moviesWithNewShows.Store(0)
+	runCounts.theatresAdded.Store(0)
+	runScrapeErrors.Store(0)
+}
+
+// sendSummary sends the counts of the run that took duration to the Telegram
+// chat of cfg. Like the blocked alert it goes through Telegram alone, the other
+// notifiers only carry show alerts.
+func sendSummary(cfg *Config, duration time.Duration) {
+	payload := NotificationPayload{
+		Kind: NotificationSummary,
+		Summary: RunSummary{
+			MoviesChecked:      runCounts.moviesChecked.Load(),
+			MoviesWithNewShows: runCounts.moviesWithNewShows.Load(),
+			TheatresAdded:      runCounts.theatresAdded.Load(),
+			ScrapeErrors:       runScrapeErrors.Load(),
+			Duration:           duration,
+		},
+	}
+	for _, notifier := range cfg.Notifiers {
+		if notifier.Name() != "telegram" {
+			continue
+		}
+		if err := notifier.Notify(payload); err != nil {
+			logger.WithError(err).Error("Error sending run summary")
+		}
+	}
+}
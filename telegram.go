@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	telegramSendAttempts = 3
+	// telegramRetryBackoff is the wait before the first resend, doubled after
+	// every further failure
+	telegramRetryBackoff = time.Second
+	// telegramRateLimitWaits caps how many times a single send waits out a
+	// 429 before giving up
+	telegramRateLimitWaits = 5
+
+	// defaultTelegramAPIURL is the Bot API the notifier calls unless
+	// TELEGRAM_API_URL points it at another server
+	defaultTelegramAPIURL = "https://api.telegram.org"
+
+	// telegramMessageLimit is the longest text Telegram accepts in a
+	// message, in characters
+	telegramMessageLimit = 4096
+	// telegramCaptionLimit is the longest caption Telegram accepts under a
+	// photo, in characters
+	telegramCaptionLimit = 1024
+)
+
+type TelegramButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+type TelegramKeyboard struct {
+	InlineKeyboard [][]TelegramButton `json:"inline_keyboard"`
+}
+
+// TelegramNotifier sends alerts as Markdown messages with a "Book Now" button
+// through the Telegram Bot API, to ChatID unless the alert names its own chat.
+type TelegramNotifier struct {
+	BotToken string
+	ChatID   string
+	// BaseURL is the Bot API server, defaultTelegramAPIURL unless it is a
+	// local Bot API server or a stand-in
+	BaseURL string
+	// Client makes the API calls, bounding how long a hung request blocks
+	Client *http.Client
+	// Template renders the message text from the payload when set, instead
+	// of the built-in format
+	Template *template.Template
+	// ParseMode is the parse mode messages are sent in, MarkdownV2 or
+	// HTML. When empty, the built-in format uses MarkdownV2 and Template
+	// legacy Markdown.
+	ParseMode string
+	// DisableButtons puts the booking link in the message text instead of a
+	// "Book Now" button, for chats where inline keyboards don't render
+	DisableButtons bool
+	// OnlyChatID, when set, gets every message in place of ChatID and the
+	// chats alerts name, for --preview
+	OnlyChatID string
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+// telegramParseModes are the parse modes TELEGRAM_PARSE_MODE can pick.
+var telegramParseModes = []string{"MarkdownV2", "HTML"}
+
+// parseMessageTemplate parses a custom Telegram message template, whose escape
+// func escapes text for parseMode, and renders it once with a sample payload,
+// so a template referring to unknown fields fails at startup rather than on
+// every alert.
+func parseMessageTemplate(text string, parseMode string) (*template.Template, error) {
+	tmpl, err := template.New("message").Funcs(template.FuncMap{
+		"join":   strings.Join,
+		"escape": telegramEscaper(parseMode),
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing message template: %v", err)
+	}
+
+	if err := tmpl.Execute(io.Discard, sampleNotification); err != nil {
+		return nil, fmt.Errorf("error rendering message template: %v", err)
+	}
+	return tmpl, nil
+}
+
+func (n *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (n *TelegramNotifier) Notify(msg NotificationPayload) error {
+	notificationMsg, parseMode, err := n.message(msg)
+	if err != nil {
+		return err
+	}
+
+	// A summary isn't about any one booking page, so it has no button
+	var bookingKeyboard *TelegramKeyboard
+	var bookNow string
+	if msg.BookingURL != "" && n.DisableButtons {
+		bookNow = "\n\n🎟️ Book Now: " + telegramEscaper(parseMode)(msg.BookingURL)
+	} else if msg.BookingURL != "" {
+		bookingKeyboard = &TelegramKeyboard{
+			InlineKeyboard: [][]TelegramButton{
+				{
+					{
+						Text: "🎟️ Book Now",
+						URL:  msg.BookingURL,
+					},
+				},
+			},
+		}
+	}
+
+	// Telegram rejects longer messages outright, which would lose a batched
+	// alert about many theatres altogether. The limit applies once the
+	// markup is parsed, so measuring the raw text leaves room to spare.
+	notificationMsg = truncateLines(notificationMsg, telegramMessageLimit-utf8.RuneCountInString(bookNow), utf8.RuneCountInString) + bookNow
+
+	chatID := n.ChatID
+	if msg.ChatID != "" {
+		chatID = msg.ChatID
+	}
+	if n.OnlyChatID != "" {
+		chatID = n.OnlyChatID
+	}
+
+	// The poster goes above the alert unless it is too long for a caption.
+	// An image Telegram can't fetch falls back to the text alone.
+	if msg.PosterURL != "" && utf8.RuneCountInString(notificationMsg) <= telegramCaptionLimit {
+		err := n.sendTelegramPhoto(chatID, msg.PosterURL, notificationMsg, parseMode, bookingKeyboard)
+		if err == nil {
+			return nil
+		}
+		logger.WithFields(logrus.Fields{
+			"theatre": msg.Theatre,
+			"poster":  msg.PosterURL,
+			"error":   err,
+		}).Warn("Error sending Telegram alert with poster, sending it as text")
+	}
+
+	// Only a send that can go through the next time is retried, as the
+	// queue waits for it. A message Telegram rejects, or a chat the bot
+	// can't post in, fails the same way on every attempt.
+	backoff := telegramRetryBackoff
+	for attempt := 1; attempt <= telegramSendAttempts; attempt++ {
+		err = n.sendTelegramNotification(chatID, notificationMsg, parseMode, bookingKeyboard)
+		if err == nil {
+			return nil
+		}
+		if !telegramRetryable(err) {
+			return err
+		}
+
+		if attempt < telegramSendAttempts {
+			logger.WithFields(logrus.Fields{
+				"theatre": msg.Theatre,
+				"attempt": attempt,
+				"error":   err,
+			}).Warn("Telegram send failed, retrying")
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %v", telegramSendAttempts, err)
+}
+
+// message renders the text of an alert and returns it with its parse mode.
+// Template renders it when one is set and the alert isn't a run summary. Both
+// use ParseMode when it is set. Otherwise templates are legacy Markdown, as
+// they were written for, and the built-in format is MarkdownV2, which lets
+// every scraped name be escaped, even inside bold text.
+func (n *TelegramNotifier) message(msg NotificationPayload) (string, string, error) {
+	// Custom templates are written for show alerts, so a summary, the cap
+	// alert or a failing movie always uses the built-in format
+	if n.Template != nil && msg.Kind != NotificationSummary && msg.Kind != NotificationCapReached && msg.Kind != NotificationMovieFailing {
+		var buf bytes.Buffer
+		if err := n.Template.Execute(&buf, msg); err != nil {
+			return "", "", fmt.Errorf("error rendering message template: %v", err)
+		}
+		if n.ParseMode != "" {
+			return buf.String(), n.ParseMode, nil
+		}
+		return buf.String(), "Markdown", nil
+	}
+	parseMode := n.ParseMode
+	if parseMode == "" {
+		parseMode = "MarkdownV2"
+	}
+	return builtinMessage(msg, parseMode), parseMode, nil
+}
+
+// builtinMessage renders the text of an alert in parseMode, MarkdownV2 or
+// HTML.
+func builtinMessage(msg NotificationPayload, parseMode string) string {
+	e := telegramEscaper(parseMode)
+	bold := func(text string) string {
+		if parseMode == "HTML" {
+			return "<b>" + e(text) + "</b>"
+		}
+		return "*" + e(text) + "*"
+	}
+
+	switch msg.Kind {
+	case NotificationSummary:
+		return bold(msg.Kind.Title()) + "\n\n" + e(fmt.Sprintf("Checked %d movies, %d had new shows, %d theatres added, %d scrape errors.\nTook %s.",
+			msg.Summary.MoviesChecked, msg.Summary.MoviesWithNewShows,
+			msg.Summary.TheatresAdded, msg.Summary.ScrapeErrors, msg.Summary.Duration.Round(time.Second)))
+	case NotificationCapReached:
+		return bold(msg.Kind.Title()) + "\n\n" + e(fmt.Sprintf("This run sent %d alerts, the most MAX_NOTIFICATIONS_PER_RUN allows, so the rest are only logged. Something may be wrong, like stale selectors or lost state.",
+			msg.NotificationCap))
+	case NotificationMovieFailing:
+		return bold(msg.Kind.Title()) + "\n\n" + bold(msg.Movie) +
+			e(fmt.Sprintf(" has failed %d runs in a row, check its selectors and booking URL.\nLast error: %s", msg.ConsecutiveErrors, msg.LastError))
+	case NotificationBlocked:
+		return bold(msg.Kind.Title()) + "\n\n" + e("BookMyShow served a bot challenge instead of the booking page of ") +
+			bold(msg.Movie) + e(fmt.Sprintf(" (%s, %s). Scrapes will keep failing until it stops.", msg.City, msg.Date))
+	}
+
+	notificationMsg := bold(msg.Kind.Title()) + "\n\n🎥 Movie: " + bold(msg.Movie) +
+		"\n📍 City: " + bold(msg.City) + "\n📅 Date: " + bold(msg.Date)
+
+	if len(msg.Theatres) > 0 {
+		notificationMsg += "\n"
+		for _, theatre := range msg.Theatres {
+			notificationMsg += "\n🏟️ " + bold(theatre.Name) + e(fmt.Sprintf(": %d shows", theatre.ShowCount))
+			if len(theatre.ShowTimes) > 0 {
+				notificationMsg += e(fmt.Sprintf(" (%s)", strings.Join(theatre.ShowTimes, ", ")))
+			}
+		}
+		if totals := msg.totals(); totals != "" {
+			notificationMsg += "\n\n📊 " + e(totals)
+		}
+		return notificationMsg
+	}
+
+	if msg.Theatre != "" {
+		notificationMsg += "\n🏟️ Theatre: " + bold(msg.Theatre)
+	}
+	switch msg.Kind {
+	case NotificationNewShow, NotificationMoreShows, NotificationPriceChanged, NotificationNewFormat:
+		if len(msg.ShowTimes) > 0 {
+			notificationMsg += "\n🕒 Timings: " + bold(strings.Join(msg.ShowTimes, ", "))
+		}
+		notificationMsg += "\nShows: " + bold(strconv.Itoa(msg.ShowCount))
+		if msg.Kind == NotificationMoreShows {
+			notificationMsg += e(fmt.Sprintf(" (was %d)", msg.PreviousShowCount))
+		}
+		if change := msg.priceChange(); change != "" {
+			notificationMsg += "\n💰 Price: " + bold(change)
+		}
+		if change := msg.formatChange(); change != "" {
+			notificationMsg += "\n🆕 " + bold(change)
+		}
+		if since := msg.availableSince(); since != "" {
+			notificationMsg += "\n⏳ " + e(since)
+		}
+	}
+	if totals := msg.totals(); totals != "" {
+		notificationMsg += "\n📊 " + e(totals)
+	}
+	return notificationMsg
+}
+
+// telegramEscaper returns what makes text safe to put in a message of
+// parseMode as is.
+func telegramEscaper(parseMode string) func(string) string {
+	switch parseMode {
+	case "HTML":
+		return html.EscapeString
+	case "Markdown":
+		return escapeMarkdown
+	default:
+		return escapeMarkdownV2
+	}
+}
+
+// markdownV2Escaper escapes every character MarkdownV2 reserves, which
+// Telegram otherwise rejects or renders as formatting in names like
+// "PVR_Lulu (IMAX)".
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// escapeMarkdownV2 makes text safe to put in a MarkdownV2 message as is.
+func escapeMarkdownV2(text string) string {
+	return markdownV2Escaper.Replace(text)
+}
+
+// markdownEscaper escapes the characters legacy Markdown treats as formatting,
+// for use outside bold and other entities in custom templates.
+var markdownEscaper = strings.NewReplacer(
+	"_", `\_`,
+	"*", `\*`,
+	"`", "\\`",
+	"[", `\[`,
+)
+
+// escapeMarkdown makes text safe to put in a legacy Markdown message as is.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// sendTelegramNotification sends message to chatID, with keyboard under it
+// unless keyboard is nil. An empty parseMode sends message as plain text.
+func (n *TelegramNotifier) sendTelegramNotification(chatID string, message string, parseMode string, keyboard *TelegramKeyboard) error {
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    message,
+	}
+	if parseMode != "" {
+		payload["parse_mode"] = parseMode
+	}
+	if keyboard != nil {
+		payload["reply_markup"] = keyboard
+	}
+	return n.callTelegram("sendMessage", chatID, payload)
+}
+
+// sendTelegramPhoto sends the image at photoURL to chatID with caption under
+// it, formatted and with a keyboard like sendTelegramNotification.
+func (n *TelegramNotifier) sendTelegramPhoto(chatID string, photoURL string, caption string, parseMode string, keyboard *TelegramKeyboard) error {
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"photo":   photoURL,
+		"caption": caption,
+	}
+	if parseMode != "" {
+		payload["parse_mode"] = parseMode
+	}
+	if keyboard != nil {
+		payload["reply_markup"] = keyboard
+	}
+	return n.callTelegram("sendPhoto", chatID, payload)
+}
+
+// telegramStatusError is a call the Bot API answered with an error status.
+type telegramStatusError struct {
+	// StatusCode is the HTTP status of the response, or its error_code when
+	// the error came with a 200
+	StatusCode int
+	err        error
+}
+
+func (e *telegramStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *telegramStatusError) Unwrap() error {
+	return e.err
+}
+
+// telegramRetryable reports whether a call that failed with err is worth
+// making again: network errors and server errors are, while the 4xx errors
+// for a bad request or chat aren't. Rate limits are waited out by
+// callTelegram instead.
+func telegramRetryable(err error) bool {
+	var statusErr *telegramStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// callTelegram calls the Bot API method with payload, waiting out rate limits
+// up to telegramRateLimitWaits times.
+func (n *TelegramNotifier) callTelegram(method string, chatID string, payload map[string]interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), string(payloadJSON))
+		return nil
+	}
+
+	apiURL := n.apiURL(method)
+	for waits := 0; ; waits++ {
+		retryAfter, err := n.postTelegramMessage(apiURL, payloadJSON)
+		if retryAfter == 0 {
+			return err
+		}
+		if waits == telegramRateLimitWaits {
+			return fmt.Errorf("telegram API still rate limited after %d waits: %w", waits, err)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"chat_id":     chatID,
+			"retry_after": retryAfter.String(),
+		}).Warn("Telegram rate limit hit, waiting before retrying")
+		time.Sleep(retryAfter)
+	}
+}
+
+// apiURL returns the URL of the Bot API method for the notifier's bot.
+func (n *TelegramNotifier) apiURL(method string) string {
+	baseURL := n.BaseURL
+	if baseURL == "" {
+		baseURL = defaultTelegramAPIURL
+	}
+	return fmt.Sprintf("%s/bot%s/%s", strings.TrimRight(baseURL, "/"), n.BotToken, method)
+}
+
+// postTelegramMessage makes a single call to apiURL. When Telegram rate
+// limits the call it returns how long to wait before trying again. An error
+// response is returned as a *telegramStatusError.
+func (n *TelegramNotifier) postTelegramMessage(apiURL string, payloadJSON []byte) (time.Duration, error) {
+	response, err := n.Client.Post(apiURL, "application/json", bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return 0, fmt.Errorf("error making telegram request: %v", err)
+	}
+	defer response.Body.Close()
+
+	var apiResponse struct {
+		Ok          bool   `json:"ok"`
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		err = fmt.Errorf("error decoding response: %v", err)
+		if response.StatusCode != http.StatusOK {
+			return 0, &telegramStatusError{StatusCode: response.StatusCode, err: err}
+		}
+		return 0, err
+	}
+
+	if !apiResponse.Ok {
+		status := response.StatusCode
+		if status == http.StatusOK && apiResponse.ErrorCode != 0 {
+			status = apiResponse.ErrorCode
+		}
+		err := &telegramStatusError{StatusCode: status, err: fmt.Errorf("telegram API error: %s", apiResponse.Description)}
+		if status == http.StatusTooManyRequests && apiResponse.Parameters.RetryAfter > 0 {
+			return time.Duration(apiResponse.Parameters.RetryAfter) * time.Second, err
+		}
+		return 0, err
+	}
+
+	return 0, nil
+}
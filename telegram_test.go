@@ -0,0 +1,490 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// telegramRequest is a call the stand-in Bot API server received.
+type telegramRequest struct {
+	Path    string
+	Payload map[string]interface{}
+}
+
+// telegramServer is a stand-in for the Bot API that records the calls it
+// gets and answers them with the replies it is given, in order, repeating
+// the last one once they run out.
+type telegramServer struct {
+	t       *testing.T
+	mu      sync.Mutex
+	replies []telegramReply
+	calls   []telegramRequest
+}
+
+// telegramReply is how telegramServer answers a call.
+type telegramReply struct {
+	status int
+	body   string
+}
+
+// telegramOK is the reply of a successful call.
+var telegramOK = telegramReply{status: http.StatusOK, body: `{"ok":true,"result":{"message_id":1}}`}
+
+// newTelegramServer starts a telegramServer answering with replies, and
+// returns it with a TelegramNotifier that sends to it.
+func newTelegramServer(t *testing.T, replies ...telegramReply) (*telegramServer, *TelegramNotifier) {
+	t.Helper()
+	if len(replies) == 0 {
+		replies = []telegramReply{telegramOK}
+	}
+	server := &telegramServer{t: t, replies: replies}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, &TelegramNotifier{
+		BotToken: "123:abc",
+		ChatID:   "-1001",
+		BaseURL:  httpServer.URL,
+		Client:   httpServer.Client(),
+	}
+}
+
+func (s *telegramServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("reading request body: %v", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		s.t.Errorf("request body %q isn't JSON: %v", body, err)
+	}
+
+	s.mu.Lock()
+	reply := s.replies[min(len(s.calls), len(s.replies)-1)]
+	s.calls = append(s.calls, telegramRequest{Path: r.URL.Path, Payload: payload})
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reply.status)
+	io.WriteString(w, reply.body)
+}
+
+// requests returns the calls the server got so far.
+func (s *telegramServer) requests() []telegramRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]telegramRequest(nil), s.calls...)
+}
+
+// sentText returns the text of the only message the server got.
+func (s *telegramServer) sentText(t *testing.T) string {
+	t.Helper()
+	calls := s.requests()
+	if len(calls) != 1 {
+		t.Fatalf("server got %d calls, want 1", len(calls))
+	}
+	text, _ := calls[0].Payload["text"].(string)
+	return text
+}
+
+// bookNowMarkup is the reply_markup of an alert linking bookingURL, as it
+// decodes from the JSON sent.
+func bookNowMarkup(bookingURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"inline_keyboard": []interface{}{
+			[]interface{}{
+				map[string]interface{}{"text": "🎟️ Book Now", "url": bookingURL},
+			},
+		},
+	}
+}
+
+func TestTelegramNotifyPayload(t *testing.T) {
+	server, notifier := newTelegramServer(t)
+	msg := NotificationPayload{
+		Kind:       NotificationNewShow,
+		Movie:      "L2: Empuraan",
+		City:       "kochi",
+		Date:       "27-03-2025",
+		Theatre:    "PVR: Lulu, Kochi",
+		ShowCount:  2,
+		BookingURL: "https://in.bookmyshow.com/buytickets/l2-empuraan-kochi/movie-koch-ET00305698-MT/20250327",
+	}
+	if err := notifier.Notify(msg); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	calls := server.requests()
+	if len(calls) != 1 {
+		t.Fatalf("server got %d calls, want 1", len(calls))
+	}
+	if calls[0].Path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s, want /bot123:abc/sendMessage", calls[0].Path)
+	}
+	payload := calls[0].Payload
+	if payload["chat_id"] != "-1001" {
+		t.Errorf("chat_id = %v, want -1001", payload["chat_id"])
+	}
+	if payload["parse_mode"] != "MarkdownV2" {
+		t.Errorf("parse_mode = %v, want MarkdownV2", payload["parse_mode"])
+	}
+	if wantMarkup := bookNowMarkup(msg.BookingURL); !reflect.DeepEqual(payload["reply_markup"], wantMarkup) {
+		t.Errorf("reply_markup = %v, want %v", payload["reply_markup"], wantMarkup)
+	}
+	if text, _ := payload["text"].(string); !strings.Contains(text, `*PVR: Lulu, Kochi*`) {
+		t.Errorf("text = %q, want it to name the theatre in bold", text)
+	}
+}
+
+func TestTelegramNotifyChatOverrides(t *testing.T) {
+	tests := []struct {
+		name       string
+		chatID     string
+		onlyChatID string
+		want       string
+	}{
+		{name: "default chat", want: "-1001"},
+		{name: "alert names its chat", chatID: "-1002", want: "-1002"},
+		{name: "preview chat wins", chatID: "-1002", onlyChatID: "42", want: "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, notifier := newTelegramServer(t)
+			notifier.OnlyChatID = tt.onlyChatID
+			if err := notifier.Notify(NotificationPayload{Kind: NotificationNewShow, Movie: "L2: Empuraan", ChatID: tt.chatID}); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			calls := server.requests()
+			if len(calls) != 1 || calls[0].Payload["chat_id"] != tt.want {
+				t.Fatalf("calls = %+v, want one to chat %s", calls, tt.want)
+			}
+			if _, ok := calls[0].Payload["reply_markup"]; ok {
+				t.Error("reply_markup set for an alert without a booking URL")
+			}
+		})
+	}
+}
+
+func TestTelegramAPIErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   telegramReply
+		wantErr string
+	}{
+		{
+			name:    "ok false",
+			reply:   telegramReply{status: http.StatusOK, body: `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities"}`},
+			wantErr: "telegram API error: Bad Request: can't parse entities",
+		},
+		{
+			name:    "non-200 with an API error",
+			reply:   telegramReply{status: http.StatusForbidden, body: `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`},
+			wantErr: "telegram API error: Forbidden: bot was blocked by the user",
+		},
+		{
+			name:    "non-200 without JSON",
+			reply:   telegramReply{status: http.StatusBadGateway, body: `<html>502 Bad Gateway</html>`},
+			wantErr: "error decoding response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, notifier := newTelegramServer(t, tt.reply)
+			err := notifier.sendTelegramNotification(notifier.ChatID, "hello", "MarkdownV2", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("sendTelegramNotification() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if calls := server.requests(); len(calls) != 1 {
+				t.Errorf("server got %d calls, want 1, only rate limits are retried here", len(calls))
+			}
+		})
+	}
+}
+
+func TestTelegramRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply telegramReply
+		want  time.Duration
+	}{
+		{
+			name:  "429 status",
+			reply: telegramReply{status: http.StatusTooManyRequests, body: `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`},
+			want:  7 * time.Second,
+		},
+		{
+			name:  "429 error code",
+			reply: telegramReply{status: http.StatusOK, body: `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 3","parameters":{"retry_after":3}}`},
+			want:  3 * time.Second,
+		},
+		{
+			name:  "other error",
+			reply: telegramReply{status: http.StatusBadRequest, body: `{"ok":false,"error_code":400,"description":"Bad Request","parameters":{"retry_after":3}}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, notifier := newTelegramServer(t, tt.reply)
+			retryAfter, err := notifier.postTelegramMessage(notifier.apiURL("sendMessage"), []byte(`{"chat_id":"-1001","text":"hello"}`))
+			if err == nil {
+				t.Error("postTelegramMessage() error = nil, want the API error")
+			}
+			if retryAfter != tt.want {
+				t.Errorf("postTelegramMessage() retry after = %s, want %s", retryAfter, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramNotifyRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		replies   []telegramReply
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "bad request",
+			replies:   []telegramReply{{status: http.StatusBadRequest, body: `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities"}`}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "bot blocked",
+			replies:   []telegramReply{{status: http.StatusForbidden, body: `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "ok false with 400 error code",
+			replies:   []telegramReply{{status: http.StatusOK, body: `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "server error",
+			replies:   []telegramReply{{status: http.StatusBadGateway, body: `<html>502 Bad Gateway</html>`}, telegramOK},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, notifier := newTelegramServer(t, tt.replies...)
+			err := notifier.Notify(NotificationPayload{Kind: NotificationNewShow, Movie: "L2: Empuraan"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, want error %t", err, tt.wantErr)
+			}
+			if calls := server.requests(); len(calls) != tt.wantCalls {
+				t.Errorf("server got %d calls, want %d", len(calls), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestTelegramWaitsOutRateLimit(t *testing.T) {
+	server, notifier := newTelegramServer(t,
+		telegramReply{status: http.StatusTooManyRequests, body: `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`},
+		telegramOK,
+	)
+
+	start := time.Now()
+	if err := notifier.sendTelegramNotification(notifier.ChatID, "hello", "MarkdownV2", nil); err != nil {
+		t.Fatalf("sendTelegramNotification() error = %v, want the resend after the wait to succeed", err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("resent after %s, want at least the 1s retry_after", waited)
+	}
+	calls := server.requests()
+	if len(calls) != 2 {
+		t.Fatalf("server got %d calls, want the rate limited one and its resend", len(calls))
+	}
+	if !reflect.DeepEqual(calls[0].Payload, calls[1].Payload) {
+		t.Errorf("resent %v, want the same payload as %v", calls[1].Payload, calls[0].Payload)
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "PVR_Lulu_Kochi", want: `PVR\_Lulu\_Kochi`},
+		{text: "INOX (IMAX) *Recliner*", want: `INOX \(IMAX\) \*Recliner\*`},
+		{text: "[Asset] Cinemas - Hall #2.", want: `\[Asset\] Cinemas \- Hall \#2\.`},
+		{text: `C:\movies`, want: `C:\\movies`},
+		{text: "Cinepolis: Centre Square Mall, Kochi", want: "Cinepolis: Centre Square Mall, Kochi"},
+	}
+	for _, tt := range tests {
+		if got := escapeMarkdownV2(tt.text); got != tt.want {
+			t.Errorf("escapeMarkdownV2(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTelegramEscapesUnderscoredNames(t *testing.T) {
+	server, notifier := newTelegramServer(t)
+	err := notifier.Notify(NotificationPayload{
+		Kind:      NotificationNewShow,
+		Movie:     "L2_Empuraan",
+		City:      "kochi",
+		Date:      "27-03-2025",
+		Theatre:   "PVR_Lulu_Kochi",
+		ShowCount: 1,
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	text := server.sentText(t)
+	for _, want := range []string{`*L2\_Empuraan*`, `*PVR\_Lulu\_Kochi*`, `*27\-03\-2025*`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text = %q, want it to contain %s", text, want)
+		}
+	}
+	if strings.Contains(text, "PVR_Lulu") {
+		t.Errorf("text = %q has an unescaped underscore", text)
+	}
+}
+
+func TestTelegramParseModes(t *testing.T) {
+	msg := NotificationPayload{
+		Kind:       NotificationNewShow,
+		Movie:      "L2: Empuraan",
+		City:       "kochi",
+		Date:       "27-03-2025",
+		Theatre:    "Q_Cinemas <Gold>",
+		ShowCount:  1,
+		BookingURL: "https://in.bookmyshow.com/buytickets/l2-empuraan-kochi/movie-koch-ET00305698-MT/20250327",
+	}
+	tests := []struct {
+		name      string
+		parseMode string
+		template  string
+		want      string
+	}{
+		{
+			name: "MarkdownV2 by default",
+			want: `*Q\_Cinemas <Gold\>*`,
+		},
+		{
+			name:      "HTML",
+			parseMode: "HTML",
+			want:      "<b>Q_Cinemas &lt;Gold&gt;</b>",
+		},
+		{
+			name:     "Markdown for templates",
+			template: "New shows at {{escape .Theatre}} for *{{.Movie}}*",
+			want:     `New shows at Q\_Cinemas <Gold> for *L2: Empuraan*`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, notifier := newTelegramServer(t)
+			notifier.ParseMode = tt.parseMode
+			wantMode := tt.parseMode
+			if tt.template != "" {
+				templateParseMode := "Markdown"
+				tmpl, err := parseMessageTemplate(tt.template, templateParseMode)
+				if err != nil {
+					t.Fatalf("parseMessageTemplate() error = %v", err)
+				}
+				notifier.Template = tmpl
+				wantMode = templateParseMode
+			}
+			if wantMode == "" {
+				wantMode = "MarkdownV2"
+			}
+			if err := notifier.Notify(msg); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			payload := server.requests()[0].Payload
+			if payload["parse_mode"] != wantMode {
+				t.Errorf("parse_mode = %v, want %s", payload["parse_mode"], wantMode)
+			}
+			if text, _ := payload["text"].(string); !strings.Contains(text, tt.want) {
+				t.Errorf("text = %q, want it to contain %q", text, tt.want)
+			}
+			// The button isn't parsed as markup, so no mode escapes its URL
+			if want := bookNowMarkup(msg.BookingURL); !reflect.DeepEqual(payload["reply_markup"], want) {
+				t.Errorf("reply_markup = %v, want %v", payload["reply_markup"], want)
+			}
+		})
+	}
+}
+
+func TestTelegramParseModesWithoutButtons(t *testing.T) {
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseMode: "MarkdownV2", want: `Book Now: https://in\.bookmyshow\.com/buytickets/kochi\_show/20250327`},
+		{parseMode: "HTML", want: "Book Now: https://in.bookmyshow.com/buytickets/kochi_show/20250327"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			server, notifier := newTelegramServer(t)
+			notifier.ParseMode = tt.parseMode
+			notifier.DisableButtons = true
+			err := notifier.Notify(NotificationPayload{
+				Kind:       NotificationNewShow,
+				Movie:      "L2: Empuraan",
+				BookingURL: "https://in.bookmyshow.com/buytickets/kochi_show/20250327",
+			})
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			payload := server.requests()[0].Payload
+			if _, ok := payload["reply_markup"]; ok {
+				t.Error("reply_markup set with DisableButtons")
+			}
+			if text, _ := payload["text"].(string); !strings.Contains(text, tt.want) {
+				t.Errorf("text = %q, want it to contain %q", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramTruncatesLongBatch(t *testing.T) {
+	server, notifier := newTelegramServer(t)
+	msg := NotificationPayload{
+		Kind:       NotificationNewShow,
+		Movie:      "L2: Empuraan",
+		City:       "kochi",
+		Date:       "27-03-2025",
+		BookingURL: "https://in.bookmyshow.com/buytickets/l2-empuraan-kochi/movie-koch-ET00305698-MT/20250327",
+	}
+	for i := 0; i < 300; i++ {
+		msg.Theatres = append(msg.Theatres, TheatreSummary{
+			Name:      fmt.Sprintf("Theatre %d: Some Mall, Kochi", i),
+			ShowCount: 4,
+			ShowTimes: []string{"9:00 AM", "12:30 PM", "4:15 PM", "10:00 PM"},
+		})
+	}
+	if full := builtinMessage(msg, "MarkdownV2"); utf8.RuneCountInString(full) <= telegramMessageLimit {
+		t.Fatalf("batched message is only %d characters, want one over the limit", utf8.RuneCountInString(full))
+	}
+
+	if err := notifier.Notify(msg); err != nil {
+		t.Fatalf("Notify() error = %v, want the truncated message delivered", err)
+	}
+	text := server.sentText(t)
+	if n := utf8.RuneCountInString(text); n > telegramMessageLimit {
+		t.Errorf("sent %d characters, over the limit of %d", n, telegramMessageLimit)
+	}
+	if !strings.Contains(text, `*Theatre 0: Some Mall, Kochi*`) {
+		t.Errorf("text = %q, want it to start listing the theatres", text)
+	}
+	if !regexp.MustCompile(`\n…and \d+ more$`).MatchString(text) {
+		t.Errorf("text ends %q, want the count of theatres left out", text[max(0, len(text)-40):])
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// theatreCountHintPattern matches the count BookMyShow shows above some theatre
+// lists, like "Showing 24 theatres".
+var theatreCountHintPattern = regexp.MustCompile(`(?i)\bshowing\s+(\d+)\s+(?:theatres|cinemas|venues)\b`)
+
+// theatreShortfallRatio is the share of the hinted theatres a scrape has to
+// find for the theatre list to count as complete. A little below one, since
+// the hint can count theatres the filters or unreadable rows leave out.
+const theatreShortfallRatio = 0.9
+
+// readTheatreCountHint returns how many theatres page says it lists, or zero
+// when it doesn't say.
+func readTheatreCountHint(page PageController) int {
+	_, text, err := page.Text()
+	if err != nil {
+		return 0
+	}
+	match := theatreCountHintPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// theatreListShort reports whether scraped, the theatres read off a list whose
+// page hinted it has hint, is suspiciously few.
+func theatreListShort(scraped int, hint int) bool {
+	return hint > 0 && float64(scraped) < float64(hint)*theatreShortfallRatio
+}
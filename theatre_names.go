@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+)
+
+// defaultTheatreNameSuffixes are the tags BookMyShow adds to the names of some
+// theatres on some runs only, stripped unless THEATRE_NAME_SUFFIXES is set.
+var defaultTheatreNameSuffixes = []string{"(Dolby Atmos)", "(Dolby)"}
+
+// TheatreNames decides when two scraped names are the same theatre, so a
+// theatre BookMyShow renders a little differently on another run is still
+// known. Names are compared by their key, the displayed name stays as scraped.
+type TheatreNames struct {
+	// Suffixes are stripped from the end of names, in any case
+	Suffixes []string
+	// Aliases map the key of a variant to the key of the theatre it is
+	Aliases map[string]string
+}
+
+// newTheatreNames returns the rules stripping suffixes, with aliases mapping
+// names to the name of the theatre each of them is.
+func newTheatreNames(suffixes []string, aliases map[string]string) *TheatreNames {
+	names := &TheatreNames{Aliases: make(map[string]string, len(aliases))}
+	for _, suffix := range suffixes {
+		if suffix = normalizeSpace(suffix); suffix != "" {
+			names.Suffixes = append(names.Suffixes, strings.ToLower(suffix))
+		}
+	}
+	for variant, name := range aliases {
+		names.Aliases[names.normalize(variant)] = names.normalize(name)
+	}
+	return names
+}
+
+// key returns what name is compared by: trimmed, with its whitespace collapsed,
+// its suffixes stripped and lowercased, and then replaced by its alias.
+func (n *TheatreNames) key(name string) string {
+	key := n.normalize(name)
+	if alias, ok := n.Aliases[key]; ok {
+		return alias
+	}
+	return key
+}
+
+// normalize is key without the aliases.
+func (n *TheatreNames) normalize(name string) string {
+	name = strings.ToLower(normalizeSpace(name))
+	// Suffixes can be stacked, as with "(Dolby) (4K)"
+	for stripped := true; stripped; {
+		stripped = false
+		for _, suffix := range n.Suffixes {
+			if trimmed, ok := strings.CutSuffix(name, suffix); ok && trimmed != "" {
+				name = strings.TrimSpace(trimmed)
+				stripped = true
+			}
+		}
+	}
+	return name
+}
+
+// normalizeSpace trims s and collapses every run of whitespace in it to a
+// single space.
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ShowTimeWindow is the part of the day a movie's shows are watched in, like
+// 17:00 to 23:00 for evening shows. Both ends are included, and a window whose
+// End is before its Start spans midnight.
+type ShowTimeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// validate checks that both ends of the window are times of day.
+func (w ShowTimeWindow) validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return fmt.Errorf("time_window start %q %v", w.Start, err)
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return fmt.Errorf("time_window end %q %v", w.End, err)
+	}
+	return nil
+}
+
+// contains reports whether a show at showTime, as parseShowTime returns it,
+// starts within the window. A show without a time is never in it.
+func (w ShowTimeWindow) contains(showTime string) bool {
+	show, err := time.Parse("3:04 PM", showTime)
+	if err != nil {
+		return false
+	}
+	offset := time.Duration(show.Hour())*time.Hour + time.Duration(show.Minute())*time.Minute
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	if start <= end {
+		return offset >= start && offset <= end
+	}
+	return offset >= start || offset <= end
+}
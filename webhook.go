@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// webhookEvents are the names of each kind of alert in webhook bodies, which
+// stay the same when the titles change.
+var webhookEvents = map[NotificationKind]string{
+	NotificationNewShow:       "new_show",
+	NotificationShowsRemoved:  "shows_removed",
+	NotificationMoreShows:     "more_shows",
+	NotificationPriceChanged:  "price_changed",
+	NotificationBookingOpened: "booking_opened",
+	NotificationSoldOut:       "sold_out",
+	NotificationNewFormat:     "new_format",
+}
+
+// webhookData is what WEBHOOK_TEMPLATE is rendered with: the alert, and the
+// name of its kind.
+type webhookData struct {
+	NotificationPayload
+	Event string
+}
+
+// webhookTheatre is a theatre of a batched alert in the default body.
+type webhookTheatre struct {
+	Name      string   `json:"name"`
+	ShowCount int      `json:"show_count"`
+	ShowTimes []string `json:"show_times,omitempty"`
+}
+
+// webhookBody is what a webhook receives when WEBHOOK_TEMPLATE isn't set.
+type webhookBody struct {
+	Event             string           `json:"event"`
+	Title             string           `json:"title"`
+	Movie             string           `json:"movie"`
+	City              string           `json:"city"`
+	Date              string           `json:"date"`
+	Theatre           string           `json:"theatre,omitempty"`
+	ShowCount         int              `json:"show_count,omitempty"`
+	ShowTimes         []string         `json:"show_times,omitempty"`
+	PreviousShowCount int              `json:"previous_show_count,omitempty"`
+	Price             float64          `json:"price,omitempty"`
+	PreviousPrice     float64          `json:"previous_price,omitempty"`
+	NewFormats        []string         `json:"new_formats,omitempty"`
+	Theatres          []webhookTheatre `json:"theatres,omitempty"`
+	TotalTheatres     int              `json:"total_theatres,omitempty"`
+	TotalShows        int              `json:"total_shows,omitempty"`
+	BookingURL        string           `json:"booking_url"`
+	PosterURL         string           `json:"poster_url,omitempty"`
+}
+
+// WebhookNotifier posts alerts as JSON to any URL, for integrations like Home
+// Assistant, Zapier or n8n. The body is Template rendered over the alert, or
+// webhookBody without one.
+type WebhookNotifier struct {
+	URL string
+	// Headers are sent with every request, e.g. for authentication
+	Headers  map[string]string
+	Template *template.Template
+	Client   *http.Client
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+// parseWebhookTemplate parses a WEBHOOK_TEMPLATE, checking that it renders
+// valid JSON.
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"join": strings.Join,
+		// json quotes a value so scraped names can't break the body
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing webhook template: %v", err)
+	}
+	if _, err := renderWebhookTemplate(tmpl, sampleNotification); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderWebhookTemplate renders tmpl over msg, failing when the result isn't
+// JSON.
+func renderWebhookTemplate(tmpl *template.Template, msg NotificationPayload) ([]byte, error) {
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, webhookData{NotificationPayload: msg, Event: webhookEvents[msg.Kind]}); err != nil {
+		return nil, fmt.Errorf("error rendering webhook template: %v", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, errors.New("webhook template didn't render valid JSON, quote values with the json function")
+	}
+	return body.Bytes(), nil
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *WebhookNotifier) Notify(msg NotificationPayload) error {
+	var payloadJSON []byte
+	var err error
+	if n.Template != nil {
+		if payloadJSON, err = renderWebhookTemplate(n.Template, msg); err != nil {
+			return err
+		}
+	} else if payloadJSON, err = json.Marshal(defaultWebhookBody(msg)); err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), string(payloadJSON))
+		return nil
+	}
+
+	request, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range n.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error making webhook request: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("webhook error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// defaultWebhookBody is the body of msg when no template is set.
+func defaultWebhookBody(msg NotificationPayload) webhookBody {
+	body := webhookBody{
+		Event:             webhookEvents[msg.Kind],
+		Title:             msg.Kind.Title(),
+		Movie:             msg.Movie,
+		City:              msg.City,
+		Date:              msg.Date,
+		Theatre:           msg.Theatre,
+		ShowCount:         msg.ShowCount,
+		ShowTimes:         msg.ShowTimes,
+		PreviousShowCount: msg.PreviousShowCount,
+		Price:             msg.Price,
+		PreviousPrice:     msg.PreviousPrice,
+		NewFormats:        msg.NewFormats,
+		TotalTheatres:     msg.TotalTheatres,
+		TotalShows:        msg.TotalShows,
+		BookingURL:        msg.BookingURL,
+		PosterURL:         msg.PosterURL,
+	}
+	for _, theatre := range msg.Theatres {
+		body.Theatres = append(body.Theatres, webhookTheatre{
+			Name:      theatre.Name,
+			ShowCount: theatre.ShowCount,
+			ShowTimes: theatre.ShowTimes,
+		})
+	}
+	return body
+}
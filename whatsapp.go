@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// whatsappAPIURL is the Cloud API endpoint messages are sent from, filled in
+// with the sending phone number ID.
+const whatsappAPIURL = "https://graph.facebook.com/v20.0/%s/messages"
+
+// whatsappTokenErrorCode is the Graph API error code for an expired or
+// invalidated access token.
+const whatsappTokenErrorCode = 190
+
+// whatsappTextLimit is the longest text message body the Cloud API accepts,
+// in characters.
+const whatsappTextLimit = 4096
+
+// ErrWhatsAppTokenExpired is wrapped by the errors of sends rejected because
+// WHATSAPP_TOKEN has expired or was revoked.
+var ErrWhatsAppTokenExpired = errors.New("whatsapp access token expired or invalid, refresh WHATSAPP_TOKEN")
+
+// WhatsAppNotifier sends alerts as text messages through the WhatsApp
+// Business Cloud API.
+type WhatsAppNotifier struct {
+	Token   string
+	PhoneID string
+	To      string
+	Client  *http.Client
+	// DryRun logs the messages instead of sending them
+	DryRun bool
+}
+
+type whatsappErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+func (n *WhatsAppNotifier) Name() string {
+	return "whatsapp"
+}
+
+func (n *WhatsAppNotifier) Notify(msg NotificationPayload) error {
+	lines := []string{
+		fmt.Sprintf("*%s*", msg.Kind.Title()),
+		"",
+		fmt.Sprintf("🎥 Movie: *%s*", msg.Movie),
+		fmt.Sprintf("📍 City: *%s*", msg.City),
+		fmt.Sprintf("📅 Date: *%s*", msg.Date),
+	}
+	if len(msg.Theatres) > 0 {
+		for _, theatre := range msg.Theatres {
+			lines = append(lines, fmt.Sprintf("🏟️ *%s*: %d shows", theatre.Name, theatre.ShowCount))
+		}
+	} else if msg.Theatre != "" {
+		lines = append(lines, fmt.Sprintf("🏟️ Theatre: *%s*", msg.Theatre))
+		if msg.Kind != NotificationShowsRemoved {
+			if len(msg.ShowTimes) > 0 {
+				lines = append(lines, fmt.Sprintf("🕒 Timings: *%s*", strings.Join(msg.ShowTimes, ", ")))
+			}
+			shows := fmt.Sprintf("Shows: *%d*", msg.ShowCount)
+			if msg.Kind == NotificationMoreShows {
+				shows += fmt.Sprintf(" (was %d)", msg.PreviousShowCount)
+			}
+			lines = append(lines, shows)
+			if change := msg.priceChange(); change != "" {
+				lines = append(lines, fmt.Sprintf("💰 Price: *%s*", change))
+			}
+			if change := msg.formatChange(); change != "" {
+				lines = append(lines, fmt.Sprintf("🆕 *%s*", change))
+			}
+			if since := msg.availableSince(); since != "" {
+				lines = append(lines, "⏳ "+since)
+			}
+		}
+	}
+	if totals := msg.totals(); totals != "" {
+		lines = append(lines, "📊 "+totals)
+	}
+	// The link goes after the cut, a shortened list is still bookable
+	bookNow := "\n\n🎟️ Book Now: " + msg.BookingURL
+	body := truncateLines(strings.Join(lines, "\n"), whatsappTextLimit-utf8.RuneCountInString(bookNow), utf8.RuneCountInString) + bookNow
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                n.To,
+		"type":              "text",
+		"text": map[string]interface{}{
+			"body":        body,
+			"preview_url": true,
+		},
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	if n.DryRun {
+		logDryRun(n.Name(), string(payloadJSON))
+		return nil
+	}
+
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf(whatsappAPIURL, n.PhoneID), bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return fmt.Errorf("error creating whatsapp request: %v", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+n.Token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error making whatsapp request: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(response.Body)
+		var apiError whatsappErrorResponse
+		if json.Unmarshal(body, &apiError) == nil && apiError.Error.Code == whatsappTokenErrorCode {
+			return fmt.Errorf("%w: %s", ErrWhatsAppTokenExpired, apiError.Error.Message)
+		}
+		return fmt.Errorf("whatsapp API error: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}